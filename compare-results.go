@@ -0,0 +1,233 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"math/rand"
+
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+)
+
+// Structs
+
+// Group collects latencies of one operation of one
+// scenario on one target, in milliseconds.
+type Group struct {
+	Latencies []float64
+	Errors    int
+}
+
+// Functions
+
+// GroupKey names the group a record belongs to. If
+// both result sets are restricted to one target each,
+// the target is left out so that they can be matched.
+func GroupKey(rec records.Record, withTarget bool) string {
+
+	if withTarget {
+		return fmt.Sprintf("%s/%s/%s", rec.Scenario, rec.Op, rec.Target)
+	}
+
+	return fmt.Sprintf("%s/%s", rec.Scenario, rec.Op)
+}
+
+// LoadGroups reads a result set and sorts all records
+// of supplied target (or all targets if empty) into
+// groups by scenario, operation and target. Records
+// in the warm-up window are left out.
+func LoadGroups(path string, target string, warmup records.Warmup) (map[string]*Group, error) {
+
+	recs, err := records.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	recs, _, err = warmup.Split(recs)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*Group)
+
+	for _, rec := range recs {
+
+		if (target != "") && (strings.EqualFold(rec.Target, target) != true) {
+			continue
+		}
+
+		key := GroupKey(rec, (target == ""))
+
+		group, found := groups[key]
+		if found != true {
+			group = &Group{
+				Latencies: make([]float64, 0, 100),
+			}
+			groups[key] = group
+		}
+
+		if rec.Status != "OK" {
+			group.Errors++
+			continue
+		}
+
+		group.Latencies = append(group.Latencies, (float64(rec.Latency) / float64(time.Millisecond)))
+	}
+
+	return groups, nil
+}
+
+// ParsePercentiles turns a comma-separated list of
+// percentiles into floats.
+func ParsePercentiles(list string) ([]float64, error) {
+
+	parts := strings.Split(list, ",")
+	percentiles := make([]float64, 0, len(parts))
+
+	for _, part := range parts {
+
+		p, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if (err != nil) || (p <= 0) || (p > 100) {
+			return nil, fmt.Errorf("invalid percentile '%s'", part)
+		}
+
+		percentiles = append(percentiles, p)
+	}
+
+	return percentiles, nil
+}
+
+// Usage prints out how to use this script and exits.
+func Usage() {
+
+	fmt.Printf("Please specify a base and a current result set to compare.\nFor example:\n")
+	fmt.Printf("\t$ ./compare-results -base results/append-2017-01-01-10-00-00.manifest.json -current results/append-2017-02-01-10-00-00.manifest.json\n")
+	fmt.Printf("\t$ ./compare-results -base results/pluto-append-2017-01-01-10-00-00.jsonl -current results/pluto-append-2017-02-01-10-00-00.jsonl -threshold 0.05\n")
+
+	os.Exit(1)
+}
+
+func main() {
+
+	// Require a base and a current result set.
+	baseFlag := flag.String("base", "", "Supply base result set: results file, run manifest or legacy log file or folder.")
+	currentFlag := flag.String("current", "", "Supply current result set to compare against base.")
+	baseTargetFlag := flag.String("baseTarget", "", "Only consider records of this target in base result set, e.g. pluto.")
+	currentTargetFlag := flag.String("currentTarget", "", "Only consider records of this target in current result set, e.g. pluto.")
+	percentilesFlag := flag.String("percentiles", "50,90,99", "Specify comma-separated percentiles to compare.")
+	thresholdFlag := flag.Float64("threshold", 0.10, "Specify relative percentile increase regarded as regression, e.g. 0.10 for 10%.")
+	alphaFlag := flag.Float64("alpha", 0.05, "Specify significance level of Mann-Whitney U test a regression also needs to pass.")
+	iterationsFlag := flag.Int("bootstrap", 1000, "Specify number of bootstrap iterations for confidence intervals.")
+	confidenceFlag := flag.Float64("confidence", 0.95, "Specify level of bootstrapped confidence intervals.")
+	seedFlag := flag.Int64("seed", 1, "Specify seed of bootstrap resampling for reproducible intervals.")
+	warmupFlag := flag.String("warmup", "", "Exclude warm-up from comparison: first number of commands of each connection, e.g. 50, or first duration of each run, e.g. 5s.")
+	flag.Parse()
+
+	if (*baseFlag == "") || (*currentFlag == "") {
+		Usage()
+	}
+
+	// Targets can only be left out of the group key
+	// if both sets are restricted to one target.
+	if (*baseTargetFlag == "") != (*currentTargetFlag == "") {
+		fmt.Printf("Please specify either both or none of -baseTarget and -currentTarget.\n")
+		os.Exit(1)
+	}
+
+	percentiles, err := ParsePercentiles(*percentilesFlag)
+	if err != nil {
+		fmt.Printf("Failed to parse percentiles: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	warmup, err := records.ParseWarmup(*warmupFlag)
+	if err != nil {
+		fmt.Printf("Invalid warm-up: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	baseGroups, err := LoadGroups(*baseFlag, *baseTargetFlag, warmup)
+	if err != nil {
+		fmt.Printf("Failed to load base result set: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	currentGroups, err := LoadGroups(*currentFlag, *currentTargetFlag, warmup)
+	if err != nil {
+		fmt.Printf("Failed to load current result set: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	// Compare groups in stable order.
+	keys := make([]string, 0, len(baseGroups))
+	for key := range baseGroups {
+
+		if _, found := currentGroups[key]; found {
+			keys = append(keys, key)
+		} else {
+			fmt.Printf("%s: only present in base result set, skipping.\n", key)
+		}
+	}
+	sort.Strings(keys)
+
+	for key := range currentGroups {
+
+		if _, found := baseGroups[key]; found != true {
+			fmt.Printf("%s: only present in current result set, skipping.\n", key)
+		}
+	}
+
+	if len(keys) == 0 {
+		fmt.Printf("Result sets have no operation in common.\n")
+		os.Exit(1)
+	}
+
+	rng := rand.New(rand.NewSource(*seedFlag))
+	regressions := 0
+
+	for _, key := range keys {
+
+		base := baseGroups[key]
+		current := currentGroups[key]
+
+		if (len(base.Latencies) == 0) || (len(current.Latencies) == 0) {
+			fmt.Printf("\n%s: no successful commands to compare, skipping.\n", key)
+			continue
+		}
+
+		_, z, p := stats.MannWhitneyU(base.Latencies, current.Latencies)
+
+		fmt.Printf("\n%s: n %d vs. %d, errors %d vs. %d, Mann-Whitney U z = %.3f, p = %.4f\n",
+			key, len(base.Latencies), len(current.Latencies), base.Errors, current.Errors, z, p)
+
+		for _, percentile := range percentiles {
+
+			d := stats.BootstrapDelta(base.Latencies, current.Latencies, percentile, *iterationsFlag, *confidenceFlag, rng)
+
+			// Flag a regression only if even the lower end
+			// of the confidence interval exceeds threshold
+			// and the distributions differ significantly.
+			verdict := ""
+			if (d.Lower > *thresholdFlag) && (p < *alphaFlag) {
+				verdict = "  REGRESSION"
+				regressions++
+			}
+
+			fmt.Printf("\tp%g: %.3f ms -> %.3f ms (%+.1f%%, %g%% CI [%+.1f%%, %+.1f%%])%s\n",
+				percentile, d.Base, d.Current, (d.Relative * 100.0), (*confidenceFlag * 100.0), (d.Lower * 100.0), (d.Upper * 100.0), verdict)
+		}
+	}
+
+	if regressions > 0 {
+		fmt.Printf("\nFound %d regressions above threshold of %.1f%%.\n", regressions, (*thresholdFlag * 100.0))
+		os.Exit(2)
+	}
+
+	fmt.Printf("\nNo regressions above threshold of %.1f%%.\n", (*thresholdFlag * 100.0))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/BurntSushi/toml"
+	"github.com/numbleroot/pluto-evaluation/config"
+)
+
+// Structs
+
+// Check names one test and the settings it
+// requires on one system.
+type Check struct {
+	Test   string
+	System string
+	Needs  string
+}
+
+// Variables
+
+// Checks lists the requirements of all tests.
+var Checks = []Check{
+	{"test-append", "Pluto", "AppendTest"},
+	{"test-append", "Dovecot", "AppendTest"},
+	{"test-create", "Pluto", "CreateTest"},
+	{"test-create", "Dovecot", "CreateTest"},
+	{"test-delete", "Pluto", "DeleteTest"},
+	{"test-delete", "Dovecot", "DeleteTest"},
+	{"test-store", "Pluto", "StoreTest"},
+	{"test-store", "Dovecot", "StoreTest"},
+	{"test-*-concurrent", "Pluto", "ConcurrentTest"},
+	{"test-*-concurrent", "Dovecot", "ConcurrentTest"},
+	{"test-conflict", "Pluto", "ConflictTest"},
+	{"test-conflict", "Dovecot", "ConflictTest"},
+	{"test-append-gmail", "Gmail", "AppendTest"},
+	{"test-create-gmail", "Gmail", "CreateTest"},
+	{"test-delete-gmail", "Gmail", "DeleteTest"},
+	{"test-store-gmail", "Gmail", "StoreTest"},
+}
+
+// Functions
+
+func main() {
+
+	configSource := config.Flags()
+	flag.Parse()
+
+	// Loading validates the config as a whole.
+	conf, err := config.Load(configSource)
+	if err != nil {
+		fmt.Printf("Error loading config: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("# Config %s is valid. Resolved settings, with defaults applied and passwords masked:\n\n", configSource)
+
+	// Print resolved config as TOML.
+	err = toml.NewEncoder(os.Stdout).Encode(conf.Masked())
+	if err != nil {
+		fmt.Printf("Failed to print config: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	// Report which tests can run on which system.
+	fmt.Printf("\n# Tests:\n")
+
+	for _, check := range Checks {
+
+		err := conf.Require(check.System, check.Needs)
+		if err != nil {
+			fmt.Printf("#   %-18s on %-8s %s\n", check.Test, check.System, err.Error())
+			continue
+		}
+
+		fmt.Printf("#   %-18s on %-8s ready\n", check.Test, check.System)
+	}
+}
@@ -2,10 +2,15 @@ package config
 
 import (
 	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
 	"path/filepath"
-
-	"github.com/BurntSushi/toml"
 )
 
 // Structs
@@ -16,6 +21,11 @@ type Config struct {
 	Pluto   Pluto
 	Dovecot Dovecot
 	Gmail   Gmail
+
+	// Secrets obtained by commands so far, by
+	// command, and the directory they run in.
+	baseDir string
+	secrets map[string]string
 }
 
 // Pluto defines the relevant information in
@@ -24,13 +34,18 @@ type Pluto struct {
 	IP             string
 	Port           string
 	TLS            bool
+	StartTLS       bool
+	Auth           string
 	RootCertLoc    string
 	Distributor    Distributor
+	Verify         Verify
+	TLSParams      TLSParams
 	AppendTest     User
 	CreateTest     User
 	DeleteTest     User
 	StoreTest      User
 	ConcurrentTest ConcurrentTest
+	ConflictTest   ConflictTest
 }
 
 // Dovecot contains IP and port of the comparison
@@ -39,12 +54,17 @@ type Dovecot struct {
 	IP             string
 	Port           string
 	TLS            bool
+	StartTLS       bool
+	Auth           string
 	CertLoc        string
+	Verify         Verify
+	TLSParams      TLSParams
 	AppendTest     User
 	CreateTest     User
 	DeleteTest     User
 	StoreTest      User
 	ConcurrentTest ConcurrentTest
+	ConflictTest   ConflictTest
 }
 
 // Gmail bundles information needed to perform
@@ -53,6 +73,11 @@ type Gmail struct {
 	Server     string
 	Port       string
 	TLS        bool
+	StartTLS   bool
+	Auth       string
+	OAuth      OAuth
+	Verify     Verify
+	TLSParams  TLSParams
 	AppendTest User
 	CreateTest User
 	DeleteTest User
@@ -66,33 +91,258 @@ type Distributor struct {
 	KeyLoc  string
 }
 
+// Verify describes how the certificate presented
+// by a system is checked. By default, it needs to
+// chain up to the system's root certificates or the
+// ones in CABundle and match ServerName, or the host
+// connected to if empty. In addition, it may be
+// pinned to the certificate in PEM file PinCert or to
+// PinSPKI, the base64-encoded SHA-256 hash of its
+// public key (SubjectPublicKeyInfo). Insecure skips
+// checking the chain and name, pins are still
+// enforced.
+type Verify struct {
+	CABundle   string
+	PinCert    string
+	PinSPKI    string
+	ServerName string
+	Insecure   bool
+}
+
+// TLSParams restricts what the test client offers
+// in TLS handshakes with a system. Versions are given
+// as '1.0' to '1.3', cipher suites and curves by their
+// names in Go's crypto/tls, e.g. 'X25519' or 'P256'.
+// Cipher suites only apply up to TLS 1.2. Unless
+// SessionCache is zero, the client keeps up to this
+// many session tickets to resume sessions with.
+type TLSParams struct {
+	MinVersion   string
+	MaxVersion   string
+	CipherSuites []string
+	Curves       []string
+	SessionCache int
+}
+
+// OAuth describes how access tokens for XOAUTH2
+// and OAUTHBEARER are obtained: by redeeming
+// RefreshToken with the client credentials at
+// TokenURL. ClientSecret and RefreshToken may name
+// where to obtain them from like passwords.
+type OAuth struct {
+	ClientID     string
+	ClientSecret string
+	RefreshToken string
+	TokenURL     string
+}
+
 // User carries authentication information for a test
-// user in system to be tested.
+// user in system to be tested. Instead of the password
+// itself, Password may name where to obtain it from:
+// 'env:VAR', 'file:/path' or 'command:program args'.
 type User struct {
 	Name     string
 	Password string
 }
 
 // ConcurrentTest contains a slice of users to test
-// concurrent access for.
+// concurrent access for. Further Users users are
+// generated by formatting the numbers First to
+// First + Users - 1 into NamePattern and
+// PasswordPattern, e.g. 'user%03d'.
 type ConcurrentTest struct {
-	User []User
+	Users           int
+	First           int
+	NamePattern     string
+	PasswordPattern string
+	User            []User
 }
 
+// ConflictTest defines one user whose mailboxes are
+// accessed by multiple sessions at the same time in
+// order to provoke conflicting updates.
+type ConflictTest struct {
+	Sessions int
+	User     User
+}
+
+// Constants
+
+// Modes in which connections to a system are made:
+// TLS from the start, plain TCP upgraded to TLS via
+// STARTTLS, or plain TCP only.
+const (
+	ModeTLS      = "tls"
+	ModeSTARTTLS = "starttls"
+	ModePlain    = "plain"
+)
+
+// Mechanisms with which test users authenticate:
+// the LOGIN command or one of the SASL mechanisms
+// via AUTHENTICATE. XOAUTH2 and OAUTHBEARER take an
+// OAuth 2.0 access token as password.
+const (
+	AuthLogin       = "LOGIN"
+	AuthPlain       = "PLAIN"
+	AuthCRAMMD5     = "CRAM-MD5"
+	AuthSCRAMSHA256 = "SCRAM-SHA-256"
+	AuthXOAUTH2     = "XOAUTH2"
+	AuthOAuthBearer = "OAUTHBEARER"
+)
+
+// Variables
+
+// Defaults are applied to settings left out of a
+// config file. TLS is enabled unless set to false
+// and users log in via LOGIN, or via XOAUTH2 on Gmail
+// if a refresh token is configured.
+// Without TLS from the start, i.e. for STARTTLS and
+// plain connections, the port defaults to 143.
+var (
+	DefaultPort            = "993"
+	DefaultPlainPort       = "143"
+	DefaultGmailServer     = "imap.gmail.com"
+	DefaultConflictSession = 4
+	DefaultFirstUser       = 1
+	DefaultAuth            = AuthLogin
+	DefaultTokenURL        = "https://oauth2.googleapis.com/token"
+)
+
+// AuthMechanisms lists all supported mechanisms.
+var AuthMechanisms = []string{AuthLogin, AuthPlain, AuthCRAMMD5, AuthSCRAMSHA256, AuthXOAUTH2, AuthOAuthBearer}
+
+// DefaultFile is loaded if no config file is named.
+var DefaultFile = "test-config.toml"
+
+// Mask replaces secrets in the output of Masked.
+var Mask = "********"
+
 // Functions
 
+// connMode derives the connection mode from the
+// TLS and StartTLS settings of a system.
+func connMode(tls bool, startTLS bool) string {
+
+	if tls != true {
+		return ModePlain
+	}
+
+	if startTLS {
+		return ModeSTARTTLS
+	}
+
+	return ModeTLS
+}
+
+// defaultPort returns the port a system in mode
+// listens on by default.
+func defaultPort(mode string) string {
+
+	if mode == ModeTLS {
+		return DefaultPort
+	}
+
+	return DefaultPlainPort
+}
+
+// Mode returns how connections to pluto are made.
+func (p Pluto) Mode() string {
+	return connMode(p.TLS, p.StartTLS)
+}
+
+// Mode returns how connections to Dovecot are made.
+func (d Dovecot) Mode() string {
+	return connMode(d.TLS, d.StartTLS)
+}
+
+// Mode returns how connections to Gmail are made.
+func (g Gmail) Mode() string {
+	return connMode(g.TLS, g.StartTLS)
+}
+
+// UsesOAuth reports whether Gmail users log in with
+// access tokens obtained via a refresh token instead
+// of their passwords.
+func (g Gmail) UsesOAuth() bool {
+	return g.OAuth.RefreshToken != ""
+}
+
+// IsAuthMechanism reports whether mechanism is
+// one of the supported ones.
+func IsAuthMechanism(mechanism string) bool {
+
+	for _, m := range AuthMechanisms {
+
+		if m == mechanism {
+			return true
+		}
+	}
+
+	return false
+}
+
 // LoadConfig takes in the path to the test config
 // file of pluto and Dovecot system in TOML syntax
 // and fills above structs.
 func LoadConfig(configFile string) (*Config, error) {
+	return Load(&Source{Files: []string{configFile}})
+}
+
+// Load reads the config files of source in order,
+// each one overriding values of the ones before,
+// applies the selected profile of each file right
+// after it and finally the command-line overrides.
+// Unknown keys and invalid values are reported all
+// at once, settings left out are filled with above
+// defaults.
+func Load(source *Source) (*Config, error) {
 
 	conf := new(Config)
 
-	// Parse values from TOML file into struct.
-	if _, err := toml.DecodeFile(configFile, conf); err != nil {
-		return nil, fmt.Errorf("failed to read in TOML config file at '%s' with: %s\n", configFile, err.Error())
+	files := source.Files
+	if len(files) == 0 {
+		files = []string{DefaultFile}
+	}
+
+	definitions := make([]func(keys ...string) bool, 0, (len(files) + 1))
+	profileFound := false
+
+	for _, configFile := range files {
+
+		defined, found, err := decodeFile(configFile, source.Profile, conf)
+		if err != nil {
+			return nil, err
+		}
+
+		definitions = append(definitions, defined)
+		profileFound = (profileFound) || (found)
+	}
+
+	if (source.Profile != "") && (profileFound != true) {
+		return nil, fmt.Errorf("profile '%s' is not defined in any of the config files %s", source.Profile, strings.Join(files, ", "))
+	}
+
+	// Apply overrides from the command line last.
+	defined, err := conf.override(source.Overrides)
+	if err != nil {
+		return nil, err
 	}
 
+	definitions = append(definitions, defined)
+
+	// Fill in settings that were left out.
+	applyDefaults(conf, func(keys ...string) bool {
+
+		for _, defined := range definitions {
+
+			if defined(keys...) {
+				return true
+			}
+		}
+
+		return false
+	})
+
 	// Retrieve absolute path of pluto-evaluation directory.
 	absEvalPath, err := filepath.Abs("./")
 	if err != nil {
@@ -101,21 +351,598 @@ func LoadConfig(configFile string) (*Config, error) {
 
 	// Prefix each relative path in config with just
 	// obtained absolute path to pluto-evaluation directory.
+	// Paths left out stay empty so that they are
+	// reported as missing.
+	for _, path := range []*string{
+		&conf.Pluto.RootCertLoc,
+		&conf.Pluto.Distributor.CertLoc,
+		&conf.Pluto.Distributor.KeyLoc,
+		&conf.Dovecot.CertLoc,
+		&conf.Pluto.Verify.CABundle,
+		&conf.Pluto.Verify.PinCert,
+		&conf.Dovecot.Verify.CABundle,
+		&conf.Dovecot.Verify.PinCert,
+		&conf.Gmail.Verify.CABundle,
+		&conf.Gmail.Verify.PinCert,
+	} {
 
-	// Pluto.RootCertLoc
-	if filepath.IsAbs(conf.Pluto.RootCertLoc) != true {
-		conf.Pluto.RootCertLoc = filepath.Join(absEvalPath, conf.Pluto.RootCertLoc)
+		if (*path != "") && (filepath.IsAbs(*path) != true) {
+			*path = filepath.Join(absEvalPath, *path)
+		}
 	}
 
-	// Pluto.Distributor.CertLoc
-	if filepath.IsAbs(conf.Pluto.Distributor.CertLoc) != true {
-		conf.Pluto.Distributor.CertLoc = filepath.Join(absEvalPath, conf.Pluto.Distributor.CertLoc)
+	// Generate users from patterns and obtain all
+	// passwords from where they are stored. Commands
+	// may be slow or ask for input, they are only run
+	// for the users a test requires.
+	conf.baseDir = absEvalPath
+	problems := conf.generateUsers()
+
+	for name, user := range conf.users() {
+
+		if isCommand(user.Password) {
+			continue
+		}
+
+		err := conf.resolveSecret(&user.Password)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s.Password: %s", name, err.Error()))
+		}
 	}
 
-	// Pluto.Distributor.KeyLoc
-	if filepath.IsAbs(conf.Pluto.Distributor.KeyLoc) != true {
-		conf.Pluto.Distributor.KeyLoc = filepath.Join(absEvalPath, conf.Pluto.Distributor.KeyLoc)
+	// OAuth client credentials are secrets as well.
+	for name, secret := range map[string]*string{
+		"Gmail.OAuth.ClientSecret": &conf.Gmail.OAuth.ClientSecret,
+		"Gmail.OAuth.RefreshToken": &conf.Gmail.OAuth.RefreshToken,
+	} {
+
+		if isCommand(*secret) {
+			continue
+		}
+
+		err := conf.resolveSecret(secret)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, err.Error()))
+		}
+	}
+
+	// Check values that are present for consistency.
+	problems = append(problems, conf.validate()...)
+	if len(problems) > 0 {
+
+		sort.Strings(problems)
+
+		return nil, fmt.Errorf("invalid config %s:\n\t- %s", source, strings.Join(problems, "\n\t- "))
 	}
 
 	return conf, nil
 }
+
+// applyDefaults sets all settings not defined
+// in any config file or override to their defaults.
+func applyDefaults(conf *Config, isDefined func(keys ...string) bool) {
+
+	// A left out boolean cannot be told apart from
+	// false without looking at the file's keys.
+	if isDefined("Pluto", "TLS") != true {
+		conf.Pluto.TLS = true
+	}
+
+	if isDefined("Dovecot", "TLS") != true {
+		conf.Dovecot.TLS = true
+	}
+
+	if isDefined("Gmail", "TLS") != true {
+		conf.Gmail.TLS = true
+	}
+
+	// Ports depend on whether TLS is used from
+	// the start.
+	if conf.Pluto.Port == "" {
+		conf.Pluto.Port = defaultPort(conf.Pluto.Mode())
+	}
+
+	if conf.Dovecot.Port == "" {
+		conf.Dovecot.Port = defaultPort(conf.Dovecot.Mode())
+	}
+
+	if conf.Gmail.Port == "" {
+		conf.Gmail.Port = defaultPort(conf.Gmail.Mode())
+	}
+
+	if conf.Gmail.Server == "" {
+		conf.Gmail.Server = DefaultGmailServer
+	}
+
+	// Gmail accounts with a refresh token log in
+	// via XOAUTH2 unless told otherwise.
+	if (strings.TrimSpace(conf.Gmail.Auth) == "") && (conf.Gmail.UsesOAuth()) {
+		conf.Gmail.Auth = AuthXOAUTH2
+	}
+
+	if conf.Gmail.OAuth.TokenURL == "" {
+		conf.Gmail.OAuth.TokenURL = DefaultTokenURL
+	}
+
+	// Mechanisms are matched ignoring case.
+	for _, auth := range []*string{&conf.Pluto.Auth, &conf.Dovecot.Auth, &conf.Gmail.Auth} {
+
+		*auth = strings.ToUpper(strings.TrimSpace(*auth))
+		if *auth == "" {
+			*auth = DefaultAuth
+		}
+	}
+
+	// Number of conflicting sessions.
+	if isDefined("Pluto", "ConflictTest", "Sessions") != true {
+		conf.Pluto.ConflictTest.Sessions = DefaultConflictSession
+	}
+
+	if isDefined("Dovecot", "ConflictTest", "Sessions") != true {
+		conf.Dovecot.ConflictTest.Sessions = DefaultConflictSession
+	}
+
+	// Numbering of generated users.
+	if isDefined("Pluto", "ConcurrentTest", "First") != true {
+		conf.Pluto.ConcurrentTest.First = DefaultFirstUser
+	}
+
+	if isDefined("Dovecot", "ConcurrentTest", "First") != true {
+		conf.Dovecot.ConcurrentTest.First = DefaultFirstUser
+	}
+}
+
+// generateUsers appends the users described by
+// the patterns of both concurrent tests to their
+// list of users. It returns a description of each
+// unusable pattern.
+func (c *Config) generateUsers() []string {
+
+	problems := make([]string, 0)
+
+	for name, test := range map[string]*ConcurrentTest{
+		"Pluto.ConcurrentTest":   &c.Pluto.ConcurrentTest,
+		"Dovecot.ConcurrentTest": &c.Dovecot.ConcurrentTest,
+	} {
+
+		if test.Users == 0 {
+			continue
+		}
+
+		if test.Users < 0 {
+			problems = append(problems, fmt.Sprintf("%s.Users: cannot generate %d users", name, test.Users))
+			continue
+		}
+
+		// Each pattern needs to take the number and
+		// yield different values for different users.
+		ok := true
+
+		for key, pattern := range map[string]string{
+			"NamePattern":     test.NamePattern,
+			"PasswordPattern": test.PasswordPattern,
+		} {
+
+			first := fmt.Sprintf(pattern, 1)
+			if (pattern == "") || strings.Contains(first, "%!") || (first == fmt.Sprintf(pattern, 2)) {
+				problems = append(problems, fmt.Sprintf("%s.%s: '%s' needs to contain one number verb, e.g. 'user%%03d'", name, key, pattern))
+				ok = false
+			}
+		}
+
+		if ok != true {
+			continue
+		}
+
+		for num := test.First; num < (test.First + test.Users); num++ {
+			test.User = append(test.User, User{
+				Name:     fmt.Sprintf(test.NamePattern, num),
+				Password: fmt.Sprintf(test.PasswordPattern, num),
+			})
+		}
+	}
+
+	return problems
+}
+
+// validate returns a description of each value
+// present in the config that is invalid on its own
+// or does not match related values.
+func (c *Config) validate() []string {
+
+	problems := make([]string, 0)
+
+	// Ports need to be valid TCP ports.
+	for name, port := range map[string]string{
+		"Pluto.Port":   c.Pluto.Port,
+		"Dovecot.Port": c.Dovecot.Port,
+		"Gmail.Port":   c.Gmail.Port,
+	} {
+
+		num, err := strconv.Atoi(port)
+		if (err != nil) || (num < 1) || (num > 65535) {
+			problems = append(problems, fmt.Sprintf("%s: '%s' is not a valid port", name, port))
+		}
+	}
+
+	// SPKI pins need to be SHA-256 hashes.
+	for name, pin := range map[string]string{
+		"Pluto.Verify.PinSPKI":   c.Pluto.Verify.PinSPKI,
+		"Dovecot.Verify.PinSPKI": c.Dovecot.Verify.PinSPKI,
+		"Gmail.Verify.PinSPKI":   c.Gmail.Verify.PinSPKI,
+	} {
+
+		if pin == "" {
+			continue
+		}
+
+		hash, err := base64.StdEncoding.DecodeString(pin)
+		if (err != nil) || (len(hash) != sha256.Size) {
+			problems = append(problems, fmt.Sprintf("%s: '%s' is not a base64-encoded SHA-256 hash", name, pin))
+		}
+	}
+
+	// STARTTLS upgrades connections to TLS.
+	for name, system := range map[string][2]bool{
+		"Pluto":   {c.Pluto.TLS, c.Pluto.StartTLS},
+		"Dovecot": {c.Dovecot.TLS, c.Dovecot.StartTLS},
+		"Gmail":   {c.Gmail.TLS, c.Gmail.StartTLS},
+	} {
+
+		if (system[0] != true) && (system[1]) {
+			problems = append(problems, fmt.Sprintf("%s.StartTLS: needs TLS = true", name))
+		}
+	}
+
+	// Authentication mechanisms need to be supported.
+	for name, auth := range map[string]string{
+		"Pluto.Auth":   c.Pluto.Auth,
+		"Dovecot.Auth": c.Dovecot.Auth,
+		"Gmail.Auth":   c.Gmail.Auth,
+	} {
+
+		if IsAuthMechanism(auth) != true {
+			problems = append(problems, fmt.Sprintf("%s: unknown mechanism '%s', choose one of %s", name, auth, strings.Join(AuthMechanisms, ", ")))
+		}
+	}
+
+	// Session caches cannot hold a negative
+	// number of tickets.
+	for name, size := range map[string]int{
+		"Pluto.TLSParams.SessionCache":   c.Pluto.TLSParams.SessionCache,
+		"Dovecot.TLSParams.SessionCache": c.Dovecot.TLSParams.SessionCache,
+		"Gmail.TLSParams.SessionCache":   c.Gmail.TLSParams.SessionCache,
+	} {
+
+		if size < 0 {
+			problems = append(problems, fmt.Sprintf("%s: cannot hold %d tickets", name, size))
+		}
+	}
+
+	// Users that are present need a name and,
+	// unless logging in with access tokens, a
+	// password.
+	for name, user := range c.users() {
+
+		if (user.Name == "") && (user.Password == "") {
+			continue
+		}
+
+		if user.Name == "" {
+			problems = append(problems, fmt.Sprintf("%s: Name is missing", name))
+		}
+
+		if (user.Password == "") && (c.needsPassword(name)) {
+			problems = append(problems, fmt.Sprintf("%s: Password is missing", name))
+		}
+	}
+
+	// Access tokens can only be obtained with the
+	// client they were issued to and are only used
+	// by token-based mechanisms.
+	if c.Gmail.UsesOAuth() {
+
+		if c.Gmail.OAuth.ClientID == "" {
+			problems = append(problems, "Gmail.OAuth.ClientID: is missing")
+		}
+
+		if (c.Gmail.Auth != AuthXOAUTH2) && (c.Gmail.Auth != AuthOAuthBearer) {
+			problems = append(problems, fmt.Sprintf("Gmail.OAuth: needs Auth = \"%s\" or \"%s\", got '%s'", AuthXOAUTH2, AuthOAuthBearer, c.Gmail.Auth))
+		}
+
+		tokenURL, err := url.Parse(c.Gmail.OAuth.TokenURL)
+		if (err != nil) || ((tokenURL.Scheme != "https") && (tokenURL.Scheme != "http")) || (tokenURL.Host == "") {
+			problems = append(problems, fmt.Sprintf("Gmail.OAuth.TokenURL: '%s' is not an HTTP(S) URL", c.Gmail.OAuth.TokenURL))
+		}
+	}
+
+	// Conflicts need at least one adding and one
+	// removing session per system.
+	if c.Pluto.ConflictTest.Sessions < 2 {
+		problems = append(problems, fmt.Sprintf("Pluto.ConflictTest.Sessions: need at least 2 sessions, got %d", c.Pluto.ConflictTest.Sessions))
+	}
+
+	if c.Dovecot.ConflictTest.Sessions < 2 {
+		problems = append(problems, fmt.Sprintf("Dovecot.ConflictTest.Sessions: need at least 2 sessions, got %d", c.Dovecot.ConflictTest.Sessions))
+	}
+
+	return problems
+}
+
+// needsPassword reports whether the user of the
+// named setting needs a password, which Gmail users
+// do not if access tokens are obtained for them.
+func (c *Config) needsPassword(name string) bool {
+	return (strings.HasPrefix(name, "Gmail.") != true) || (c.Gmail.UsesOAuth() != true)
+}
+
+// users returns all configured users by the
+// name of their setting.
+func (c *Config) users() map[string]*User {
+
+	users := map[string]*User{
+		"Pluto.AppendTest":          &c.Pluto.AppendTest,
+		"Pluto.CreateTest":          &c.Pluto.CreateTest,
+		"Pluto.DeleteTest":          &c.Pluto.DeleteTest,
+		"Pluto.StoreTest":           &c.Pluto.StoreTest,
+		"Pluto.ConflictTest.User":   &c.Pluto.ConflictTest.User,
+		"Dovecot.AppendTest":        &c.Dovecot.AppendTest,
+		"Dovecot.CreateTest":        &c.Dovecot.CreateTest,
+		"Dovecot.DeleteTest":        &c.Dovecot.DeleteTest,
+		"Dovecot.StoreTest":         &c.Dovecot.StoreTest,
+		"Dovecot.ConflictTest.User": &c.Dovecot.ConflictTest.User,
+		"Gmail.AppendTest":          &c.Gmail.AppendTest,
+		"Gmail.CreateTest":          &c.Gmail.CreateTest,
+		"Gmail.DeleteTest":          &c.Gmail.DeleteTest,
+		"Gmail.StoreTest":           &c.Gmail.StoreTest,
+	}
+
+	for i := range c.Pluto.ConcurrentTest.User {
+		users[fmt.Sprintf("Pluto.ConcurrentTest.User[%d]", i)] = &c.Pluto.ConcurrentTest.User[i]
+	}
+
+	for i := range c.Dovecot.ConcurrentTest.User {
+		users[fmt.Sprintf("Dovecot.ConcurrentTest.User[%d]", i)] = &c.Dovecot.ConcurrentTest.User[i]
+	}
+
+	return users
+}
+
+// Require checks that everything a test needs to
+// reach system, one of Pluto, Dovecot or Gmail, is
+// configured, as well as the users of the listed
+// tests, e.g. 'AppendTest' or 'ConcurrentTest'. All
+// missing settings are reported at once. Users of
+// concurrent tests need to pair up between pluto and
+// Dovecot. Secrets left to commands by Load are
+// obtained here, only for the required users.
+func (c *Config) Require(system string, tests ...string) error {
+
+	section := reflect.ValueOf(c).Elem().FieldByName(system)
+	if section.IsValid() != true {
+		return fmt.Errorf("unknown system '%s' in config", system)
+	}
+
+	missing := make([]string, 0)
+
+	// Settings needed to connect to system.
+	switch system {
+	case "Pluto":
+
+		if c.Pluto.IP == "" {
+			missing = append(missing, "Pluto.IP")
+		}
+
+		// Certificates are only needed for TLS.
+		if (c.Pluto.TLS) && (c.Pluto.Distributor.CertLoc == "") {
+			missing = append(missing, "Pluto.Distributor.CertLoc")
+		}
+
+		if (c.Pluto.TLS) && (c.Pluto.Distributor.KeyLoc == "") {
+			missing = append(missing, "Pluto.Distributor.KeyLoc")
+		}
+
+	case "Dovecot":
+
+		if c.Dovecot.IP == "" {
+			missing = append(missing, "Dovecot.IP")
+		}
+
+	case "Gmail":
+
+		// Access tokens are obtained with the client
+		// credentials, which may need to run commands.
+		for name, secret := range map[string]*string{
+			"Gmail.OAuth.ClientSecret": &c.Gmail.OAuth.ClientSecret,
+			"Gmail.OAuth.RefreshToken": &c.Gmail.OAuth.RefreshToken,
+		} {
+
+			if isCommand(*secret) != true {
+				continue
+			}
+
+			err := c.resolveSecret(secret)
+			if err != nil {
+				return fmt.Errorf("%s: %s", name, err.Error())
+			}
+		}
+	}
+
+	// Users of each requested test.
+	for _, test := range tests {
+
+		name := fmt.Sprintf("%s.%s", system, test)
+
+		field := section.FieldByName(test)
+		if field.IsValid() != true {
+			return fmt.Errorf("unknown test '%s' in config", name)
+		}
+
+		// Obtain passwords left to commands.
+		users := make([]*User, 0)
+
+		switch value := field.Addr().Interface().(type) {
+
+		case *User:
+			users = append(users, value)
+
+		case *ConcurrentTest:
+			for i := range value.User {
+				users = append(users, &value.User[i])
+			}
+
+		case *ConflictTest:
+			users = append(users, &value.User)
+		}
+
+		for _, user := range users {
+
+			if isCommand(user.Password) != true {
+				continue
+			}
+
+			err := c.resolveSecret(&user.Password)
+			if err != nil {
+				return fmt.Errorf("%s: password of '%s': %s", name, user.Name, err.Error())
+			}
+		}
+
+		switch value := field.Interface().(type) {
+
+		case User:
+
+			if value.Name == "" {
+				missing = append(missing, fmt.Sprintf("%s.Name", name))
+			}
+
+			if (value.Password == "") && (c.needsPassword(name)) {
+				missing = append(missing, fmt.Sprintf("%s.Password", name))
+			}
+
+		case ConcurrentTest:
+
+			if len(value.User) == 0 {
+				missing = append(missing, fmt.Sprintf("%s.User", name))
+				continue
+			}
+
+			// Concurrent tests always run on pluto and
+			// Dovecot and pair up their users one by
+			// one. A system without users is reported
+			// when it is required itself.
+			numPluto := len(c.Pluto.ConcurrentTest.User)
+			numDovecot := len(c.Dovecot.ConcurrentTest.User)
+
+			if (numPluto > 0) && (numDovecot > 0) && (numPluto != numDovecot) {
+				return fmt.Errorf("ConcurrentTest: pluto has %d users but Dovecot has %d, configure an equal number", numPluto, numDovecot)
+			}
+
+		case ConflictTest:
+
+			if value.User.Name == "" {
+				missing = append(missing, fmt.Sprintf("%s.User.Name", name))
+			}
+
+			if value.User.Password == "" {
+				missing = append(missing, fmt.Sprintf("%s.User.Password", name))
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required settings: %s", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// isCommand reports whether value names a command
+// to obtain a secret from.
+func isCommand(value string) bool {
+	return strings.HasPrefix(value, "command:")
+}
+
+// resolveSecret replaces the reference to a secret
+// in value by the secret. Output of each distinct
+// command is kept, so that it runs once even if users
+// share it or several tests are checked.
+func (c *Config) resolveSecret(value *string) error {
+
+	if IsSecretReference(*value) != true {
+		return nil
+	}
+
+	secret, found := c.secrets[*value]
+	if found != true {
+
+		var err error
+
+		secret, err = ResolveSecret(*value, c.baseDir)
+		if err != nil {
+			return err
+		}
+
+		if isCommand(*value) {
+
+			if c.secrets == nil {
+				c.secrets = make(map[string]string)
+			}
+
+			c.secrets[*value] = secret
+		}
+	}
+
+	*value = secret
+
+	return nil
+}
+
+// Masked returns a copy of the config with all
+// passwords replaced by Mask, fit for printing.
+func (c *Config) Masked() *Config {
+
+	masked := *c
+
+	// Copy users of concurrent tests before masking
+	// them so that the original config is kept.
+	for _, users := range []*[]User{
+		&masked.Pluto.ConcurrentTest.User,
+		&masked.Dovecot.ConcurrentTest.User,
+	} {
+
+		copied := make([]User, len(*users))
+		copy(copied, *users)
+		*users = copied
+	}
+
+	// Password patterns reveal all generated
+	// passwords, references to secrets do not.
+	for _, test := range []*ConcurrentTest{
+		&masked.Pluto.ConcurrentTest,
+		&masked.Dovecot.ConcurrentTest,
+	} {
+
+		if (test.PasswordPattern != "") && (IsSecretReference(test.PasswordPattern) != true) {
+			test.PasswordPattern = Mask
+		}
+	}
+
+	for _, user := range masked.users() {
+
+		if user.Password != "" {
+			user.Password = Mask
+		}
+	}
+
+	for _, secret := range []*string{
+		&masked.Gmail.OAuth.ClientSecret,
+		&masked.Gmail.OAuth.RefreshToken,
+	} {
+
+		if *secret != "" {
+			*secret = Mask
+		}
+	}
+
+	return &masked
+}
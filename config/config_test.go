@@ -0,0 +1,360 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Functions
+
+// TestLoadDefinedKeys checks that settings whose
+// left out value differs from their zero value are
+// only defaulted if no file, profile or override
+// defines them, whatever the case of their keys.
+func TestLoadDefinedKeys(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		files     []string
+		profile   string
+		overrides []string
+		tls       bool
+		port      string
+		sessions  int
+		first     int
+	}{
+		{
+			name:     "defaults",
+			files:    []string{""},
+			tls:      true,
+			port:     DefaultPort,
+			sessions: DefaultConflictSession,
+			first:    DefaultFirstUser,
+		},
+		{
+			name:     "canonical keys",
+			files:    []string{"[Pluto]\nTLS = false\n[Pluto.ConflictTest]\nSessions = 3\n[Pluto.ConcurrentTest]\nFirst = 0\n"},
+			tls:      false,
+			port:     DefaultPlainPort,
+			sessions: 3,
+			first:    0,
+		},
+		{
+			name:     "lowercase keys",
+			files:    []string{"[pluto]\ntls = false\n[pluto.conflicttest]\nsessions = 3\n[pluto.concurrenttest]\nfirst = 0\n"},
+			tls:      false,
+			port:     DefaultPlainPort,
+			sessions: 3,
+			first:    0,
+		},
+		{
+			name:     "dotted lowercase keys",
+			files:    []string{"pluto.tls = false\npluto.conflicttest.sessions = 3\n"},
+			tls:      false,
+			port:     DefaultPlainPort,
+			sessions: 3,
+			first:    DefaultFirstUser,
+		},
+		{
+			name:     "lowercase keys in profile",
+			files:    []string{"[Profiles.docker.pluto]\ntls = false\n[Profiles.docker.pluto.concurrenttest]\nfirst = 0\n"},
+			profile:  "docker",
+			tls:      false,
+			port:     DefaultPlainPort,
+			sessions: DefaultConflictSession,
+			first:    0,
+		},
+		{
+			name:     "other profile",
+			files:    []string{"[Profiles.docker.pluto]\ntls = false\n[Profiles.local.pluto]\nport = \"1993\"\n"},
+			profile:  "local",
+			tls:      true,
+			port:     "1993",
+			sessions: DefaultConflictSession,
+			first:    DefaultFirstUser,
+		},
+		{
+			name:     "overlay keeps base",
+			files:    []string{"[pluto]\ntls = false\n", "[pluto.conflicttest]\nsessions = 5\n"},
+			tls:      false,
+			port:     DefaultPlainPort,
+			sessions: 5,
+			first:    DefaultFirstUser,
+		},
+		{
+			name:     "overlay replaces base",
+			files:    []string{"[Pluto]\nTLS = false\n", "[pluto]\ntls = true\n"},
+			tls:      true,
+			port:     DefaultPort,
+			sessions: DefaultConflictSession,
+			first:    DefaultFirstUser,
+		},
+		{
+			name:      "lowercase override",
+			files:     []string{""},
+			overrides: []string{"pluto.tls=false", "pluto.concurrenttest.first=0"},
+			tls:       false,
+			port:      DefaultPlainPort,
+			sessions:  DefaultConflictSession,
+			first:     0,
+		},
+	}
+
+	for _, test := range tests {
+
+		dir, err := ioutil.TempDir("", "config")
+		if err != nil {
+			t.Fatalf("failed to create temporary folder: %s", err.Error())
+		}
+
+		source := &Source{
+			Profile:   test.profile,
+			Overrides: test.overrides,
+		}
+
+		for i, content := range test.files {
+
+			fileName := filepath.Join(dir, fmt.Sprintf("config-%d.toml", i))
+
+			err := ioutil.WriteFile(fileName, []byte(content), 0600)
+			if err != nil {
+				t.Fatalf("%s: failed to write config file: %s", test.name, err.Error())
+			}
+
+			source.Files = append(source.Files, fileName)
+		}
+
+		conf, err := Load(source)
+		os.RemoveAll(dir)
+
+		if err != nil {
+			t.Errorf("%s: failed to load config: %s", test.name, err.Error())
+			continue
+		}
+
+		if (conf.Pluto.TLS != test.tls) || (conf.Pluto.Port != test.port) {
+			t.Errorf("%s: expected TLS %v on port %s but got %v on port %s", test.name, test.tls, test.port, conf.Pluto.TLS, conf.Pluto.Port)
+		}
+
+		if conf.Pluto.ConflictTest.Sessions != test.sessions {
+			t.Errorf("%s: expected %d conflicting sessions but got %d", test.name, test.sessions, conf.Pluto.ConflictTest.Sessions)
+		}
+
+		if conf.Pluto.ConcurrentTest.First != test.first {
+			t.Errorf("%s: expected first user %d but got %d", test.name, test.first, conf.Pluto.ConcurrentTest.First)
+		}
+
+		// Dovecot is left out in all files.
+		if (conf.Dovecot.TLS != true) || (conf.Dovecot.ConflictTest.Sessions != DefaultConflictSession) {
+			t.Errorf("%s: expected defaults for Dovecot but got %+v", test.name, conf.Dovecot)
+		}
+	}
+}
+
+// TestRequireConcurrentUsers checks that concurrent
+// tests only accept equal numbers of users on pluto
+// and Dovecot.
+func TestRequireConcurrentUsers(t *testing.T) {
+
+	users := func(num int) []User {
+
+		list := make([]User, num)
+		for i := range list {
+			list[i] = User{Name: fmt.Sprintf("user%d", i), Password: "secret"}
+		}
+
+		return list
+	}
+
+	tests := []struct {
+		name     string
+		pluto    int
+		dovecot  int
+		expected string
+	}{
+		{"equal", 3, 3, ""},
+		{"unequal", 3, 2, "pluto has 3 users but Dovecot has 2"},
+		{"missing", 3, 0, "Dovecot.ConcurrentTest.User"},
+	}
+
+	for _, test := range tests {
+
+		conf := &Config{
+			Pluto:   Pluto{IP: "10.0.0.1"},
+			Dovecot: Dovecot{IP: "10.0.0.2"},
+		}
+
+		conf.Pluto.ConcurrentTest.User = users(test.pluto)
+		conf.Dovecot.ConcurrentTest.User = users(test.dovecot)
+
+		err := conf.Require("Pluto", "ConcurrentTest")
+		if err == nil {
+			err = conf.Require("Dovecot", "ConcurrentTest")
+		}
+
+		if test.expected == "" {
+
+			if err != nil {
+				t.Errorf("%s: expected users to pair up but got: %s", test.name, err.Error())
+			}
+
+			continue
+		}
+
+		if (err == nil) || (strings.Contains(err.Error(), test.expected) != true) {
+			t.Errorf("%s: expected error containing '%s' but got: %v", test.name, test.expected, err)
+		}
+
+		// Tests of single users do not care.
+		conf.Pluto.AppendTest = User{Name: "user", Password: "secret"}
+
+		err = conf.Require("Pluto", "AppendTest")
+		if err != nil {
+			t.Errorf("%s: expected AppendTest to be unaffected but got: %s", test.name, err.Error())
+		}
+	}
+}
+
+// TestRequireCommandSecrets checks that passwords
+// obtained by commands are left alone by Load and
+// obtained once per distinct command by Require.
+func TestRequireCommandSecrets(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatalf("failed to create temporary folder: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	// Each run of the command leaves a line behind.
+	runs := filepath.Join(dir, "runs")
+	command := fmt.Sprintf("command:echo run >> '%s'; echo secret", runs)
+
+	content := fmt.Sprintf(`[Pluto]
+IP = "10.0.0.1"
+TLS = false
+
+[Pluto.AppendTest]
+Name = "user0"
+Password = "%[1]s"
+
+[Pluto.StoreTest]
+Name = "user1"
+Password = "%[1]s"
+
+[Pluto.CreateTest]
+Name = "user2"
+Password = "command:exit 1"
+`, command)
+
+	fileName := filepath.Join(dir, "config.toml")
+
+	err = ioutil.WriteFile(fileName, []byte(content), 0600)
+	if err != nil {
+		t.Fatalf("failed to write config file: %s", err.Error())
+	}
+
+	conf, err := Load(&Source{Files: []string{fileName}})
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err.Error())
+	}
+
+	if (conf.Pluto.AppendTest.Password != command) || (conf.Pluto.CreateTest.Password != "command:exit 1") {
+		t.Errorf("expected commands to be left to Require but got '%s' and '%s'", conf.Pluto.AppendTest.Password, conf.Pluto.CreateTest.Password)
+	}
+
+	_, err = os.Stat(runs)
+	if os.IsNotExist(err) != true {
+		t.Fatalf("expected Load not to run any command")
+	}
+
+	for _, test := range []string{"AppendTest", "StoreTest", "AppendTest"} {
+
+		err = conf.Require("Pluto", test)
+		if err != nil {
+			t.Fatalf("failed to require %s: %s", test, err.Error())
+		}
+	}
+
+	if (conf.Pluto.AppendTest.Password != "secret") || (conf.Pluto.StoreTest.Password != "secret") {
+		t.Errorf("expected passwords 'secret' but got '%s' and '%s'", conf.Pluto.AppendTest.Password, conf.Pluto.StoreTest.Password)
+	}
+
+	output, err := ioutil.ReadFile(runs)
+	if err != nil {
+		t.Fatalf("failed to read runs of command: %s", err.Error())
+	}
+
+	if strings.Count(string(output), "run") != 1 {
+		t.Errorf("expected command to run once but it ran %d times", strings.Count(string(output), "run"))
+	}
+
+	err = conf.Require("Pluto", "CreateTest")
+	if (err == nil) || (strings.Contains(err.Error(), "Pluto.CreateTest") != true) {
+		t.Errorf("expected failing command to be reported but got: %v", err)
+	}
+}
+
+// TestOverride checks which settings can be set on
+// the command line and how invalid ones are reported.
+func TestOverride(t *testing.T) {
+
+	tests := []struct {
+		override string
+		expected string
+	}{
+		{"pluto.ip=10.0.0.1", ""},
+		{"Pluto.ConflictTest.Sessions=8", ""},
+		{"pluto.tls=false", ""},
+		{"Pluto.TLSParams.Curves=X25519, P256,", ""},
+		{"Pluto.IP", "needs to be of the form key=value"},
+		{"Pluto.Unknown=1", "names unknown setting"},
+		{"Pluto.IP.Port=1", "names unknown setting"},
+		{"baseDir=/tmp", "names unknown setting"},
+		{"secrets=x", "names unknown setting"},
+		{"Pluto.ConflictTest.Sessions=many", "needs an integer value"},
+		{"Pluto.TLS=maybe", "needs a boolean value"},
+		{"Pluto.Verify=x", "names a section, not a single setting"},
+		{"Pluto.ConcurrentTest.User=user1", "names a list of User"},
+	}
+
+	for _, test := range tests {
+
+		conf := new(Config)
+
+		_, err := conf.override([]string{test.override})
+
+		if test.expected == "" {
+
+			if err != nil {
+				t.Errorf("%s: expected override to succeed but got: %s", test.override, err.Error())
+			}
+
+			continue
+		}
+
+		if (err == nil) || (strings.Contains(err.Error(), test.expected) != true) {
+			t.Errorf("%s: expected error containing '%s' but got: %v", test.override, test.expected, err)
+		}
+	}
+
+	conf := new(Config)
+
+	defined, err := conf.override([]string{"pluto.tlsparams.curves=X25519, P256,", "pluto.conflicttest.sessions=8"})
+	if err != nil {
+		t.Fatalf("failed to apply overrides: %s", err.Error())
+	}
+
+	if (len(conf.Pluto.TLSParams.Curves) != 2) || (conf.Pluto.TLSParams.Curves[0] != "X25519") || (conf.Pluto.TLSParams.Curves[1] != "P256") {
+		t.Errorf("expected curves X25519 and P256 but got %q", conf.Pluto.TLSParams.Curves)
+	}
+
+	if (conf.Pluto.ConflictTest.Sessions != 8) || (defined("Pluto", "ConflictTest", "Sessions") != true) {
+		t.Errorf("expected 8 sessions to be defined but got %d", conf.Pluto.ConflictTest.Sessions)
+	}
+}
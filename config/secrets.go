@@ -0,0 +1,79 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+)
+
+// Functions
+
+// ResolveSecret obtains a password from where value
+// points to: 'env:VAR' reads environment variable
+// VAR, 'file:/path' reads a file, relative paths
+// starting at baseDir, and 'command:program args'
+// runs a command via the shell, e.g. 'command:pass
+// show imap/user1'. Trailing line breaks of files and
+// command output are removed. Any other value is a
+// password itself and returned as is.
+func ResolveSecret(value string, baseDir string) (string, error) {
+
+	switch {
+
+	case strings.HasPrefix(value, "env:"):
+
+		name := strings.TrimPrefix(value, "env:")
+
+		secret, found := os.LookupEnv(name)
+		if found != true {
+			return "", fmt.Errorf("environment variable '%s' is not set", name)
+		}
+
+		return secret, nil
+
+	case strings.HasPrefix(value, "file:"):
+
+		path := strings.TrimPrefix(value, "file:")
+		if filepath.IsAbs(path) != true {
+			path = filepath.Join(baseDir, path)
+		}
+
+		secret, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret file: %s", err.Error())
+		}
+
+		return strings.TrimRight(string(secret), "\r\n"), nil
+
+	case strings.HasPrefix(value, "command:"):
+
+		command := strings.TrimPrefix(value, "command:")
+
+		stderr := &bytes.Buffer{}
+
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Dir = baseDir
+		cmd.Stderr = stderr
+
+		secret, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("command '%s' failed: %s %s", command, err.Error(), strings.TrimSpace(stderr.String()))
+		}
+
+		return strings.TrimRight(string(secret), "\r\n"), nil
+	}
+
+	return value, nil
+}
+
+// IsSecretReference reports whether value points
+// to where a password is stored instead of being
+// the password itself.
+func IsSecretReference(value string) bool {
+	return (strings.HasPrefix(value, "env:")) || (strings.HasPrefix(value, "file:")) || (strings.HasPrefix(value, "command:"))
+}
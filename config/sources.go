@@ -0,0 +1,330 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Structs
+
+// Source names where a config is loaded from: a
+// base file and overlays, applied in order, a profile
+// selected from each of these files and overrides of
+// single settings in the form 'Pluto.IP=10.0.0.1'.
+type Source struct {
+	Files     []string
+	Profile   string
+	Overrides []string
+}
+
+// stringList collects all values of a repeated
+// command-line flag.
+type stringList []string
+
+// Functions
+
+// String joins all values by commas.
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set adds one more value to the list.
+func (l *stringList) Set(value string) error {
+
+	*l = append(*l, value)
+
+	return nil
+}
+
+// Get returns all values as a slice of strings,
+// which makes the list a flag.Getter.
+func (l *stringList) Get() interface{} {
+	return []string(*l)
+}
+
+// Flags registers the command-line flags -config,
+// which may be repeated to overlay files, -profile
+// and -set, which may be repeated as well. The
+// returned source is filled once flags are parsed.
+func Flags() *Source {
+
+	source := new(Source)
+
+	flag.Var((*stringList)(&source.Files), "config", "Specify location of config file that describes test setup configuration, default test-config.toml. Repeat to overlay further files.")
+	flag.StringVar(&source.Profile, "profile", "", "Apply this named profile from the config files, e.g. docker.")
+	flag.Var((*stringList)(&source.Overrides), "set", "Override one config setting, e.g. Pluto.IP=10.0.0.1. May be repeated.")
+
+	return source
+}
+
+// FileNames returns the config files of source, or
+// the default file if none were named.
+func (s *Source) FileNames() []string {
+
+	if len(s.Files) == 0 {
+		return []string{DefaultFile}
+	}
+
+	return s.Files
+}
+
+// String describes source for messages.
+func (s *Source) String() string {
+
+	desc := fmt.Sprintf("'%s'", strings.Join(s.FileNames(), "' + '"))
+
+	if s.Profile != "" {
+		desc = fmt.Sprintf("%s with profile '%s'", desc, s.Profile)
+	}
+
+	if len(s.Overrides) > 0 {
+		desc = fmt.Sprintf("%s and overrides '%s'", desc, strings.Join(s.Overrides, "', '"))
+	}
+
+	return desc
+}
+
+// isProfileKey reports whether key lies within
+// the profiles of a config file.
+func isProfileKey(key toml.Key) bool {
+	return (len(key) > 0) && (strings.EqualFold(key[0], "Profiles"))
+}
+
+// matchesKey reports whether key names the setting
+// of keys. Like the TOML decoder, it ignores case, so
+// that '[pluto] tls = false' counts as Pluto.TLS.
+func matchesKey(key toml.Key, keys []string) bool {
+
+	if len(key) != len(keys) {
+		return false
+	}
+
+	for i := range keys {
+
+		if strings.EqualFold(key[i], keys[i]) != true {
+			return false
+		}
+	}
+
+	return true
+}
+
+// decodeFile decodes configFile over the values
+// already in conf, followed by the named profile
+// in section '[Profiles.<profile>]' if the file has
+// one. All other profiles are decoded as well, but
+// only to detect unknown keys. It returns whether
+// keys were defined in this file and whether it
+// contained the profile.
+func decodeFile(configFile string, profile string, conf *Config) (func(keys ...string) bool, bool, error) {
+
+	// Parse values from TOML file into struct.
+	md, err := toml.DecodeFile(configFile, conf)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read in TOML config file at '%s' with: %s\n", configFile, err.Error())
+	}
+
+	// Parse profiles separately so that only the
+	// selected one takes effect.
+	profiles := struct {
+		Profiles map[string]toml.Primitive
+	}{}
+
+	pmd, err := toml.DecodeFile(configFile, &profiles)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read in profiles of config file at '%s' with: %s\n", configFile, err.Error())
+	}
+
+	_, found := profiles.Profiles[profile]
+
+	for name, values := range profiles.Profiles {
+
+		target := new(Config)
+		if (found) && (name == profile) {
+			target = conf
+		}
+
+		err := pmd.PrimitiveDecode(values, target)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read in profile '%s' of config file at '%s' with: %s", name, configFile, err.Error())
+		}
+	}
+
+	// Keys that did not match any setting are most
+	// likely typos and would silently be ignored.
+	unknown := make([]string, 0)
+
+	for _, key := range md.Undecoded() {
+
+		if isProfileKey(key) != true {
+			unknown = append(unknown, key.String())
+		}
+	}
+
+	for _, key := range pmd.Undecoded() {
+
+		if isProfileKey(key) {
+			unknown = append(unknown, key.String())
+		}
+	}
+
+	if len(unknown) > 0 {
+		return nil, false, fmt.Errorf("unknown keys in config file '%s': %s", configFile, strings.Join(unknown, ", "))
+	}
+
+	// Profile names are map keys and thus match
+	// exactly, setting names within them do not.
+	defined := func(keys ...string) bool {
+
+		for _, key := range md.Keys() {
+
+			if matchesKey(key, keys) {
+				return true
+			}
+		}
+
+		if found != true {
+			return false
+		}
+
+		for _, key := range pmd.Keys() {
+
+			if (len(key) > 2) && (isProfileKey(key)) && (key[1] == profile) && (matchesKey(key[2:], keys)) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return defined, found, nil
+}
+
+// override sets each setting named in overrides,
+// e.g. 'Pluto.ConflictTest.Sessions=8', to its value.
+// Names are matched ignoring case. Lists of strings,
+// e.g. 'Pluto.TLSParams.Curves=X25519,P256', take
+// comma-separated values. It returns whether keys
+// were defined by an override.
+func (c *Config) override(overrides []string) (func(keys ...string) bool, error) {
+
+	set := make(map[string]bool)
+
+	for _, override := range overrides {
+
+		parts := strings.SplitN(override, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("override '%s' needs to be of the form key=value", override)
+		}
+
+		// Walk down to the named setting.
+		field := reflect.ValueOf(c).Elem()
+		names := make([]string, 0)
+
+		for _, name := range strings.Split(strings.TrimSpace(parts[0]), ".") {
+
+			if field.Kind() != reflect.Struct {
+				return nil, fmt.Errorf("override '%s' names unknown setting", override)
+			}
+
+			fieldType, found := field.Type().FieldByNameFunc(func(candidate string) bool {
+				return strings.EqualFold(candidate, name)
+			})
+
+			// Unexported fields are not settings.
+			if (found != true) || (fieldType.PkgPath != "") {
+				return nil, fmt.Errorf("override '%s' names unknown setting", override)
+			}
+
+			field = field.FieldByIndex(fieldType.Index)
+			names = append(names, fieldType.Name)
+		}
+
+		value := parts[1]
+
+		switch field.Kind() {
+
+		case reflect.String:
+			field.SetString(value)
+
+		case reflect.Int:
+
+			num, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, fmt.Errorf("override '%s' needs an integer value", override)
+			}
+
+			field.SetInt(int64(num))
+
+		case reflect.Bool:
+
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("override '%s' needs a boolean value", override)
+			}
+
+			field.SetBool(b)
+
+		case reflect.Slice:
+
+			if field.Type().Elem().Kind() != reflect.String {
+				return nil, fmt.Errorf("override '%s' names a list of %s, which cannot be set from the command line", override, field.Type().Elem().Name())
+			}
+
+			values := make([]string, 0)
+
+			for _, item := range strings.Split(value, ",") {
+
+				if strings.TrimSpace(item) != "" {
+					values = append(values, strings.TrimSpace(item))
+				}
+			}
+
+			field.Set(reflect.ValueOf(values))
+
+		case reflect.Struct:
+			return nil, fmt.Errorf("override '%s' names a section, not a single setting", override)
+
+		default:
+			return nil, fmt.Errorf("override '%s' names a setting of unsupported type %s", override, field.Type())
+		}
+
+		set[strings.Join(names, ".")] = true
+	}
+
+	defined := func(keys ...string) bool {
+		return set[strings.Join(keys, ".")]
+	}
+
+	return defined, nil
+}
+
+// MaskOverride returns override with its value
+// replaced by Mask if it sets a password, password
+// pattern, client secret or refresh token, fit for
+// printing. References to secrets are kept like in
+// Masked.
+func MaskOverride(override string) string {
+
+	parts := strings.SplitN(override, "=", 2)
+	if (len(parts) != 2) || (IsSecretReference(parts[1])) {
+		return override
+	}
+
+	names := strings.Split(strings.TrimSpace(parts[0]), ".")
+	name := names[(len(names) - 1)]
+
+	for _, secret := range []string{"Password", "PasswordPattern", "ClientSecret", "RefreshToken"} {
+
+		if strings.EqualFold(name, secret) {
+			return fmt.Sprintf("%s=%s", parts[0], Mask)
+		}
+	}
+
+	return override
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/numbleroot/pluto-evaluation/records"
+)
+
+// Functions
+
+func main() {
+
+	// Require a legacy log file or folder to convert.
+	inFlag := flag.String("in", "", "Supply legacy log file or log folder of concurrent test to convert.")
+	formatFlag := flag.String("format", "jsonl", "Specify format of converted results file: jsonl or csv.")
+	outFlag := flag.String("out", "", "Optionally specify location of converted results file. Defaults to input path with new extension.")
+	flag.Parse()
+
+	if *inFlag == "" {
+		fmt.Printf("Please specify a legacy test log file or folder to convert.\nFor example:\n")
+		fmt.Printf("\t$ ./convert-results -in results/pluto-append-2017-01-01-10-00-00.log -format csv\n")
+		fmt.Printf("\t$ ./convert-results -in results/pluto-store-concurrent-2017-01-01-10-00-00\n")
+		os.Exit(1)
+	}
+
+	outFileName := *outFlag
+	if outFileName == "" {
+		outFileName = records.FileName(strings.TrimSuffix(*inFlag, "/"), *formatFlag)
+	}
+
+	// Parse all lines of legacy input.
+	recs, err := records.ParseLegacy(*inFlag)
+	if err != nil {
+		fmt.Printf("Failed to parse legacy results: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	writer, err := records.NewWriter(outFileName)
+	if err != nil {
+		fmt.Printf("Failed to create converted results file: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	for _, rec := range recs {
+
+		err = writer.Write(rec)
+		if err != nil {
+			fmt.Printf("Failed to write record: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	err = writer.Close()
+	if err != nil {
+		fmt.Printf("Failed to close converted results file: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Converted %d records into '%s'.\n", len(recs), outFileName)
+}
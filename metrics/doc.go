@@ -0,0 +1,4 @@
+/*
+Package metrics exposes live measurements of running tests to Prometheus.
+*/
+package metrics
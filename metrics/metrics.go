@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"net/http"
+
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Structs
+
+// connKey identifies one connection of a target.
+type connKey struct {
+	target string
+	conn   int
+}
+
+// connCollector reports per target the number of
+// connections that completed a command recently. As
+// it only sees completed commands, connections that
+// are open but idle are not counted. It implements
+// prometheus.Collector.
+type connCollector struct {
+	lock     *sync.Mutex
+	desc     *prometheus.Desc
+	window   time.Duration
+	lastSeen map[connKey]time.Time
+}
+
+// Variables
+
+// registry holds all metrics of this package.
+var registry = prometheus.NewRegistry()
+
+// latency observes completion times of commands
+// by target, operation and IMAP status.
+var latency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: "pluto_evaluation",
+	Name:      "command_duration_seconds",
+	Help:      "Completion time of IMAP commands sent by the test client.",
+	Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+}, []string{"target", "op", "status"})
+
+// bytesSent counts bytes of commands, including
+// literals, sent by target and operation.
+var bytesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "pluto_evaluation",
+	Name:      "bytes_sent_total",
+	Help:      "Bytes of IMAP commands and literals sent by the test client.",
+}, []string{"target", "op"})
+
+// connections tracks recently active connections
+// per target.
+var connections = &connCollector{
+	lock: &sync.Mutex{},
+	desc: prometheus.NewDesc("pluto_evaluation_recently_active_connections",
+		"Connections of the test client that completed a command within the last ten seconds.",
+		[]string{"target"}, nil),
+	window:   (10 * time.Second),
+	lastSeen: make(map[connKey]time.Time),
+}
+
+// server answers metrics requests once Serve
+// was called.
+var server *http.Server
+
+// Functions
+
+func init() {
+	registry.MustRegister(latency, bytesSent, connections)
+}
+
+// Describe sends the description of the
+// connections metric.
+func (c *connCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect counts per target all connections seen
+// within the window and forgets older ones.
+func (c *connCollector) Collect(ch chan<- prometheus.Metric) {
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	now := time.Now()
+	active := make(map[string]int)
+
+	for key, seen := range c.lastSeen {
+
+		if now.Sub(seen) > c.window {
+			delete(c.lastSeen, key)
+			continue
+		}
+
+		active[key.target]++
+	}
+
+	for target, count := range active {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), target)
+	}
+}
+
+// Record adds one completed command to all metrics.
+// Its signature fits records.Writer.Observe.
+func Record(rec records.Record) {
+
+	latency.WithLabelValues(rec.Target, rec.Op, rec.Status).Observe(time.Duration(rec.Latency).Seconds())
+	bytesSent.WithLabelValues(rec.Target, rec.Op).Add(float64(rec.Bytes))
+
+	connections.lock.Lock()
+	connections.lastSeen[connKey{rec.Target, rec.Conn}] = time.Now()
+	connections.lock.Unlock()
+}
+
+// Serve starts serving all metrics at '/metrics' of
+// an HTTP server listening on addr, e.g. ':9100'. It
+// returns once the server listens. Slow or stalled
+// scrapers are cut off, so that they cannot keep
+// connections of the server open forever.
+func Serve(addr string) error {
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics requests on '%s': %s", addr, err.Error())
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		Timeout: (10 * time.Second),
+	}))
+
+	server = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: (5 * time.Second),
+		ReadTimeout:       (10 * time.Second),
+		WriteTimeout:      (15 * time.Second),
+		IdleTimeout:       time.Minute,
+	}
+
+	go server.Serve(listener)
+
+	return nil
+}
+
+// Shutdown stops serving metrics, waiting at most a
+// few seconds for requests in flight to complete. It
+// does nothing if metrics are not served.
+func Shutdown() error {
+
+	if server == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), (5 * time.Second))
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to stop serving metrics: %s", err.Error())
+	}
+
+	server = nil
+
+	return nil
+}
@@ -0,0 +1,4 @@
+/*
+Package oauth obtains OAuth 2.0 access tokens for logging in via XOAUTH2 and OAUTHBEARER.
+*/
+package oauth
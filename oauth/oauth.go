@@ -0,0 +1,169 @@
+package oauth
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+)
+
+// Structs
+
+// TokenSource obtains access tokens by redeeming a
+// refresh token at a token endpoint (RFC 6749, section
+// 6) and keeps each one until shortly before it
+// expires. It is safe for concurrent use.
+type TokenSource struct {
+	lock      *sync.Mutex
+	conf      config.OAuth
+	token     string
+	renewAt   time.Time
+	refreshes int
+}
+
+// tokenResponse mirrors successful and failed
+// responses of a token endpoint.
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// Variables
+
+// RenewBefore is how long before its expiry an
+// access token is renewed at most. Short-lived tokens
+// are renewed after four fifths of their lifetime.
+var RenewBefore = time.Minute
+
+// DefaultLifetime is assumed for access tokens whose
+// lifetime the token endpoint does not state.
+var DefaultLifetime = time.Hour
+
+// client posts token requests to token endpoints.
+var client = &http.Client{
+	Timeout: (10 * time.Second),
+}
+
+// Functions
+
+// NewTokenSource returns a token source redeeming
+// the refresh token of conf. No token is requested
+// before the first call to Token.
+func NewTokenSource(conf config.OAuth) *TokenSource {
+
+	return &TokenSource{
+		lock: &sync.Mutex{},
+		conf: conf,
+	}
+}
+
+// Token returns a valid access token, requesting a
+// new one if none was obtained yet or the current one
+// is about to expire.
+func (t *TokenSource) Token() (string, error) {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if (t.token == "") || (time.Now().After(t.renewAt)) {
+
+		err := t.refresh()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return t.token, nil
+}
+
+// Expiring reports whether the current access token
+// is about to expire, so that sessions logged in
+// with it should log in again with a new one.
+func (t *TokenSource) Expiring() bool {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return (t.token == "") || (time.Now().After(t.renewAt))
+}
+
+// Refreshes returns how many access tokens were
+// obtained so far.
+func (t *TokenSource) Refreshes() int {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.refreshes
+}
+
+// refresh redeems the refresh token for a new
+// access token. Callers need to hold the lock.
+func (t *TokenSource) refresh() error {
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", t.conf.RefreshToken)
+	form.Set("client_id", t.conf.ClientID)
+
+	if t.conf.ClientSecret != "" {
+		form.Set("client_secret", t.conf.ClientSecret)
+	}
+
+	resp, err := client.PostForm(t.conf.TokenURL, form)
+	if err != nil {
+		return fmt.Errorf("failed to request access token from '%s': %s", t.conf.TokenURL, err.Error())
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read access token from '%s': %s", t.conf.TokenURL, err.Error())
+	}
+
+	answer := tokenResponse{}
+
+	err = json.Unmarshal(body, &answer)
+	if err != nil {
+		return fmt.Errorf("token endpoint '%s' responded with %s: %s", t.conf.TokenURL, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	if (resp.StatusCode != http.StatusOK) || (answer.Error != "") {
+		return fmt.Errorf("token endpoint '%s' refused refresh token with %s: %s %s", t.conf.TokenURL, resp.Status, answer.Error, answer.ErrorDescription)
+	}
+
+	if answer.AccessToken == "" {
+		return fmt.Errorf("token endpoint '%s' did not return an access token", t.conf.TokenURL)
+	}
+
+	if (answer.TokenType != "") && (strings.EqualFold(answer.TokenType, "Bearer") != true) {
+		return fmt.Errorf("token endpoint '%s' returned unsupported token type '%s'", t.conf.TokenURL, answer.TokenType)
+	}
+
+	// Renew well before the token expires.
+	lifetime := DefaultLifetime
+	if answer.ExpiresIn > 0 {
+		lifetime = (time.Duration(answer.ExpiresIn) * time.Second)
+	}
+
+	margin := (lifetime / 5)
+	if margin > RenewBefore {
+		margin = RenewBefore
+	}
+
+	t.token = answer.AccessToken
+	t.renewAt = time.Now().Add(lifetime - margin)
+	t.refreshes++
+
+	return nil
+}
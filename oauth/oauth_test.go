@@ -0,0 +1,185 @@
+package oauth
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+)
+
+// Functions
+
+// TestTokenSourceRefresh checks that access tokens
+// are requested with the configured credentials,
+// kept until shortly before they expire and renewed
+// afterwards.
+func TestTokenSourceRefresh(t *testing.T) {
+
+	requests := 0
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requests++
+
+		err := r.ParseForm()
+		if err != nil {
+			t.Errorf("failed to parse token request: %s", err.Error())
+		}
+
+		for key, expected := range map[string]string{
+			"grant_type":    "refresh_token",
+			"refresh_token": "refresh",
+			"client_id":     "client",
+			"client_secret": "secret",
+		} {
+
+			if r.PostForm.Get(key) != expected {
+				t.Errorf("expected %s '%s' but got '%s'", key, expected, r.PostForm.Get(key))
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, "{\"access_token\": \"token%d\", \"token_type\": \"Bearer\", \"expires_in\": 3600}", requests)
+	}))
+	defer endpoint.Close()
+
+	tokens := NewTokenSource(config.OAuth{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		RefreshToken: "refresh",
+		TokenURL:     endpoint.URL,
+	})
+
+	if (tokens.Expiring() != true) || (requests != 0) {
+		t.Fatalf("expected no token to be requested before the first one is needed")
+	}
+
+	for i := 0; i < 3; i++ {
+
+		token, err := tokens.Token()
+		if err != nil {
+			t.Fatalf("failed to obtain access token: %s", err.Error())
+		}
+
+		if token != "token1" {
+			t.Errorf("expected token1 but got %s", token)
+		}
+	}
+
+	if (requests != 1) || (tokens.Refreshes() != 1) || (tokens.Expiring()) {
+		t.Errorf("expected one valid token after one request but got %d requests and %d refreshes", requests, tokens.Refreshes())
+	}
+
+	// Tokens are renewed one minute early.
+	renewIn := time.Until(tokens.renewAt)
+	if (renewIn > (59 * time.Minute)) || (renewIn < (58 * time.Minute)) {
+		t.Errorf("expected renewal in 59 minutes but got %v", renewIn)
+	}
+
+	// Let the token expire.
+	tokens.renewAt = time.Now().Add(-time.Second)
+
+	if tokens.Expiring() != true {
+		t.Errorf("expected expired token to be reported as expiring")
+	}
+
+	token, err := tokens.Token()
+	if err != nil {
+		t.Fatalf("failed to renew access token: %s", err.Error())
+	}
+
+	if (token != "token2") || (tokens.Refreshes() != 2) {
+		t.Errorf("expected token2 after 2 refreshes but got %s after %d", token, tokens.Refreshes())
+	}
+}
+
+// TestTokenSourceLifetime checks when tokens of
+// different lifetimes are renewed.
+func TestTokenSourceLifetime(t *testing.T) {
+
+	tests := []struct {
+		answer  string
+		renewIn time.Duration
+	}{
+		// Short-lived tokens are renewed after four
+		// fifths of their lifetime.
+		{"{\"access_token\": \"a\", \"expires_in\": 100}", (80 * time.Second)},
+		{"{\"access_token\": \"a\", \"expires_in\": 7200}", (119 * time.Minute)},
+		{"{\"access_token\": \"a\"}", (DefaultLifetime - RenewBefore)},
+	}
+
+	for _, test := range tests {
+
+		endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, test.answer)
+		}))
+
+		tokens := NewTokenSource(config.OAuth{TokenURL: endpoint.URL})
+
+		_, err := tokens.Token()
+		endpoint.Close()
+
+		if err != nil {
+			t.Errorf("%s: failed to obtain access token: %s", test.answer, err.Error())
+			continue
+		}
+
+		renewIn := time.Until(tokens.renewAt)
+		if (renewIn > test.renewIn) || (renewIn < (test.renewIn - time.Second)) {
+			t.Errorf("%s: expected renewal in %v but got %v", test.answer, test.renewIn, renewIn)
+		}
+	}
+}
+
+// TestTokenSourceErrors checks that failed token
+// requests are reported and no token is kept.
+func TestTokenSourceErrors(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		status   int
+		answer   string
+		expected string
+	}{
+		{"refused", http.StatusBadRequest, "{\"error\": \"invalid_grant\", \"error_description\": \"Token has been expired or revoked.\"}", "invalid_grant Token has been expired or revoked."},
+		{"error with OK", http.StatusOK, "{\"error\": \"invalid_client\"}", "invalid_client"},
+		{"no JSON", http.StatusInternalServerError, "backend unavailable\n", "500 Internal Server Error: backend unavailable"},
+		{"no token", http.StatusOK, "{\"token_type\": \"Bearer\"}", "did not return an access token"},
+		{"token type", http.StatusOK, "{\"access_token\": \"a\", \"token_type\": \"mac\"}", "unsupported token type 'mac'"},
+	}
+
+	for _, test := range tests {
+
+		endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.answer)
+		}))
+
+		tokens := NewTokenSource(config.OAuth{TokenURL: endpoint.URL})
+
+		token, err := tokens.Token()
+		endpoint.Close()
+
+		if (err == nil) || (strings.Contains(err.Error(), test.expected) != true) {
+			t.Errorf("%s: expected error containing '%s' but got: %v", test.name, test.expected, err)
+		}
+
+		if (token != "") || (tokens.Refreshes() != 0) || (tokens.Expiring() != true) {
+			t.Errorf("%s: expected no token to be kept but got '%s' after %d refreshes", test.name, token, tokens.Refreshes())
+		}
+	}
+
+	// Endpoints that cannot be reached.
+	endpoint := httptest.NewServer(http.NotFoundHandler())
+	endpoint.Close()
+
+	_, err := NewTokenSource(config.OAuth{TokenURL: endpoint.URL}).Token()
+	if (err == nil) || (strings.Contains(err.Error(), "failed to request access token") != true) {
+		t.Errorf("expected unreachable endpoint to be reported but got: %v", err)
+	}
+}
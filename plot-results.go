@@ -4,22 +4,56 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"image/color"
 	"io/ioutil"
 	"path/filepath"
 
 	"github.com/gonum/plot"
 	"github.com/gonum/plot/plotter"
 	"github.com/gonum/plot/vg"
-	"github.com/gonum/plot/vg/draw"
+	"github.com/numbleroot/pluto-evaluation/plots"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
 )
 
+// Structs
+
+// PathList collects all values of a repeatable flag.
+type PathList []string
+
+// Run holds the parsed contents of one test log
+// file or folder, or of one target in a results file.
+// Records are only present if a results file with
+// absolute timestamps was found for the run.
+type Run struct {
+	Subject  string
+	Platform string
+	DateRaw  string
+	Date     time.Time
+	Points   plotter.XYs
+	Records  []records.Record
+	Conns    []plots.Connection
+}
+
 // Functions
 
+// String returns all collected paths.
+func (l *PathList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set appends another path to the list.
+func (l *PathList) Set(path string) error {
+
+	*l = append(*l, path)
+
+	return nil
+}
+
 // ParseDataFile takes in a location to a test log file,
 // reads its content, parses it and returns the relevant
 // and needed parts of it.
@@ -79,31 +113,29 @@ func ParseDataFile(filePath string) (string, string, string, plotter.XYs, error)
 
 // ParseDataFolder takes in a path to a folder containing
 // measurements from a concurrent command test. It parses
-// all files, combining and averaging each individual run
-// over all available concurrently executed commands.
-func ParseDataFolder(folderPath string) (string, string, string, plotter.XYs, error) {
+// all files, keeping the series of each connection, and
+// additionally averages each message number over all
+// connections that sent it.
+func ParseDataFolder(folderPath string) (string, string, string, plotter.XYs, []plots.Connection, error) {
 
 	var dataSubject string
 	var dataPlatform string
 	var dataDateRaw string
-	var dataPoints plotter.XYs
 
 	// Find all files in supplied folder.
 	files, err := filepath.Glob(filepath.Join(folderPath, "*"))
 	if err != nil {
-		return "", "", "", nil, err
+		return "", "", "", nil, nil, err
 	}
 
-	// Save number of files (= concurrent accesses)
-	// for later correction of data points.
-	numFiles := float64(len(files))
+	conns := make([]plots.Connection, 0, len(files))
 
 	for i, file := range files {
 
 		// Parse contents of current file.
 		curDataSubject, curDataPlatform, curDataDateRaw, curDataPoints, err := ParseDataFile(file)
 		if err != nil {
-			return "", "", "", nil, err
+			return "", "", "", nil, nil, err
 		}
 
 		if i == 0 {
@@ -112,227 +144,511 @@ func ParseDataFolder(folderPath string) (string, string, string, plotter.XYs, er
 			dataSubject = curDataSubject
 			dataPlatform = curDataPlatform
 			dataDateRaw = curDataDateRaw
-			dataPoints = curDataPoints
 
 		} else {
 
 			// Check for files being from the same test run.
 			if (dataSubject != curDataSubject) || (dataPlatform != curDataPlatform) || (dataDateRaw != curDataDateRaw) {
-				return "", "", "", nil, fmt.Errorf("files from same folder were not from same test")
+				return "", "", "", nil, nil, fmt.Errorf("files from same folder were not from same test")
 			}
+		}
 
-			for u := range dataPoints {
+		// Connection number is part of file name
+		// 'conn-NNN.log'. Fall back to file index.
+		conn, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "conn-"), ".log"))
+		if err != nil {
+			conn = i
+		}
 
-				// Add measured rtt from current data points set
-				// to already accumulated set.
-				dataPoints[u].Y += curDataPoints[u].Y
-			}
+		conns = append(conns, plots.Connection{
+			Conn:   conn,
+			Points: curDataPoints,
+		})
+	}
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].Conn < conns[j].Conn
+	})
+
+	return dataSubject, dataPlatform, dataDateRaw, plots.AverageConnections(conns), conns, nil
+}
+
+// ConnectionStats prints fairness metrics of a run with
+// several connections: Jain's index over the throughput
+// of all connections and percentiles per connection.
+func ConnectionStats(name string, conns []plots.Connection) {
+
+	throughputs := make([]float64, 0, len(conns))
+
+	fmt.Printf("\n%s: %d connections\n", name, len(conns))
+
+	for _, conn := range conns {
+
+		values := make([]float64, len(conn.Points))
+		total := 0.0
+
+		for i, point := range conn.Points {
+			values[i] = point.Y
+			total += point.Y
+		}
+
+		sorted := stats.Sorted(values)
+
+		// Connections send their commands one after
+		// another, thus the number of commands over the
+		// summed completion time is their throughput.
+		throughput := 0.0
+		if total > 0 {
+			throughput = float64(len(values)) / (total / 1000.0)
 		}
+		throughputs = append(throughputs, throughput)
+
+		fmt.Printf("\tconn %d: n %d, %.1f cmd/s, p50 %.3f ms, p90 %.3f ms, p99 %.3f ms, max %.3f ms\n",
+			conn.Conn, len(values), throughput, stats.Percentile(sorted, 50.0), stats.Percentile(sorted, 90.0), stats.Percentile(sorted, 99.0), stats.Percentile(sorted, 100.0))
 	}
 
-	for u := range dataPoints {
+	fmt.Printf("\tJain's fairness index over throughput: %.4f\n", stats.JainIndex(throughputs))
+}
 
-		// Normalize each accumulated run by averaging
-		// it over all performed runs.
-		dataPoints[u].Y = dataPoints[u].Y / numFiles
+// LegendNames names each run by its platform. Platforms
+// occurring more than once, e.g. different pluto builds,
+// get the date of each run appended.
+func LegendNames(runs []Run) []string {
+
+	count := make(map[string]int)
+	for _, run := range runs {
+		count[run.Platform]++
 	}
 
-	return dataSubject, dataPlatform, dataDateRaw, dataPoints, nil
+	names := make([]string, len(runs))
+	for i, run := range runs {
+
+		if count[run.Platform] > 1 {
+			names[i] = fmt.Sprintf("%s (%s)", run.Platform, run.Date.Format("2006-01-02 15:04:05"))
+		} else {
+			names[i] = run.Platform
+		}
+	}
+
+	return names
 }
 
-// PreparePlot initializes a new plot with acceptable
-// styling defaults and returns it.
-func PreparePlot(title string, xMax float64, xLabel string, yLabel string) (*plot.Plot, error) {
+// SubjectFromScenario maps the scenario of a results
+// file back to the subject used in legacy log files,
+// e.g. 'store-concurrent' to 'Concurrent-STORE', so
+// that both kinds of input can be plotted together.
+func SubjectFromScenario(scenario string) string {
 
-	// Use Helvetica in big size for title.
-	bigFont, err := vg.MakeFont("Helvetica", 16)
-	if err != nil {
-		return nil, err
+	if strings.HasSuffix(scenario, "-concurrent") {
+		return fmt.Sprintf("Concurrent-%s", strings.ToUpper(strings.TrimSuffix(scenario, "-concurrent")))
 	}
 
-	// Use Courier in small size for all labels.
-	smallFont, err := vg.MakeFont("Courier", 11)
-	if err != nil {
-		return nil, err
+	if strings.Contains(scenario, "-") != true {
+		return strings.ToUpper(scenario)
 	}
 
-	// Create an empty plot.
-	p, err := plot.New()
+	return scenario
+}
+
+// ParseRecords loads a results file or run manifest
+// and returns one run per scenario and target in it.
+func ParseRecords(path string) ([]Run, error) {
+
+	recs, err := records.Load(path)
 	if err != nil {
 		return nil, err
 	}
 
-	// Set title of plot and its style.
-	p.Title.Text = title
-	p.Title.Padding = 1 * vg.Centimeter
-	p.Title.Font = bigFont
+	keys := make([]string, 0, 2)
+	split := make(map[string][]records.Record)
+
+	for _, rec := range recs {
+
+		key := fmt.Sprintf("%s/%s", rec.Scenario, rec.Target)
+		if _, found := split[key]; found != true {
+			keys = append(keys, key)
+		}
+
+		split[key] = append(split[key], rec)
+	}
+
+	runs := make([]Run, 0, len(keys))
+
+	for _, key := range keys {
+
+		recs := split[key]
+
+		// Date of run is start of its first command.
+		date := recs[0].Start
+		for _, rec := range recs {
+
+			if rec.Start.Before(date) {
+				date = rec.Start
+			}
+		}
+
+		conns := plots.RecordConnections(recs)
+
+		runs = append(runs, Run{
+			Subject:  SubjectFromScenario(recs[0].Scenario),
+			Platform: recs[0].Target,
+			DateRaw:  date.Format("2006-01-02-15-04-05"),
+			Date:     date,
+			Points:   plots.AverageConnections(conns),
+			Records:  recs,
+			Conns:    conns,
+		})
+	}
+
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("no records found")
+	}
+
+	return runs, nil
+}
+
+// ParseRun parses a log file or, if folder is set, a
+// log folder of a concurrent test into a run. Results
+// files and run manifests may be supplied as file as
+// well and yield one run per contained target.
+func ParseRun(path string, folder bool) ([]Run, error) {
+
+	var run Run
+	var err error
+
+	if (folder != true) && (strings.HasSuffix(path, ".manifest.json") || (filepath.Ext(path) == ".jsonl") || (filepath.Ext(path) == ".csv")) {
+		return ParseRecords(path)
+	}
+
+	if folder {
+
+		run.Subject, run.Platform, run.DateRaw, run.Points, run.Conns, err = ParseDataFolder(path)
+		if err != nil {
+			return nil, err
+		}
+		run.Subject = strings.Replace(run.Subject, " ", "-", -1)
+
+	} else {
+
+		run.Subject, run.Platform, run.DateRaw, run.Points, err = ParseDataFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		run.Conns = []plots.Connection{{Conn: 0, Points: run.Points}}
+	}
 
-	// Style x-axis a bit.
-	p.X.Min = 1.0
-	p.X.Max = xMax
-	p.X.Label.Text = xLabel
-	p.X.Label.Font = smallFont
-	p.X.Padding = 0.2 * vg.Centimeter
-	p.X.Tick.Label.Font = smallFont
+	// Prepare time of test for printing.
+	run.Date, err = time.Parse("2006-01-02-15-04-05", run.DateRaw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to format date: %s", err.Error())
+	}
 
-	// Style y-axis a bit.
-	p.Y.Min = 0.0
-	p.Y.Label.Text = yLabel
-	p.Y.Label.Font = smallFont
-	p.Y.Padding = 0.1 * vg.Centimeter
-	p.Y.Tick.Label.Font = smallFont
+	// Log files lack absolute timestamps. Pick them up
+	// from the results file written next to the log.
+	for _, format := range []string{"jsonl", "csv"} {
 
-	// Style legend a bit.
-	p.Legend.Font = smallFont
+		recs, err := records.ReadFile(records.FileName(path, format))
+		if err == nil {
+			run.Records = recs
+			break
+		}
+	}
 
-	return p, nil
+	return []Run{run}, nil
 }
 
-// Usage prints out how to use this script with the two possible
-// options: plot two files against each other or two folders.
-// It exits the program.
+// Usage prints out how to use this script with the possible
+// options: plot any number of files or folders against
+// each other. It exits the program.
 func Usage() {
 
 	// Print usage example and exit.
-	fmt.Printf("Please specify either two test log files or two test log folders to plot against each other.\nFor example:\n")
+	fmt.Printf("Please specify test log files or test log folders to plot against each other.\nFor example:\n")
 	fmt.Printf("\t$ ./plot-results -fileOne results/pluto-append.log -fileTwo results/dovecot-append.log\n")
 	fmt.Printf("\t$ ./plot-results -folderOne results/pluto-concurrent-store -folderTwo results/dovecot-concurrent-store\n")
+	fmt.Printf("\t$ ./plot-results -kind cdf -file results/pluto-append.log -file results/dovecot-append.log -file results/gmail-append.log\n")
+	fmt.Printf("\t$ ./plot-results -kind throughput -file results/pluto-store-concurrent-2017-01-01-10-00-00.jsonl -file results/dovecot-store-concurrent-2017-01-01-10-00-00.jsonl\n")
+	fmt.Printf("\t$ ./plot-results -facet -kind box -file results/pluto-append.log -file results/pluto-store.log -file results/dovecot-append.log -file results/dovecot-store.log\n")
 
 	os.Exit(1)
 }
 
 func main() {
 
-	var dataOneSubject, dataTwoSubject string
-	var dataOnePlatform, dataTwoPlatform string
-	var dataOneDateRaw, dataTwoDateRaw string
-	var dataOnePoints, dataTwoPoints plotter.XYs
-	var err error
+	var files PathList
+	var folders PathList
 
-	// Require two files or two folders to be plotted.
+	// Require files or folders to be plotted.
 	fileOnePath := flag.String("fileOne", "", "Supply first log file of IMAP command test.")
 	fileTwoPath := flag.String("fileTwo", "", "Supply second log file of IMAP command test.")
 	folderOnePath := flag.String("folderOne", "", "Supply first log folder of concurrent IMAP command test.")
 	folderTwoPath := flag.String("folderTwo", "", "Supply second log folder of concurrent IMAP command test.")
+	flag.Var(&files, "file", "Supply log file of IMAP command test. Repeat to plot more files.")
+	flag.Var(&folders, "folder", "Supply log folder of concurrent IMAP command test. Repeat to plot more folders.")
+	kindFlag := flag.String("kind", "scatter", fmt.Sprintf("Specify kind of plot, one of %v.", plots.Kinds))
+	bucketsFlag := flag.Int("buckets", 40, "Specify number of logarithmic buckets of a histogram.")
+	windowFlag := flag.Duration("window", time.Second, "Specify trailing window of rolling percentiles in latency-time plots.")
+	percentileFlag := flag.Float64("percentile", 99.0, "Specify percentile of completion times shown in latency-time plots.")
+	perConnFlag := flag.Bool("perConn", true, "Draw one line per connection of concurrent runs in throughput and latency-time plots.")
+	facetFlag := flag.Bool("facet", false, "Draw one subplot per tested command into a grid instead of requiring all tests to have run the same command.")
+	formatFlag := flag.String("format", "svg", fmt.Sprintf("Specify output format, one of %v. Ignored if -out is given.", plots.Formats))
+	outFlag := flag.String("out", "", "Specify output file name. Its extension selects the format. Defaults to a name built from all runs in results/.")
+	widthFlag := flag.String("width", "9in", "Specify width of plot (of each subplot in a grid), e.g. 9in, 16cm or 400pt.")
+	heightFlag := flag.String("height", "9in", "Specify height of plot (of each subplot in a grid), e.g. 9in, 12cm or 300pt.")
+	fontFlag := flag.String("font", "", "Specify font of all text, e.g. Times-Roman. Defaults to Helvetica for titles and Courier for labels.")
+	fontSizeFlag := flag.Float64("fontSize", 11, "Specify font size of labels in points. Titles are set 5 points larger.")
+	warmupFlag := flag.String("warmup", "", "Exclude warm-up from analysis: first number of commands of each connection, e.g. 50, or first duration of each run, e.g. 5s.")
+	outliersFlag := flag.String("outliers", "iqr", "Detect and report outliers via interquartile range (iqr), median absolute deviation (mad) or not at all (none).")
+	outlierKFlag := flag.Float64("outlierK", 0, "Specify factor of IQR or MAD beyond which values are outliers. Defaults to 1.5 for iqr and 3.5 for mad.")
+	dropOutliersFlag := flag.Bool("dropOutliers", false, "Leave detected outliers out of plots. They are reported either way.")
+	pgfFlag := flag.Bool("pgf", false, fmt.Sprintf("Additionally write pgfplots data tables and a .tex snippet next to the plot. Supported for kinds %v.", plots.PGFKinds))
 	flag.Parse()
 
-	// Check that two files or two folders were supplied.
-	if (*fileOnePath == "") && (*fileTwoPath == "") && (*folderOnePath == "") && (*folderTwoPath == "") {
+	// Paths of the original two-set flags come first.
+	for _, path := range []string{*fileTwoPath, *fileOnePath} {
+		if path != "" {
+			files = append(PathList{path}, files...)
+		}
+	}
+
+	for _, path := range []string{*folderTwoPath, *folderOnePath} {
+		if path != "" {
+			folders = append(PathList{path}, folders...)
+		}
+	}
+
+	// Check that at least one file or folder was supplied.
+	if (len(files) + len(folders)) == 0 {
 		Usage()
 	}
 
-	if (*fileOnePath != "") && (*fileTwoPath != "") {
+	runs := make([]Run, 0, (len(files) + len(folders)))
+
+	for _, path := range files {
 
-		// Parse data from first log file.
-		dataOneSubject, dataOnePlatform, dataOneDateRaw, dataOnePoints, err = ParseDataFile(*fileOnePath)
+		// Parse data from log or results file.
+		fileRuns, err := ParseRun(path, false)
 		if err != nil {
-			fmt.Printf("Failed to parse data from first file: %s\n", err.Error())
+			fmt.Printf("Failed to parse data from file %s: %s\n", path, err.Error())
 			os.Exit(1)
 		}
 
-		// Parse data from second log file.
-		dataTwoSubject, dataTwoPlatform, dataTwoDateRaw, dataTwoPoints, err = ParseDataFile(*fileTwoPath)
+		runs = append(runs, fileRuns...)
+	}
+
+	for _, path := range folders {
+
+		// Parse data from log folder.
+		folderRuns, err := ParseRun(path, true)
 		if err != nil {
-			fmt.Printf("Failed to parse data from second file: %s\n", err.Error())
+			fmt.Printf("Failed to parse data from folder %s: %s\n", path, err.Error())
 			os.Exit(1)
 		}
 
-	} else if (*folderOnePath != "") && (*folderTwoPath != "") {
+		runs = append(runs, folderRuns...)
+	}
 
-		// Parse data from first log folder.
-		dataOneSubject, dataOnePlatform, dataOneDateRaw, dataOnePoints, err = ParseDataFolder(*folderOnePath)
-		if err != nil {
-			fmt.Printf("Failed to parse data from first folder: %s\n", err.Error())
-			os.Exit(1)
+	names := LegendNames(runs)
+
+	warmup, err := records.ParseWarmup(*warmupFlag)
+	if err != nil {
+		fmt.Printf("Invalid warm-up: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	// Group runs by the command they tested,
+	// keeping order of first appearance.
+	subjects := make([]string, 0, 1)
+	groups := make(map[string][]plots.DataSet)
+	descs := make(map[string][]string)
+
+	for i, run := range runs {
+
+		if _, found := groups[run.Subject]; found != true {
+			subjects = append(subjects, run.Subject)
+		}
+
+		// Style is assigned per run so that each run
+		// looks the same in every subplot.
+		set := plots.DataSet{
+			Name:    names[i],
+			Style:   i,
+			Points:  run.Points,
+			Records: run.Records,
+			Conns:   run.Conns,
 		}
-		dataOneSubject = strings.Replace(dataOneSubject, " ", "-", -1)
 
-		// Parse data from second log folder.
-		dataTwoSubject, dataTwoPlatform, dataTwoDateRaw, dataTwoPoints, err = ParseDataFolder(*folderTwoPath)
+		// Exclude warm-up of each connection.
+		set, excluded, err := set.WithoutWarmup(warmup)
 		if err != nil {
-			fmt.Printf("Failed to parse data from second folder: %s\n", err.Error())
+			fmt.Printf("Failed to exclude warm-up: %s\n", err.Error())
 			os.Exit(1)
 		}
-		dataTwoSubject = strings.Replace(dataTwoSubject, " ", "-", -1)
 
-	} else {
+		if warmup.IsZero() != true {
+			fmt.Printf("%s: excluded %d commands as warm-up (%s).\n", names[i], excluded, warmup)
+		}
 
-		// Wrong constellation of arguments.
-		// Print examples and exit.
-		Usage()
+		// Report outliers separately instead of
+		// silently dropping them.
+		if *outliersFlag != "none" {
+
+			set, err = set.FindOutliers(*outliersFlag, *outlierKFlag)
+			if err != nil {
+				fmt.Printf("Failed to detect outliers: %s\n", err.Error())
+				os.Exit(1)
+			}
+
+			fmt.Printf("%s: %s ms.\n", names[i], set.Outliers)
+
+			if *dropOutliersFlag {
+				set = set.WithoutOutliers()
+			}
+		}
+
+		// Report fairness of runs with several connections.
+		if len(set.Conns) > 1 {
+			ConnectionStats(names[i], set.Conns)
+		}
+
+		groups[run.Subject] = append(groups[run.Subject], set)
+		descs[run.Subject] = append(descs[run.Subject], fmt.Sprintf("%s (%s)", run.Platform, run.Date.Format("2006-01-02 15:04:05")))
 	}
 
-	// Check if tests ran the same command.
-	if dataOneSubject != dataTwoSubject {
-		fmt.Printf("Tests ran different commands.\n")
+	// Check if tests ran the same command, unless
+	// they are meant to be split up by command.
+	if (len(subjects) > 1) && (*facetFlag != true) {
+		fmt.Printf("Tests ran different commands, supply -facet to plot each command separately.\n")
 		os.Exit(1)
 	}
 
-	// If they were the same, set joint subject.
-	dataSubject := dataOneSubject
+	// Build file name from all runs.
+	fileParts := make([]string, len(runs))
+	for i, run := range runs {
+		fileParts[i] = fmt.Sprintf("%s-%s", run.Platform, run.DateRaw)
+	}
 
-	// Set x-axis maximum to bigger of two set values.
-	var xMax float64
-	if len(dataOnePoints) > len(dataTwoPoints) {
-		xMax = float64(len(dataOnePoints))
-	} else {
-		xMax = float64(len(dataTwoPoints))
+	// Scatter plots keep their original file name,
+	// all other kinds get theirs appended.
+	kindSuffix := ""
+	if *kindFlag != "scatter" {
+		kindSuffix = fmt.Sprintf("-%s", *kindFlag)
 	}
 
-	// Prepare time of first test file for printing.
-	dataOneDate, err := time.Parse("2006-01-02-15-04-05", dataOneDateRaw)
-	if err != nil {
-		fmt.Printf("Failed to format date of first log file: %s\n", err.Error())
-		os.Exit(1)
+	fileName := fmt.Sprintf("results/%s-on-%s%s.%s", strings.Join(subjects, "-and-"), strings.Join(fileParts, "-vs-"), kindSuffix, *formatFlag)
+	if *outFlag != "" {
+		fileName = *outFlag
 	}
 
-	// Prepare time of second test file for printing.
-	dataTwoDate, err := time.Parse("2006-01-02-15-04-05", dataTwoDateRaw)
+	width, err := plots.ParseLength(*widthFlag)
 	if err != nil {
-		fmt.Printf("Failed to format date of second log file: %s\n", err.Error())
+		fmt.Printf("Invalid width: %s\n", err.Error())
 		os.Exit(1)
 	}
 
-	// Construct a title for output plot.
-	title := fmt.Sprintf("Command %s: %s (%s) vs. %s (%s)", dataSubject, dataOnePlatform, dataOneDate.Format("2006-01-02 15:04:05"), dataTwoPlatform, dataTwoDate.Format("2006-01-02 15:04:05"))
-
-	// Now create a new plot with custom styling.
-	p, err := PreparePlot(title, xMax, "Message number (id)", "Completion time (ms)")
+	height, err := plots.ParseLength(*heightFlag)
 	if err != nil {
-		fmt.Printf("Failed to initialize new plot: %s\n", err.Error())
+		fmt.Printf("Invalid height: %s\n", err.Error())
 		os.Exit(1)
 	}
 
-	// Add scatter plot based on data set one.
-	scatterOne, err := plotter.NewScatter(dataOnePoints)
-	if err != nil {
-		fmt.Printf("Failed to add scatter plot of first log file to plot: %s\n", err.Error())
-		os.Exit(1)
+	// Apply font settings to all plots.
+	if *fontFlag != "" {
+		plots.TitleFont = *fontFlag
+		plots.LabelFont = *fontFlag
+	}
+	plots.LabelFontSize = vg.Points(*fontSizeFlag)
+	plots.TitleFontSize = vg.Points(*fontSizeFlag + 5)
+
+	opts := plots.Options{
+		Buckets:    *bucketsFlag,
+		Window:     *windowFlag,
+		Percentile: *percentileFlag,
+		PerConn:    *perConnFlag,
 	}
 
-	// Add scatter plot based on data set two.
-	scatterTwo, err := plotter.NewScatter(dataTwoPoints)
-	if err != nil {
-		fmt.Printf("Failed to add scatter plot of second log file to plot: %s\n", err.Error())
-		os.Exit(1)
+	// Draw one plot of requested kind per command, or
+	// per run if the kind only shows one run at a time.
+	ps := make([]*plot.Plot, 0, len(runs))
+	psSets := make([][]plots.DataSet, 0, len(runs))
+	for _, subject := range subjects {
+
+		sets := [][]plots.DataSet{groups[subject]}
+		titles := []string{fmt.Sprintf("Command %s: %s", subject, strings.Join(descs[subject], " vs. "))}
+
+		if plots.SingleSet(*kindFlag) {
+
+			sets = make([][]plots.DataSet, len(groups[subject]))
+			titles = make([]string, len(groups[subject]))
+
+			for i, set := range groups[subject] {
+				sets[i] = []plots.DataSet{set}
+				titles[i] = fmt.Sprintf("Command %s: %s", subject, descs[subject][i])
+			}
+		}
+
+		for i := range sets {
+
+			// Now draw plot of requested kind with custom styling.
+			p, err := plots.New(*kindFlag, titles[i], sets[i], opts)
+			if err != nil {
+				fmt.Printf("Failed to create plot of command %s: %s\n", subject, err.Error())
+				os.Exit(1)
+			}
+
+			ps = append(ps, p)
+			psSets = append(psSets, sets[i])
+		}
 	}
 
-	// Let elements look like crosses and color differently.
-	scatterOne.GlyphStyle.Shape = draw.CrossGlyph{}
-	scatterOne.GlyphStyle.Color = color.RGBA{R: 0, G: 0, B: 184, A: 255}
-	scatterTwo.GlyphStyle.Shape = draw.CrossGlyph{}
-	scatterTwo.GlyphStyle.Color = color.RGBA{R: 239, G: 191, B: 0, A: 255}
+	if len(ps) == 1 {
 
-	// Finally, add scatter plots to prepared canvas plot.
-	p.Add(scatterOne, scatterTwo)
-	p.Legend.Add(dataOnePlatform, scatterOne)
-	p.Legend.Add(dataTwoPlatform, scatterTwo)
+		// Save resulting plot to file.
+		err := plots.Save(ps[0], width, height, fileName)
+		if err != nil {
+			fmt.Printf("Could not save finished plot to file: %s\n", err.Error())
+			os.Exit(1)
+		}
 
-	// Save resulting plot to svg file.
-	err = p.Save((9 * vg.Inch), (9 * vg.Inch), fmt.Sprintf("results/%s-on-%s-%s-vs-%s-%s.svg", dataSubject, dataOnePlatform, dataOneDateRaw, dataTwoPlatform, dataTwoDateRaw))
-	if err != nil {
-		fmt.Printf("Could not save finished plot to file: %s\n", err.Error())
-		os.Exit(1)
+	} else {
+
+		// Save grid of all plots to file.
+		err := plots.SaveGrid(ps, plots.GridColumns(len(ps)), width, height, fileName)
+		if err != nil {
+			fmt.Printf("Could not save finished plot grid to file: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Saved plot to %s.\n", fileName)
+
+	if *pgfFlag {
+
+		base := strings.TrimSuffix(fileName, filepath.Ext(fileName))
+
+		for i, p := range ps {
+
+			// Subplots of a grid get one snippet each.
+			pgfBase := base
+			if len(ps) > 1 {
+				pgfBase = fmt.Sprintf("%s-%d", base, i)
+			}
+
+			series, err := plots.SeriesOf(*kindFlag, psSets[i], opts)
+			if err != nil {
+				fmt.Printf("Could not export plot for pgfplots: %s\n", err.Error())
+				os.Exit(1)
+			}
+
+			err = plots.WritePGF(p, *kindFlag, series, pgfBase)
+			if err != nil {
+				fmt.Printf("Could not export plot for pgfplots: %s\n", err.Error())
+				os.Exit(1)
+			}
+
+			fmt.Printf("Wrote pgfplots snippet %s.tex.\n", pgfBase)
+		}
 	}
 
 	fmt.Printf("\nDone.\n")
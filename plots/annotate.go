@@ -0,0 +1,105 @@
+package plots
+
+import (
+	"fmt"
+	"math"
+
+	"image/color"
+
+	"github.com/gonum/plot"
+	"github.com/gonum/plot/vg"
+	"github.com/gonum/plot/vg/draw"
+)
+
+// Structs
+
+// Region shades the full height of a plot between
+// two values on the x-axis, e.g. to mark commands
+// excluded as warm-up. It implements plot.Plotter
+// and plot.Thumbnailer.
+type Region struct {
+	From  float64
+	To    float64
+	Color color.Color
+}
+
+// Variables
+
+// regionColor is a light grey that does not hide
+// data drawn on top of it.
+var regionColor = color.NRGBA{R: 128, G: 128, B: 128, A: 48}
+
+// Functions
+
+// Plot shades the region on the canvas.
+func (r *Region) Plot(c draw.Canvas, p *plot.Plot) {
+
+	trX, _ := p.Transforms(&c)
+
+	from := trX(math.Max(r.From, p.X.Min))
+	to := trX(math.Min(r.To, p.X.Max))
+
+	if to <= from {
+		return
+	}
+
+	c.FillPolygon(r.Color, []vg.Point{
+		{X: from, Y: c.Min.Y},
+		{X: to, Y: c.Min.Y},
+		{X: to, Y: c.Max.Y},
+		{X: from, Y: c.Max.Y},
+	})
+}
+
+// Thumbnail draws the legend entry of the region.
+func (r *Region) Thumbnail(c *draw.Canvas) {
+
+	c.FillPolygon(r.Color, []vg.Point{
+		{X: c.Min.X, Y: c.Min.Y},
+		{X: c.Max.X, Y: c.Min.Y},
+		{X: c.Max.X, Y: c.Max.Y},
+		{X: c.Min.X, Y: c.Max.Y},
+	})
+}
+
+// annotateWarmup marks the warm-up excluded from any
+// of the sets. Plots over message number or time get
+// the excluded region shaded, all others a legend
+// entry naming the warm-up window.
+func annotateWarmup(p *plot.Plot, kind string, sets []DataSet) {
+
+	var region *Region
+	var label string
+
+	for _, set := range sets {
+
+		if set.Warmup.IsZero() {
+			continue
+		}
+
+		if region == nil {
+			region = &Region{Color: regionColor}
+			label = fmt.Sprintf("warm-up excluded: %s", set.Warmup)
+		}
+
+		switch kind {
+		case "scatter", "conns":
+			region.From = 0.5
+			region.To = math.Max(region.To, (set.WarmupSeq + 0.5))
+		case "throughput", "latency-time":
+			region.To = math.Max(region.To, set.WarmupUntil.Seconds())
+		}
+	}
+
+	if region == nil {
+		return
+	}
+
+	// Region is drawn on top of the data, which
+	// stays visible through its light shade.
+	if region.To > region.From {
+		p.Add(region)
+	}
+
+	p.Legend.Add(label, region)
+}
@@ -0,0 +1,243 @@
+package plots
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/gonum/plot"
+	"github.com/gonum/plot/palette"
+	"github.com/gonum/plot/plotter"
+	"github.com/gonum/plot/vg"
+)
+
+// Structs
+
+// Connection holds the data points of one connection
+// of a concurrent test run. X is the message number
+// and Y the completion time of that command in ms.
+type Connection struct {
+	Conn   int
+	Points plotter.XYs
+}
+
+// connGrid lays out mean completion times of all
+// connections of a run over message number or time.
+// It implements plotter.GridXYZ.
+type connGrid struct {
+	conns  []int
+	cols   int
+	values [][]float64
+	xLabel string
+}
+
+// Functions
+
+// Dims returns number of columns and rows.
+func (g *connGrid) Dims() (int, int) {
+	return g.cols, len(g.conns)
+}
+
+// Z returns mean completion time of a cell.
+func (g *connGrid) Z(c int, r int) float64 {
+	return g.values[r][c]
+}
+
+// X returns message number or second of a column.
+func (g *connGrid) X(c int) float64 {
+	return float64(c)
+}
+
+// Y returns connection number of a row.
+func (g *connGrid) Y(r int) float64 {
+	return float64(g.conns[r])
+}
+
+// newConnGrid builds the grid of a data set. If the
+// set carries timestamped records, columns are seconds
+// since start of the run, otherwise message numbers.
+// Cells without any command are NaN.
+func newConnGrid(set DataSet) (*connGrid, error) {
+
+	if len(set.Conns) == 0 {
+		return nil, fmt.Errorf("no connections in '%s'", set.Name)
+	}
+
+	g := &connGrid{
+		conns:  make([]int, len(set.Conns)),
+		values: make([][]float64, len(set.Conns)),
+	}
+
+	sums := make([][]float64, len(set.Conns))
+	counts := make([][]float64, len(set.Conns))
+	rows := make(map[int]int)
+
+	add := func(row int, col int, value float64) {
+
+		for len(sums[row]) <= col {
+			sums[row] = append(sums[row], 0)
+			counts[row] = append(counts[row], 0)
+		}
+
+		sums[row][col] += value
+		counts[row][col]++
+
+		if (col + 1) > g.cols {
+			g.cols = col + 1
+		}
+	}
+
+	for i, conn := range set.Conns {
+		g.conns[i] = conn.Conn
+		rows[conn.Conn] = i
+	}
+
+	if recs, t0, err := timed(set); err == nil {
+
+		g.xLabel = "Time since start of run (s)"
+
+		for _, rec := range recs {
+
+			row, found := rows[rec.Conn]
+			if found != true {
+				continue
+			}
+
+			add(row, int(rec.Start.Sub(t0)/time.Second), (float64(rec.Latency) / float64(time.Millisecond)))
+		}
+
+	} else {
+
+		g.xLabel = "Message number (id)"
+
+		for i, conn := range set.Conns {
+			for _, point := range conn.Points {
+				add(i, int(point.X), point.Y)
+			}
+		}
+	}
+
+	for r := range g.values {
+
+		g.values[r] = make([]float64, g.cols)
+
+		for c := range g.values[r] {
+
+			if (c < len(counts[r])) && (counts[r][c] > 0) {
+				g.values[r][c] = sums[r][c] / counts[r][c]
+			} else {
+				g.values[r][c] = math.NaN()
+			}
+		}
+	}
+
+	return g, nil
+}
+
+// Connections plots completion time over message
+// number with one line per connection. A single data
+// set gets one color per connection, several data sets
+// keep their color for all of their connections.
+func Connections(title string, sets []DataSet) (*plot.Plot, error) {
+
+	xMax := 1.0
+	for _, set := range sets {
+		for _, conn := range set.Conns {
+
+			if float64(len(conn.Points)) > xMax {
+				xMax = float64(len(conn.Points))
+			}
+		}
+	}
+
+	p, err := PreparePlot(title, xMax, "Message number (id)", "Completion time (ms)")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, set := range sets {
+
+		if len(set.Conns) == 0 {
+			return nil, fmt.Errorf("no connections in '%s', supply a log folder or results file", set.Name)
+		}
+
+		for i, conn := range set.Conns {
+
+			line, err := plotter.NewLine(conn.Points)
+			if err != nil {
+				return nil, fmt.Errorf("failed to add connection %d of '%s': %s", conn.Conn, set.Name, err.Error())
+			}
+
+			line.LineStyle.Width = vg.Points(0.75)
+
+			if len(sets) == 1 {
+				line.LineStyle.Color = ColorOf(i)
+				p.Legend.Add(fmt.Sprintf("conn %d", conn.Conn), line)
+			} else {
+
+				line.LineStyle.Color = ColorOf(set.Style)
+				if i == 0 {
+					p.Legend.Add(set.Name, line)
+				}
+			}
+
+			p.Add(line)
+		}
+	}
+
+	return p, nil
+}
+
+// Heatmap colors mean completion time per connection
+// and message number, or per second if timestamps are
+// known, so that stragglers stand out. It draws a
+// single data set.
+func Heatmap(title string, sets []DataSet) (*plot.Plot, error) {
+
+	if len(sets) != 1 {
+		return nil, fmt.Errorf("heatmaps show one run at a time, got %d", len(sets))
+	}
+
+	g, err := newConnGrid(sets[0])
+	if err != nil {
+		return nil, err
+	}
+
+	// Determine range of colored values.
+	min := math.Inf(1)
+	max := math.Inf(-1)
+
+	for r := range g.values {
+		for _, value := range g.values[r] {
+
+			if math.IsNaN(value) {
+				continue
+			}
+
+			min = math.Min(min, value)
+			max = math.Max(max, value)
+		}
+	}
+
+	if math.IsInf(min, 1) {
+		return nil, fmt.Errorf("no completion times in '%s'", sets[0].Name)
+	}
+
+	p, err := PreparePlot(title, float64(g.cols), fmt.Sprintf("%s, color: completion time %.2f ms (dark) to %.2f ms (bright)", g.xLabel, min, max), "Connection")
+	if err != nil {
+		return nil, err
+	}
+
+	p.X.Min = -0.5
+	p.X.Max = float64(g.cols) - 0.5
+	p.Y.Min = float64(g.conns[0]) - 0.5
+	p.Y.Max = float64(g.conns[(len(g.conns)-1)]) + 0.5
+
+	heat := plotter.NewHeatMap(g, palette.Heat(12, 1))
+	heat.Min = min
+	heat.Max = max
+
+	p.Add(heat)
+
+	return p, nil
+}
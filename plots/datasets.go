@@ -0,0 +1,99 @@
+package plots
+
+import (
+	"sort"
+	"time"
+
+	"github.com/gonum/plot/plotter"
+	"github.com/numbleroot/pluto-evaluation/records"
+)
+
+// Functions
+
+// RecordConnections turns successful records into
+// data points of message number against completion
+// time in ms, one series per connection.
+func RecordConnections(recs []records.Record) []Connection {
+
+	split := make(map[int][]records.Record)
+
+	for _, rec := range recs {
+
+		if rec.Status == "OK" {
+			split[rec.Conn] = append(split[rec.Conn], rec)
+		}
+	}
+
+	conns := make([]Connection, 0, len(split))
+	for conn, connRecs := range split {
+
+		sort.Slice(connRecs, func(i, j int) bool {
+			return connRecs[i].Seq < connRecs[j].Seq
+		})
+
+		points := make(plotter.XYs, len(connRecs))
+		for i, rec := range connRecs {
+			points[i].X = float64(rec.Seq)
+			points[i].Y = float64(rec.Latency) / float64(time.Millisecond)
+		}
+
+		conns = append(conns, Connection{
+			Conn:   conn,
+			Points: points,
+		})
+	}
+
+	sort.Slice(conns, func(i, j int) bool {
+		return conns[i].Conn < conns[j].Conn
+	})
+
+	return conns
+}
+
+// AverageConnections averages completion times of each
+// message number over all connections that sent it, so
+// that connections of different length do not shift
+// values onto wrong message numbers.
+func AverageConnections(conns []Connection) plotter.XYs {
+
+	sums := make(map[float64]float64)
+	counts := make(map[float64]float64)
+	ids := make([]float64, 0, 100)
+
+	for _, conn := range conns {
+		for _, point := range conn.Points {
+
+			if _, found := sums[point.X]; found != true {
+				ids = append(ids, point.X)
+			}
+
+			sums[point.X] += point.Y
+			counts[point.X]++
+		}
+	}
+
+	sort.Float64s(ids)
+
+	points := make(plotter.XYs, len(ids))
+	for i, id := range ids {
+		points[i].X = id
+		points[i].Y = sums[id] / counts[id]
+	}
+
+	return points
+}
+
+// FromRecords builds a data set from all records of
+// one run, keeping timestamps and connections.
+func FromRecords(name string, style int, recs []records.Record) DataSet {
+
+	conns := RecordConnections(recs)
+
+	return DataSet{
+		Name:    name,
+		Style:   style,
+		Points:  AverageConnections(conns),
+		Records: recs,
+		Conns:   conns,
+	}
+}
@@ -0,0 +1,296 @@
+package plots
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/gonum/plot"
+	"github.com/gonum/plot/plotter"
+	"github.com/gonum/plot/vg"
+	"github.com/gonum/plot/vg/draw"
+	"github.com/numbleroot/pluto-evaluation/stats"
+)
+
+// Functions
+
+// maxValue returns the largest completion time
+// found in any of the data sets.
+func maxValue(sets []DataSet) float64 {
+
+	max := 0.0
+
+	for _, set := range sets {
+		for _, point := range set.Points {
+
+			if point.Y > max {
+				max = point.Y
+			}
+		}
+	}
+
+	return max
+}
+
+// CDFPoints returns the empirical cumulative
+// distribution function of completion times of a set.
+func CDFPoints(set DataSet) plotter.XYs {
+
+	sorted := stats.Sorted(set.Values())
+
+	// Each completion time is reached by the
+	// fraction of commands at most as slow.
+	points := make(plotter.XYs, len(sorted))
+	for u := range sorted {
+		points[u].X = sorted[u]
+		points[u].Y = float64(u+1) / float64(len(sorted))
+	}
+
+	return points
+}
+
+// CDF plots the empirical cumulative distribution
+// function of completion times of every data set.
+func CDF(title string, sets []DataSet) (*plot.Plot, error) {
+
+	p, err := PreparePlot(title, maxValue(sets), "Completion time (ms)", "Fraction of commands completed")
+	if err != nil {
+		return nil, err
+	}
+
+	p.X.Min = 0.0
+	p.Y.Max = 1.0
+
+	for _, set := range sets {
+
+		line, err := plotter.NewLine(CDFPoints(set))
+		if err != nil {
+			return nil, fmt.Errorf("failed to add CDF of '%s': %s", set.Name, err.Error())
+		}
+
+		line.LineStyle.Color = ColorOf(set.Style)
+		line.LineStyle.Width = vg.Points(1.5)
+
+		p.Add(line)
+		p.Legend.Add(set.Name, line)
+	}
+
+	return p, nil
+}
+
+// LogBuckets splits the range of positive values from
+// min to max into n buckets of equal width on a log
+// scale and counts values of set falling into each.
+func LogBuckets(values plotter.Values, min float64, max float64, n int) []plotter.HistogramBin {
+
+	logMin := math.Log10(min)
+	step := (math.Log10(max) - logMin) / float64(n)
+
+	bins := make([]plotter.HistogramBin, n)
+	for i := range bins {
+		bins[i].Min = math.Pow(10, (logMin + (float64(i) * step)))
+		bins[i].Max = math.Pow(10, (logMin + (float64(i+1) * step)))
+	}
+
+	for _, value := range values {
+
+		if value < min {
+			continue
+		}
+
+		i := int((math.Log10(value) - logMin) / step)
+		if i >= n {
+			i = n - 1
+		}
+
+		bins[i].Weight++
+	}
+
+	return bins
+}
+
+// HistogramBins splits completion times of all sets
+// into the same logarithmically growing buckets and
+// returns the bins of each set, together with the
+// smallest positive and the largest completion time.
+func HistogramBins(sets []DataSet, buckets int) ([][]plotter.HistogramBin, float64, float64, error) {
+
+	if buckets < 1 {
+		buckets = 40
+	}
+
+	// Determine smallest positive and largest value.
+	min := math.Inf(1)
+	max := maxValue(sets)
+
+	for _, set := range sets {
+		for _, point := range set.Points {
+
+			if (point.Y > 0) && (point.Y < min) {
+				min = point.Y
+			}
+		}
+	}
+
+	if (math.IsInf(min, 1)) || (max <= min) {
+		return nil, 0, 0, fmt.Errorf("not enough distinct positive values to draw a histogram")
+	}
+
+	bins := make([][]plotter.HistogramBin, len(sets))
+	for i, set := range sets {
+		bins[i] = LogBuckets(set.Values(), min, max, buckets)
+	}
+
+	return bins, min, max, nil
+}
+
+// Histogram plots number of commands per completion
+// time bucket for every data set. Buckets grow
+// logarithmically so that long tails remain visible.
+func Histogram(title string, sets []DataSet, buckets int) (*plot.Plot, error) {
+
+	bins, min, max, err := HistogramBins(sets, buckets)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := PreparePlot(title, max, "Completion time (ms, log scale)", "Number of commands")
+	if err != nil {
+		return nil, err
+	}
+
+	p.X.Min = min
+	p.X.Scale = plot.LogScale{}
+	p.X.Tick.Marker = plot.LogTicks{}
+
+	for i, set := range sets {
+
+		// Buckets only share their width on the log
+		// scale, Width names the narrowest one.
+		hist := &plotter.Histogram{
+			Bins:      bins[i],
+			Width:     (bins[i][0].Max - bins[i][0].Min),
+			FillColor: transparent(ColorOf(set.Style)),
+			LineStyle: plotter.DefaultLineStyle,
+		}
+		hist.LineStyle.Color = ColorOf(set.Style)
+
+		p.Add(hist)
+		p.Legend.Add(set.Name, hist)
+	}
+
+	return p, nil
+}
+
+// names returns the names of all data sets.
+func names(sets []DataSet) []string {
+
+	names := make([]string, len(sets))
+	for i := range sets {
+		names[i] = sets[i].Name
+	}
+
+	return names
+}
+
+// BoxPlot draws one box plot per data set side by side.
+func BoxPlot(title string, sets []DataSet) (*plot.Plot, error) {
+
+	p, err := PreparePlot(title, (float64(len(sets)) - 0.5), "", "Completion time (ms)")
+	if err != nil {
+		return nil, err
+	}
+
+	p.X.Min = -0.5
+
+	for i, set := range sets {
+
+		box, err := plotter.NewBoxPlot(vg.Points(40), float64(i), set.Values())
+		if err != nil {
+			return nil, fmt.Errorf("failed to add box plot of '%s': %s", set.Name, err.Error())
+		}
+
+		box.FillColor = transparent(ColorOf(set.Style))
+
+		p.Add(box)
+	}
+
+	p.NominalX(names(sets)...)
+
+	return p, nil
+}
+
+// Violin draws the estimated density of completion
+// times of each data set mirrored around its position,
+// side by side, with the median marked.
+func Violin(title string, sets []DataSet) (*plot.Plot, error) {
+
+	p, err := PreparePlot(title, (float64(len(sets)) - 0.5), "", "Completion time (ms)")
+	if err != nil {
+		return nil, err
+	}
+
+	p.X.Min = -0.5
+
+	// Evaluate density at this many points per set.
+	steps := 100
+
+	for i, set := range sets {
+
+		values := set.Values()
+		if len(values) < 2 {
+			return nil, fmt.Errorf("not enough values in '%s' to draw a violin", set.Name)
+		}
+
+		sorted := stats.Sorted(values)
+		min := sorted[0]
+		max := sorted[(len(sorted) - 1)]
+
+		points := make([]float64, steps)
+		for u := range points {
+			points[u] = min + ((max - min) * (float64(u) / float64(steps-1)))
+		}
+
+		densities := stats.KernelDensity(values, points, stats.Bandwidth(values))
+
+		// Scale widest part of violin to 0.4 so that
+		// neighbouring violins do not touch.
+		maxDensity := 0.0
+		for _, d := range densities {
+			maxDensity = math.Max(maxDensity, d)
+		}
+
+		outline := make(plotter.XYs, (2 * steps))
+		for u := 0; u < steps; u++ {
+
+			width := 0.4 * (densities[u] / maxDensity)
+
+			outline[u].X = float64(i) - width
+			outline[u].Y = points[u]
+			outline[((2 * steps) - 1 - u)].X = float64(i) + width
+			outline[((2 * steps) - 1 - u)].Y = points[u]
+		}
+
+		violin, err := plotter.NewPolygon(outline)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add violin of '%s': %s", set.Name, err.Error())
+		}
+
+		violin.Color = transparent(ColorOf(set.Style))
+		violin.LineStyle.Color = ColorOf(set.Style)
+
+		// Mark median of set.
+		median, err := plotter.NewScatter(plotter.XYs{{X: float64(i), Y: stats.Percentile(sorted, 50.0)}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to add median of '%s': %s", set.Name, err.Error())
+		}
+
+		median.GlyphStyle.Shape = draw.CircleGlyph{}
+		median.GlyphStyle.Color = ColorOf(set.Style)
+
+		p.Add(violin, median)
+	}
+
+	p.NominalX(names(sets)...)
+
+	return p, nil
+}
@@ -0,0 +1,4 @@
+/*
+Package plots turns parsed test results into styled plots of different kinds.
+*/
+package plots
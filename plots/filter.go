@@ -0,0 +1,171 @@
+package plots
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gonum/plot/plotter"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+)
+
+// Functions
+
+// WithoutWarmup returns the data set without commands
+// in supplied warm-up window and the number of commands
+// excluded. The returned set remembers the excluded
+// region so that plots can mark it. Sets read from
+// legacy log files only support count-based warm-up.
+func (d DataSet) WithoutWarmup(w records.Warmup) (DataSet, int, error) {
+
+	if w.IsZero() {
+		return d, 0, nil
+	}
+
+	if len(d.Records) == 0 {
+
+		if w.Duration > 0 {
+			return d, 0, fmt.Errorf("time-based warm-up needs timestamped results for '%s', supply its results file instead of the log", d.Name)
+		}
+
+		// Drop first commands of each connection.
+		excluded := 0
+		conns := make([]Connection, len(d.Conns))
+
+		for i, conn := range d.Conns {
+
+			conns[i].Conn = conn.Conn
+			conns[i].Points = make(plotter.XYs, 0, len(conn.Points))
+
+			for _, point := range conn.Points {
+
+				if point.X <= float64(w.Count) {
+					excluded++
+					continue
+				}
+
+				conns[i].Points = append(conns[i].Points, point)
+			}
+		}
+
+		d.Conns = conns
+		d.Points = AverageConnections(conns)
+		d.Warmup = w
+		d.WarmupSeq = float64(w.Count)
+
+		return d, excluded, nil
+	}
+
+	measured, excluded, err := w.Split(d.Records)
+	if err != nil {
+		return d, 0, err
+	}
+
+	// Keep start of run so that plots over time
+	// still begin at the start of the warm-up.
+	start := d.Records[0].Start
+	for _, rec := range d.Records {
+
+		if rec.Start.Before(start) {
+			start = rec.Start
+		}
+	}
+
+	filtered := FromRecords(d.Name, d.Style, measured)
+	filtered.Start = start
+	filtered.Warmup = w
+
+	for _, rec := range excluded {
+
+		if float64(rec.Seq) > filtered.WarmupSeq {
+			filtered.WarmupSeq = float64(rec.Seq)
+		}
+
+		if rec.Start.Sub(start) > filtered.WarmupUntil {
+			filtered.WarmupUntil = rec.Start.Sub(start)
+		}
+	}
+
+	if w.Duration > filtered.WarmupUntil {
+		filtered.WarmupUntil = w.Duration
+	}
+
+	return filtered, len(excluded), nil
+}
+
+// FindOutliers detects outliers among the completion
+// times of all connections of the data set and stores
+// them in it.
+func (d DataSet) FindOutliers(method string, k float64) (DataSet, error) {
+
+	values := d.Values()
+
+	if len(d.Conns) > 1 {
+
+		values = make([]float64, 0, len(d.Points))
+		for _, conn := range d.Conns {
+			for _, point := range conn.Points {
+				values = append(values, point.Y)
+			}
+		}
+	}
+
+	o, err := stats.DetectOutliers(values, method, k)
+	if err != nil {
+		return d, err
+	}
+
+	d.Outliers = &o
+
+	return d, nil
+}
+
+// WithoutOutliers returns the data set without all
+// commands previously found to be outliers.
+func (d DataSet) WithoutOutliers() DataSet {
+
+	if (d.Outliers == nil) || (d.Outliers.Count() == 0) {
+		return d
+	}
+
+	keep := func(points plotter.XYs) plotter.XYs {
+
+		kept := make(plotter.XYs, 0, len(points))
+		for _, point := range points {
+
+			if d.Outliers.IsOutlier(point.Y) != true {
+				kept = append(kept, point)
+			}
+		}
+
+		return kept
+	}
+
+	if len(d.Records) > 0 {
+
+		recs := make([]records.Record, 0, len(d.Records))
+		for _, rec := range d.Records {
+
+			if (rec.Status == "OK") && d.Outliers.IsOutlier(float64(rec.Latency)/float64(time.Millisecond)) {
+				continue
+			}
+
+			recs = append(recs, rec)
+		}
+
+		d.Records = recs
+	}
+
+	conns := make([]Connection, len(d.Conns))
+	for i, conn := range d.Conns {
+		conns[i] = Connection{
+			Conn:   conn.Conn,
+			Points: keep(conn.Points),
+		}
+	}
+
+	d.Conns = conns
+	d.Points = keep(d.Points)
+
+	return d
+}
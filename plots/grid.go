@@ -0,0 +1,68 @@
+package plots
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/gonum/plot"
+	"github.com/gonum/plot/vg"
+	"github.com/gonum/plot/vg/draw"
+)
+
+// Functions
+
+// GridColumns returns the number of columns of a
+// roughly square grid holding n plots.
+func GridColumns(n int) int {
+
+	cols := int(math.Ceil(math.Sqrt(float64(n))))
+	if cols < 1 {
+		cols = 1
+	}
+
+	return cols
+}
+
+// SaveGrid draws all plots row by row into a grid with
+// supplied number of columns. Each tile is width by
+// height in size. The extension of fileName selects
+// the format of the grid, see Formats.
+func SaveGrid(ps []*plot.Plot, cols int, width vg.Length, height vg.Length, fileName string) error {
+
+	rows := int(math.Ceil(float64(len(ps)) / float64(cols)))
+
+	// Create one canvas large enough for all tiles.
+	c, err := NewCanvas(FormatOf(fileName), (vg.Length(cols) * width), (vg.Length(rows) * height))
+	if err != nil {
+		return err
+	}
+	dc := draw.New(c)
+
+	tiles := draw.Tiles{
+		Rows:      rows,
+		Cols:      cols,
+		PadX:      vg.Centimeter,
+		PadY:      vg.Centimeter,
+		PadTop:    vg.Centimeter,
+		PadBottom: vg.Centimeter,
+		PadLeft:   vg.Centimeter,
+		PadRight:  vg.Centimeter,
+	}
+
+	for i, p := range ps {
+		p.Draw(tiles.At(dc, (i % cols), (i / cols)))
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create grid file: %s", err.Error())
+	}
+	defer file.Close()
+
+	if _, err := c.WriteTo(file); err != nil {
+		return fmt.Errorf("failed to write grid: %s", err.Error())
+	}
+
+	return nil
+}
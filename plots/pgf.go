@@ -0,0 +1,222 @@
+package plots
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/gonum/plot"
+	"github.com/gonum/plot/plotter"
+	"github.com/numbleroot/pluto-evaluation/records"
+)
+
+// Structs
+
+// Series is one line, set of marks or histogram of a
+// plot in a form that can be handed to pgfplots.
+type Series struct {
+	Name   string
+	Style  int
+	Draw   string
+	Points plotter.XYs
+}
+
+// Variables
+
+// PGFKinds lists all kinds of plots that can be
+// exported as pgfplots data tables.
+var PGFKinds = []string{"scatter", "cdf", "hist", "throughput", "latency-time", "conns"}
+
+// pgfDraw maps how a series is drawn to the options
+// of its pgfplots '\addplot' command.
+var pgfDraw = map[string]string{
+	"marks": "only marks, mark=x",
+	"line":  "no markers, thick",
+	"thin":  "no markers, very thin, opacity=0.4, forget plot",
+	"bars":  "ybar interval, fill opacity=0.4",
+}
+
+// texEscaper escapes characters with special
+// meaning in LaTeX.
+var texEscaper = strings.NewReplacer(
+	`\`, `\textbackslash{}`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`%`, `\%`,
+	`&`, `\&`,
+	`#`, `\#`,
+	`$`, `\$`,
+	`_`, `\_`,
+	`^`, `\^{}`,
+	`~`, `\~{}`,
+)
+
+// Functions
+
+// SeriesOf computes the series a plot of supplied
+// kind draws for all sets.
+func SeriesOf(kind string, sets []DataSet, opts Options) ([]Series, error) {
+
+	opts = opts.withDefaults()
+	series := make([]Series, 0, len(sets))
+
+	switch kind {
+
+	case "scatter":
+
+		for _, set := range sets {
+			series = append(series, Series{set.Name, set.Style, "marks", set.Points})
+		}
+
+	case "cdf":
+
+		for _, set := range sets {
+			series = append(series, Series{set.Name, set.Style, "line", CDFPoints(set)})
+		}
+
+	case "hist":
+
+		bins, _, _, err := HistogramBins(sets, opts.Buckets)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, set := range sets {
+
+			// An interval bar needs the end of the last
+			// bin as additional point.
+			points := make(plotter.XYs, (len(bins[i]) + 1))
+			for u, bin := range bins[i] {
+				points[u].X = bin.Min
+				points[u].Y = bin.Weight
+			}
+
+			last := bins[i][(len(bins[i]) - 1)]
+			points[len(bins[i])].X = last.Max
+			points[len(bins[i])].Y = last.Weight
+
+			series = append(series, Series{set.Name, set.Style, "bars", points})
+		}
+
+	case "throughput", "latency-time":
+
+		for _, set := range sets {
+
+			recs, t0, err := timed(set)
+			if err != nil {
+				return nil, err
+			}
+
+			compute := func(recs []records.Record) plotter.XYs {
+
+				if kind == "throughput" {
+					return ThroughputSeries(recs, t0)
+				}
+
+				return LatencySeries(recs, t0, opts.Window, opts.Percentile)
+			}
+
+			conns, split := byConn(recs)
+			if opts.PerConn && (len(conns) > 1) {
+
+				for _, conn := range conns {
+					series = append(series, Series{fmt.Sprintf("%s conn %d", set.Name, conn), set.Style, "thin", compute(split[conn])})
+				}
+			}
+
+			series = append(series, Series{set.Name, set.Style, "line", compute(recs)})
+		}
+
+	case "conns":
+
+		for _, set := range sets {
+			for i, conn := range set.Conns {
+
+				// As in the plot, connections of a single
+				// set are told apart by color.
+				style := set.Style
+				if len(sets) == 1 {
+					style = i
+				}
+
+				series = append(series, Series{fmt.Sprintf("%s conn %d", set.Name, conn.Conn), style, "line", conn.Points})
+			}
+		}
+
+	default:
+		return nil, fmt.Errorf("kind '%s' cannot be exported for pgfplots, choose one of %v", kind, PGFKinds)
+	}
+
+	return series, nil
+}
+
+// TeXEscape escapes text for use in LaTeX documents.
+func TeXEscape(text string) string {
+	return texEscaper.Replace(text)
+}
+
+// WritePGF stores each series as whitespace-separated
+// data table 'base-N.dat' and writes 'base.tex', a
+// tikzpicture drawing them with pgfplots, titled and
+// labeled like supplied plot.
+func WritePGF(p *plot.Plot, kind string, series []Series, base string) error {
+
+	var tex bytes.Buffer
+
+	axisOptions := []string{
+		fmt.Sprintf("title={%s}", TeXEscape(p.Title.Text)),
+		fmt.Sprintf("xlabel={%s}", TeXEscape(p.X.Label.Text)),
+		fmt.Sprintf("ylabel={%s}", TeXEscape(p.Y.Label.Text)),
+		"width=\\linewidth",
+		"legend pos=outer north east",
+		"legend cell align=left",
+	}
+
+	if kind == "hist" {
+		axisOptions = append(axisOptions, "xmode=log")
+	}
+
+	fmt.Fprintf(&tex, "%% Generated by plot-results. Requires \\usepackage{pgfplots}.\n")
+	fmt.Fprintf(&tex, "%% Data tables are expected next to the document including this file.\n")
+	fmt.Fprintf(&tex, "\\begin{tikzpicture}\n\\begin{axis}[\n\t%s,\n]\n", strings.Join(axisOptions, ",\n\t"))
+
+	for i, s := range series {
+
+		dataFileName := fmt.Sprintf("%s-%d.dat", base, i)
+
+		var data bytes.Buffer
+		fmt.Fprintf(&data, "x y\n")
+		for _, point := range s.Points {
+			fmt.Fprintf(&data, "%g %g\n", point.X, point.Y)
+		}
+
+		err := ioutil.WriteFile(dataFileName, data.Bytes(), 0644)
+		if err != nil {
+			return fmt.Errorf("failed to write data table '%s': %s", dataFileName, err.Error())
+		}
+
+		c := ColorOf(s.Style)
+		r, g, b, _ := c.RGBA()
+
+		fmt.Fprintf(&tex, "\\addplot+[%s, color={rgb,255:red,%d;green,%d;blue,%d}] table {%s};\n",
+			pgfDraw[s.Draw], (r >> 8), (g >> 8), (b >> 8), filepath.Base(dataFileName))
+
+		if s.Draw != "thin" {
+			fmt.Fprintf(&tex, "\\addlegendentry{%s}\n", TeXEscape(s.Name))
+		}
+	}
+
+	fmt.Fprintf(&tex, "\\end{axis}\n\\end{tikzpicture}\n")
+
+	texFileName := fmt.Sprintf("%s.tex", base)
+
+	err := ioutil.WriteFile(texFileName, tex.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write pgfplots snippet '%s': %s", texFileName, err.Error())
+	}
+
+	return nil
+}
@@ -0,0 +1,299 @@
+package plots
+
+import (
+	"fmt"
+	"time"
+
+	"image/color"
+
+	"github.com/gonum/plot"
+	"github.com/gonum/plot/plotter"
+	"github.com/gonum/plot/vg"
+	"github.com/gonum/plot/vg/draw"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+)
+
+// Structs
+
+// DataSet holds one test run or target to be plotted
+// under Name, drawn in color and glyph Style in every
+// plot. Points pairs each message number with the
+// completion time of its command in ms, averaged over
+// all connections of a concurrent run, whose own
+// series are kept in Conns. Records provide the
+// absolute timestamps that plots over time need, if
+// the results carry them. If a warm-up as defined by
+// Warmup was excluded from Points, it ended at message
+// number WarmupSeq or WarmupUntil after Start, the
+// beginning of the run including the warm-up. Outliers
+// is set once they were detected.
+type DataSet struct {
+	Name        string
+	Style       int
+	Points      plotter.XYs
+	Records     []records.Record
+	Conns       []Connection
+	Start       time.Time
+	Warmup      records.Warmup
+	WarmupSeq   float64
+	WarmupUntil time.Duration
+	Outliers    *stats.Outliers
+}
+
+// Options carries settings specific to some kinds
+// of plots.
+type Options struct {
+	Buckets    int
+	Window     time.Duration
+	Percentile float64
+	PerConn    bool
+}
+
+// Variables
+
+// TitleFont, LabelFont and their sizes style the text
+// of all plots. They may be changed before plotting,
+// e.g. to match the body font of a paper.
+var TitleFont = "Helvetica"
+var TitleFontSize = vg.Points(16)
+var LabelFont = "Courier"
+var LabelFontSize = vg.Points(11)
+
+// Kinds lists all kinds of plots New can draw.
+var Kinds = []string{"scatter", "cdf", "hist", "box", "violin", "throughput", "latency-time", "conns", "heatmap"}
+
+// Colors are assigned to data sets in order.
+var Colors = []color.Color{
+	color.RGBA{R: 0, G: 0, B: 184, A: 255},
+	color.RGBA{R: 239, G: 191, B: 0, A: 255},
+	color.RGBA{R: 204, G: 37, B: 41, A: 255},
+	color.RGBA{R: 62, G: 150, B: 81, A: 255},
+	color.RGBA{R: 107, G: 76, B: 154, A: 255},
+	color.RGBA{R: 146, G: 36, B: 40, A: 255},
+	color.RGBA{R: 83, G: 81, B: 84, A: 255},
+	color.RGBA{R: 218, G: 124, B: 48, A: 255},
+}
+
+// Glyphs are assigned to data sets in order. Their
+// number differs from the one of colors so that the
+// combination stays unique for many more data sets.
+var Glyphs = []draw.GlyphDrawer{
+	draw.CrossGlyph{},
+	draw.CircleGlyph{},
+	draw.TriangleGlyph{},
+	draw.SquareGlyph{},
+	draw.PlusGlyph{},
+	draw.RingGlyph{},
+	draw.PyramidGlyph{},
+}
+
+// Functions
+
+// ColorOf returns the color of the i-th data set.
+func ColorOf(i int) color.Color {
+	return Colors[(i % len(Colors))]
+}
+
+// GlyphOf returns the glyph of the i-th data set.
+func GlyphOf(i int) draw.GlyphDrawer {
+	return Glyphs[(i % len(Glyphs))]
+}
+
+// transparent returns c with reduced opacity so that
+// overlapping areas of different data sets stay visible.
+func transparent(c color.Color) color.Color {
+
+	r, g, b, _ := c.RGBA()
+
+	return color.NRGBA{R: uint8(r >> 8), G: uint8(g >> 8), B: uint8(b >> 8), A: 96}
+}
+
+// Values returns the completion times of a data set.
+func (d DataSet) Values() plotter.Values {
+
+	values := make(plotter.Values, len(d.Points))
+	for i := range d.Points {
+		values[i] = d.Points[i].Y
+	}
+
+	return values
+}
+
+// PreparePlot initializes a new plot with acceptable
+// styling defaults and returns it.
+func PreparePlot(title string, xMax float64, xLabel string, yLabel string) (*plot.Plot, error) {
+
+	// Use Helvetica in big size for title by default.
+	bigFont, err := vg.MakeFont(TitleFont, TitleFontSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Use Courier in small size for all labels by default.
+	smallFont, err := vg.MakeFont(LabelFont, LabelFontSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create an empty plot.
+	p, err := plot.New()
+	if err != nil {
+		return nil, err
+	}
+
+	// Set title of plot and its style.
+	p.Title.Text = title
+	p.Title.Padding = 1 * vg.Centimeter
+	p.Title.Font = bigFont
+
+	// Style x-axis a bit.
+	p.X.Min = 1.0
+	p.X.Max = xMax
+	p.X.Label.Text = xLabel
+	p.X.Label.Font = smallFont
+	p.X.Padding = 0.2 * vg.Centimeter
+	p.X.Tick.Label.Font = smallFont
+
+	// Style y-axis a bit.
+	p.Y.Min = 0.0
+	p.Y.Label.Text = yLabel
+	p.Y.Label.Font = smallFont
+	p.Y.Padding = 0.1 * vg.Centimeter
+	p.Y.Tick.Label.Font = smallFont
+
+	// Style legend a bit.
+	p.Legend.Font = smallFont
+
+	return p, nil
+}
+
+// withDefaults fills in settings left empty.
+func (o Options) withDefaults() Options {
+
+	if o.Buckets < 1 {
+		o.Buckets = 40
+	}
+
+	if o.Window <= 0 {
+		o.Window = time.Second
+	}
+
+	if o.Percentile <= 0 {
+		o.Percentile = 99.0
+	}
+
+	return o
+}
+
+// SingleSet reports whether plots of supplied kind
+// can only show one data set each.
+func SingleSet(kind string) bool {
+	return kind == "heatmap"
+}
+
+// New draws a plot of supplied kind over all sets
+// and marks any warm-up excluded from them.
+func New(kind string, title string, sets []DataSet, opts Options) (*plot.Plot, error) {
+
+	var p *plot.Plot
+	var err error
+
+	switch kind {
+	case "scatter":
+		p, err = Scatter(title, sets)
+	case "cdf":
+		p, err = CDF(title, sets)
+	case "hist":
+		p, err = Histogram(title, sets, opts.Buckets)
+	case "box":
+		p, err = BoxPlot(title, sets)
+	case "violin":
+		p, err = Violin(title, sets)
+	case "throughput":
+		p, err = Throughput(title, sets, opts)
+	case "latency-time":
+		p, err = LatencyOverTime(title, sets, opts)
+	case "conns":
+		p, err = Connections(title, sets)
+	case "heatmap":
+		p, err = Heatmap(title, sets)
+	default:
+		return nil, fmt.Errorf("unknown kind of plot '%s', choose one of %v", kind, Kinds)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	annotateWarmup(p, kind, sets)
+
+	return p, nil
+}
+
+// Scatter plots message number against completion
+// time for every data set.
+func Scatter(title string, sets []DataSet) (*plot.Plot, error) {
+
+	// Set x-axis maximum to biggest of all set values.
+	xMax := 1.0
+	for _, set := range sets {
+
+		if float64(len(set.Points)) > xMax {
+			xMax = float64(len(set.Points))
+		}
+	}
+
+	// Now create a new plot with custom styling.
+	p, err := PreparePlot(title, xMax, "Message number (id)", "Completion time (ms)")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, set := range sets {
+
+		// Add scatter plot based on data set.
+		scatter, err := plotter.NewScatter(set.Points)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add scatter plot of '%s': %s", set.Name, err.Error())
+		}
+
+		// Let elements of each set look and color differently.
+		scatter.GlyphStyle.Shape = GlyphOf(set.Style)
+		scatter.GlyphStyle.Color = ColorOf(set.Style)
+
+		p.Add(scatter)
+		p.Legend.Add(set.Name, scatter)
+
+		if (set.Outliers == nil) || (set.Outliers.Count() == 0) {
+			continue
+		}
+
+		// Circle outliers still contained in set.
+		outliers := make(plotter.XYs, 0, set.Outliers.Count())
+		for _, point := range set.Points {
+
+			if set.Outliers.IsOutlier(point.Y) {
+				outliers = append(outliers, point)
+			}
+		}
+
+		if len(outliers) == 0 {
+			continue
+		}
+
+		marks, err := plotter.NewScatter(outliers)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add outliers of '%s': %s", set.Name, err.Error())
+		}
+
+		marks.GlyphStyle.Shape = draw.RingGlyph{}
+		marks.GlyphStyle.Radius = vg.Points(6)
+		marks.GlyphStyle.Color = ColorOf(set.Style)
+
+		p.Add(marks)
+		p.Legend.Add(fmt.Sprintf("%s outliers (%s)", set.Name, set.Outliers.Method), marks)
+	}
+
+	return p, nil
+}
@@ -0,0 +1,127 @@
+package plots
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"path/filepath"
+
+	"github.com/gonum/plot"
+	"github.com/gonum/plot/vg"
+	"github.com/gonum/plot/vg/vgeps"
+	"github.com/gonum/plot/vg/vgimg"
+	"github.com/gonum/plot/vg/vgpdf"
+	"github.com/gonum/plot/vg/vgsvg"
+)
+
+// Structs
+
+// writerCanvas is a canvas of known size that can
+// write itself out in its format.
+type writerCanvas interface {
+	vg.CanvasSizer
+	io.WriterTo
+}
+
+// Variables
+
+// Formats lists all output formats plots can be
+// saved in.
+var Formats = []string{"svg", "png", "pdf", "eps"}
+
+// units maps suffixes accepted by ParseLength
+// to their length.
+var units = map[string]vg.Length{
+	"in": vg.Inch,
+	"cm": vg.Centimeter,
+	"mm": vg.Millimeter,
+	"pt": vg.Points(1),
+}
+
+// Functions
+
+// FormatOf returns the output format of fileName,
+// taken from its extension.
+func FormatOf(fileName string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(fileName), "."))
+}
+
+// NewCanvas creates an empty canvas of supplied size
+// drawing in supplied format.
+func NewCanvas(format string, width vg.Length, height vg.Length) (writerCanvas, error) {
+
+	switch format {
+	case "svg":
+		return vgsvg.New(width, height), nil
+	case "png":
+		return vgimg.PngCanvas{Canvas: vgimg.New(width, height)}, nil
+	case "pdf":
+		return vgpdf.New(width, height), nil
+	case "eps":
+		return vgeps.New(width, height), nil
+	}
+
+	return nil, fmt.Errorf("unsupported output format '%s', choose one of %v", format, Formats)
+}
+
+// ParseLength parses a length such as '9in', '20cm',
+// '150mm' or '400pt'. Plain numbers are taken as inches.
+func ParseLength(length string) (vg.Length, error) {
+
+	number := strings.TrimSpace(length)
+	unit := vg.Inch
+
+	for suffix, u := range units {
+
+		if strings.HasSuffix(number, suffix) {
+			number = strings.TrimSuffix(number, suffix)
+			unit = u
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if (err != nil) || (value <= 0) {
+		return 0, fmt.Errorf("invalid length '%s', use e.g. 9in, 20cm, 150mm or 400pt", length)
+	}
+
+	return vg.Length(value) * unit, nil
+}
+
+// Save writes a single plot to fileName, in the
+// format given by its extension.
+func Save(p *plot.Plot, width vg.Length, height vg.Length, fileName string) error {
+
+	format := FormatOf(fileName)
+
+	for _, f := range Formats {
+
+		if f == format {
+			return p.Save(width, height, fileName)
+		}
+	}
+
+	return fmt.Errorf("unsupported output format '%s', choose one of %v", format, Formats)
+}
+
+// Render draws a plot of supplied size in supplied
+// format, e.g. 'svg', and returns the encoded image.
+func Render(p *plot.Plot, width vg.Length, height vg.Length, format string) ([]byte, error) {
+
+	w, err := p.WriterTo(width, height, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render plot as %s: %s", format, err.Error())
+	}
+
+	var buf bytes.Buffer
+
+	_, err = w.WriteTo(&buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render plot as %s: %s", format, err.Error())
+	}
+
+	return buf.Bytes(), nil
+}
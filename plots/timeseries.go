@@ -0,0 +1,272 @@
+package plots
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gonum/plot"
+	"github.com/gonum/plot/plotter"
+	"github.com/gonum/plot/vg"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+)
+
+// Functions
+
+// timed returns all successful records of a data set
+// sorted by their start, together with the start of
+// the run. Sets read from legacy log files lack
+// absolute timestamps and are refused.
+func timed(set DataSet) ([]records.Record, time.Time, error) {
+
+	if len(set.Records) == 0 {
+		return nil, time.Time{}, fmt.Errorf("no timestamped results for '%s', supply its results file instead of the log", set.Name)
+	}
+
+	recs := make([]records.Record, 0, len(set.Records))
+	for _, rec := range set.Records {
+
+		if rec.Status == "OK" {
+			recs = append(recs, rec)
+		}
+	}
+
+	if len(recs) == 0 {
+		return nil, time.Time{}, fmt.Errorf("no successful commands in '%s'", set.Name)
+	}
+
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].Start.Before(recs[j].Start)
+	})
+
+	// Count time from start of run, even if its
+	// warm-up was excluded.
+	if (set.Start.IsZero() != true) && set.Start.Before(recs[0].Start) {
+		return recs, set.Start, nil
+	}
+
+	return recs, recs[0].Start, nil
+}
+
+// byConn splits records by connection and returns
+// the ascending list of connection numbers.
+func byConn(recs []records.Record) ([]int, map[int][]records.Record) {
+
+	conns := make([]int, 0, 1)
+	split := make(map[int][]records.Record)
+
+	for _, rec := range recs {
+
+		if _, found := split[rec.Conn]; found != true {
+			conns = append(conns, rec.Conn)
+		}
+
+		split[rec.Conn] = append(split[rec.Conn], rec)
+	}
+
+	sort.Ints(conns)
+
+	return conns, split
+}
+
+// ThroughputSeries counts commands completed in each
+// second since t0.
+func ThroughputSeries(recs []records.Record, t0 time.Time) plotter.XYs {
+
+	counts := make([]float64, 0, 60)
+
+	for _, rec := range recs {
+
+		end := rec.Start.Add(time.Duration(rec.Latency))
+		second := int(end.Sub(t0) / time.Second)
+
+		for len(counts) <= second {
+			counts = append(counts, 0)
+		}
+
+		counts[second]++
+	}
+
+	series := make(plotter.XYs, len(counts))
+	for i := range counts {
+		series[i].X = float64(i)
+		series[i].Y = counts[i]
+	}
+
+	return series
+}
+
+// LatencySeries computes for every second since t0 the
+// supplied percentile of completion times of commands
+// started within the trailing window. Records need to
+// be sorted by start.
+func LatencySeries(recs []records.Record, t0 time.Time, window time.Duration, percentile float64) plotter.XYs {
+
+	last := recs[(len(recs) - 1)].Start.Sub(t0)
+	steps := int(last/time.Second) + 1
+
+	series := make(plotter.XYs, steps)
+	n := 0
+	values := make([]float64, 0, len(recs))
+	lower := 0
+	upper := 0
+
+	for step := 1; step <= steps; step++ {
+
+		end := t0.Add(time.Duration(step) * time.Second)
+		start := end.Add(-window)
+
+		// Advance window over records sorted by start.
+		for (upper < len(recs)) && (recs[upper].Start.Before(end)) {
+			upper++
+		}
+
+		for (lower < upper) && (recs[lower].Start.Before(start)) {
+			lower++
+		}
+
+		if lower == upper {
+			continue
+		}
+
+		values = values[:0]
+		for _, rec := range recs[lower:upper] {
+			values = append(values, (float64(rec.Latency) / float64(time.Millisecond)))
+		}
+
+		series[n].X = float64(step)
+		series[n].Y = stats.Percentile(stats.Sorted(values), percentile)
+		n++
+	}
+
+	return series[:n]
+}
+
+// addSeries draws series of one data set. If per
+// connection series are supplied, they are drawn as
+// thin lines below the thick line of the whole set.
+func addSeries(p *plot.Plot, set DataSet, total plotter.XYs, perConn []plotter.XYs) error {
+
+	for _, series := range perConn {
+
+		if len(series) == 0 {
+			continue
+		}
+
+		line, err := plotter.NewLine(series)
+		if err != nil {
+			return fmt.Errorf("failed to add connection series of '%s': %s", set.Name, err.Error())
+		}
+
+		line.LineStyle.Color = transparent(ColorOf(set.Style))
+		line.LineStyle.Width = vg.Points(0.5)
+
+		p.Add(line)
+	}
+
+	line, err := plotter.NewLine(total)
+	if err != nil {
+		return fmt.Errorf("failed to add series of '%s': %s", set.Name, err.Error())
+	}
+
+	line.LineStyle.Color = ColorOf(set.Style)
+	line.LineStyle.Width = vg.Points(1.5)
+
+	p.Add(line)
+	p.Legend.Add(set.Name, line)
+
+	return nil
+}
+
+// Throughput plots the number of completed commands
+// per second over the time since start of each set.
+// With opts.PerConn set, concurrent sets additionally
+// get one line per connection.
+func Throughput(title string, sets []DataSet, opts Options) (*plot.Plot, error) {
+
+	p, err := PreparePlot(title, 0.0, "Time since start of run (s)", "Completed commands per second")
+	if err != nil {
+		return nil, err
+	}
+
+	p.X.Min = 0.0
+
+	for _, set := range sets {
+
+		recs, t0, err := timed(set)
+		if err != nil {
+			return nil, err
+		}
+
+		total := ThroughputSeries(recs, t0)
+		perConn := make([]plotter.XYs, 0)
+
+		conns, split := byConn(recs)
+		if opts.PerConn && (len(conns) > 1) {
+
+			for _, conn := range conns {
+				perConn = append(perConn, ThroughputSeries(split[conn], t0))
+			}
+		}
+
+		if float64(len(total)) > p.X.Max {
+			p.X.Max = float64(len(total))
+		}
+
+		err = addSeries(p, set, total, perConn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// LatencyOverTime plots a rolling percentile of
+// completion times over the time since start of each
+// set. With opts.PerConn set, concurrent sets
+// additionally get one line per connection.
+func LatencyOverTime(title string, sets []DataSet, opts Options) (*plot.Plot, error) {
+
+	opts = opts.withDefaults()
+	window := opts.Window
+	percentile := opts.Percentile
+
+	p, err := PreparePlot(title, 0.0, "Time since start of run (s)", fmt.Sprintf("p%g completion time over last %s (ms)", percentile, window))
+	if err != nil {
+		return nil, err
+	}
+
+	p.X.Min = 0.0
+
+	for _, set := range sets {
+
+		recs, t0, err := timed(set)
+		if err != nil {
+			return nil, err
+		}
+
+		total := LatencySeries(recs, t0, window, percentile)
+		perConn := make([]plotter.XYs, 0)
+
+		conns, split := byConn(recs)
+		if opts.PerConn && (len(conns) > 1) {
+
+			for _, conn := range conns {
+				perConn = append(perConn, LatencySeries(split[conn], t0, window, percentile))
+			}
+		}
+
+		if (len(total) > 0) && (total[(len(total)-1)].X > p.X.Max) {
+			p.X.Max = total[(len(total) - 1)].X
+		}
+
+		err = addSeries(p, set, total, perConn)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
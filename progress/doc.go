@@ -0,0 +1,4 @@
+/*
+Package progress shows live progress of running tests on the terminal.
+*/
+package progress
@@ -0,0 +1,316 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+)
+
+// Structs
+
+// sample is one completed command as seen by
+// the dashboard.
+type sample struct {
+	end     time.Time
+	latency float64
+	ok      bool
+}
+
+// target accumulates progress of one system
+// under test.
+type target struct {
+	completed int
+	errors    int
+	recent    []sample
+}
+
+// Dashboard shows per target how many commands were
+// completed, the current throughput, rolling p50 and
+// p99 completion times and the number of errors. On a
+// terminal, it redraws one status line per target in
+// place, otherwise it prints plain lines instead.
+type Dashboard struct {
+	lock     *sync.Mutex
+	out      io.Writer
+	terminal bool
+	interval time.Duration
+	window   time.Duration
+	started  time.Time
+	names    []string
+	targets  map[string]*target
+	drawn    int
+	logOut   io.Writer
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// Variables
+
+// PlainInterval is the shortest interval plain status
+// lines are printed at if stdout is not a terminal, so
+// that log files and CI output are not flooded.
+var PlainInterval = time.Minute
+
+// Functions
+
+// New prepares a dashboard writing to stdout every
+// interval, or every PlainInterval if stdout is not a
+// terminal and interval is shorter. Percentiles are
+// taken over the commands completed in the last ten
+// seconds, throughput over the last interval but at
+// most these ten seconds. An interval of zero
+// disables the dashboard.
+func New(interval time.Duration) *Dashboard {
+
+	terminal := IsTerminal(os.Stdout)
+
+	if (terminal != true) && (interval > 0) && (interval < PlainInterval) {
+		interval = PlainInterval
+	}
+
+	return &Dashboard{
+		lock:     &sync.Mutex{},
+		out:      os.Stdout,
+		terminal: terminal,
+		interval: interval,
+		window:   (10 * time.Second),
+		targets:  make(map[string]*target),
+	}
+}
+
+// IsTerminal reports whether f is a character
+// device, i.e. an interactive terminal.
+func IsTerminal(f *os.File) bool {
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return (info.Mode() & os.ModeCharDevice) != 0
+}
+
+// Record notes one completed command. Its signature
+// fits records.Writer.Observe. A disabled dashboard
+// keeps nothing, as it never forgets old samples.
+func (d *Dashboard) Record(rec records.Record) {
+
+	if d.interval <= 0 {
+		return
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	t, found := d.targets[rec.Target]
+	if found != true {
+		t = &target{
+			recent: make([]sample, 0, 1000),
+		}
+		d.targets[rec.Target] = t
+		d.names = append(d.names, rec.Target)
+	}
+
+	t.completed++
+
+	ok := (rec.Status == "OK")
+	if ok != true {
+		t.errors++
+	}
+
+	t.recent = append(t.recent, sample{
+		end:     rec.Start.Add(time.Duration(rec.Latency)),
+		latency: (float64(rec.Latency) / float64(time.Millisecond)),
+		ok:      ok,
+	})
+}
+
+// Start begins updating the dashboard every interval
+// until Stop is called. On a terminal, log output is
+// routed through the dashboard so that status lines
+// are redrawn below it.
+func (d *Dashboard) Start() {
+
+	if d.interval <= 0 {
+		return
+	}
+
+	d.started = time.Now()
+	d.stop = make(chan struct{})
+	d.done = make(chan struct{})
+
+	if d.terminal {
+		d.logOut = log.Writer()
+		log.SetOutput(d)
+	}
+
+	go func() {
+
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+
+		for {
+
+			select {
+
+			case <-ticker.C:
+				d.draw(time.Now())
+
+			case <-d.stop:
+				close(d.done)
+				return
+			}
+		}
+	}()
+}
+
+// Stop draws the dashboard a last time and ends
+// all further updates.
+func (d *Dashboard) Stop() {
+
+	if d.interval <= 0 {
+		return
+	}
+
+	close(d.stop)
+	<-d.done
+
+	d.draw(time.Now())
+
+	if d.terminal {
+
+		d.lock.Lock()
+		log.SetOutput(d.logOut)
+		d.drawn = 0
+		d.lock.Unlock()
+	}
+}
+
+// Write passes log output on to its original
+// destination, clearing status lines beforehand
+// and redrawing them afterwards.
+func (d *Dashboard) Write(p []byte) (int, error) {
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.clear()
+
+	n, err := d.logOut.Write(p)
+
+	d.render(d.lines(time.Now()))
+
+	return n, err
+}
+
+// draw updates the dashboard with the state at now.
+func (d *Dashboard) draw(now time.Time) {
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	lines := d.lines(now)
+
+	if d.terminal {
+		d.clear()
+		d.render(lines)
+		return
+	}
+
+	// Without a terminal, print plain lines that read
+	// well in log files.
+	for _, line := range lines {
+		fmt.Fprintf(d.out, "%s\n", line)
+	}
+}
+
+// clear removes previously drawn status lines from
+// the terminal. It expects the lock to be held.
+func (d *Dashboard) clear() {
+
+	if d.drawn > 0 {
+		fmt.Fprintf(d.out, "\033[%dA\033[J", d.drawn)
+		d.drawn = 0
+	}
+}
+
+// render draws status lines onto the terminal. It
+// expects the lock to be held.
+func (d *Dashboard) render(lines []string) {
+
+	if (d.terminal != true) || (d.stop == nil) {
+		return
+	}
+
+	for _, line := range lines {
+		fmt.Fprintf(d.out, "\r\033[2K%s\n", line)
+	}
+
+	d.drawn = len(lines)
+}
+
+// lines returns one status line per target with its
+// state at now. It expects the lock to be held.
+func (d *Dashboard) lines(now time.Time) []string {
+
+	elapsed := (now.Sub(d.started) / time.Second) * time.Second
+
+	if len(d.names) == 0 {
+		return []string{fmt.Sprintf("[%s] waiting for first command to complete...", elapsed)}
+	}
+
+	// Only samples of the window are kept, so
+	// throughput cannot cover a longer interval.
+	span := d.interval
+	if span > d.window {
+		span = d.window
+	}
+
+	lines := make([]string, 0, len(d.names))
+
+	for _, name := range d.names {
+
+		t := d.targets[name]
+
+		// Forget samples that left the window.
+		keep := 0
+		for (keep < len(t.recent)) && (now.Sub(t.recent[keep].end) > d.window) {
+			keep++
+		}
+		t.recent = t.recent[keep:]
+
+		latencies := make([]float64, 0, len(t.recent))
+		current := 0
+
+		for _, s := range t.recent {
+
+			if now.Sub(s.end) <= span {
+				current++
+			}
+
+			if s.ok {
+				latencies = append(latencies, s.latency)
+			}
+		}
+
+		throughput := float64(current) / span.Seconds()
+
+		percentiles := "p50 - ms, p99 - ms"
+		if len(latencies) > 0 {
+
+			sorted := stats.Sorted(latencies)
+			percentiles = fmt.Sprintf("p50 %.3f ms, p99 %.3f ms", stats.Percentile(sorted, 50.0), stats.Percentile(sorted, 99.0))
+		}
+
+		lines = append(lines, fmt.Sprintf("[%s] %-8s %8d done, %8.1f ops/s, %s, %d errors",
+			elapsed, name, t.completed, throughput, percentiles, t.errors))
+	}
+
+	return lines
+}
@@ -0,0 +1,82 @@
+package progress
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/numbleroot/pluto-evaluation/records"
+)
+
+// Functions
+
+// TestThroughput checks the throughput shown for
+// known samples with intervals below and above the
+// window samples are kept for.
+func TestThroughput(t *testing.T) {
+
+	tests := []struct {
+		interval time.Duration
+		expected string
+	}{
+		// 11 commands within the last second.
+		{time.Second, "11.0 ops/s"},
+
+		// 51 commands and the burst within the last
+		// five seconds.
+		{(5 * time.Second), "20.2 ops/s"},
+
+		// 101 commands and the burst within the ten
+		// second window, older ones are forgotten.
+		{(10 * time.Second), "15.1 ops/s"},
+		{time.Minute, "15.1 ops/s"},
+		{(5 * time.Minute), "15.1 ops/s"},
+	}
+
+	now := time.Date(2017, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, test := range tests {
+
+		// Off terminals, New raises short intervals.
+		d := New(test.interval)
+		d.interval = test.interval
+		d.started = now.Add(-time.Hour)
+
+		// One command every 100 ms over the last
+		// minute, in order of completion, and a
+		// burst of 50 more three seconds ago.
+		for i := 599; i >= 0; i-- {
+
+			end := now.Add(-time.Duration(i) * (100 * time.Millisecond))
+
+			if i == 30 {
+				for j := 0; j < 50; j++ {
+					d.Record(records.Record{Target: "pluto", Start: end, Status: "OK"})
+				}
+			}
+
+			d.Record(records.Record{Target: "pluto", Start: end, Status: "OK"})
+		}
+
+		lines := d.lines(now)
+
+		if (len(lines) != 1) || (strings.Contains(lines[0], test.expected) != true) {
+			t.Errorf("interval %v: expected %s but got %q", test.interval, test.expected, lines)
+		}
+	}
+}
+
+// TestDisabledRecord checks that a disabled
+// dashboard keeps no samples.
+func TestDisabledRecord(t *testing.T) {
+
+	d := New(0)
+
+	for i := 0; i < 10; i++ {
+		d.Record(records.Record{Target: "pluto", Start: time.Now(), Status: "OK"})
+	}
+
+	if len(d.targets) != 0 {
+		t.Errorf("expected no samples to be kept but got %d targets", len(d.targets))
+	}
+}
@@ -0,0 +1,4 @@
+/*
+Package records defines the versioned, machine-readable format test results are stored in.
+*/
+package records
@@ -0,0 +1,158 @@
+package records
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Functions
+
+// ScenarioFromSubject maps the subject line of a legacy
+// log file, e.g. 'Concurrent STORE', to the scenario
+// name used in results files, e.g. 'store-concurrent'.
+func ScenarioFromSubject(subject string) string {
+
+	parts := strings.Fields(strings.ToLower(subject))
+
+	if len(parts) == 2 && parts[0] == "concurrent" {
+		return fmt.Sprintf("%s-concurrent", parts[1])
+	}
+
+	return strings.Join(parts, "-")
+}
+
+// ParseLegacyFile reads a log file in the legacy
+// 'Subject/Platform/Date/-----' format followed by
+// 'id, ns' lines and returns its lines as records.
+// Legacy files do not carry absolute time stamps,
+// thus every record is assigned the date of the run.
+func ParseLegacyFile(fileName string, conn int) ([]Record, error) {
+
+	// Consume data from specified file.
+	dataRaw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Split into meta information and data points.
+	data := strings.SplitN(string(dataRaw), "-----\n", 2)
+	if len(data) != 2 {
+		return nil, fmt.Errorf("'%s' is not a legacy log file", fileName)
+	}
+
+	var subject, platform string
+	var date time.Time
+
+	for _, line := range strings.Split(strings.TrimSpace(data[0]), "\n") {
+
+		switch {
+		case strings.HasPrefix(line, "Subject: "):
+			subject = strings.TrimPrefix(line, "Subject: ")
+		case strings.HasPrefix(line, "Platform: "):
+			platform = strings.TrimPrefix(line, "Platform: ")
+		case strings.HasPrefix(line, "Date: "):
+			date, err = time.ParseInLocation("2006-01-02-15-04-05", strings.TrimPrefix(line, "Date: "), time.Local)
+			if err != nil {
+				return nil, fmt.Errorf("invalid date in '%s': %s", fileName, err.Error())
+			}
+		}
+	}
+
+	// Operation is the IMAP command in the subject.
+	subjectParts := strings.Fields(subject)
+	if len(subjectParts) == 0 {
+		return nil, fmt.Errorf("missing subject in '%s'", fileName)
+	}
+
+	op := subjectParts[(len(subjectParts) - 1)]
+	scenario := ScenarioFromSubject(subject)
+
+	dataPointsRaw := strings.Split(strings.TrimSpace(data[1]), "\n")
+	recs := make([]Record, 0, len(dataPointsRaw))
+
+	for _, pointRaw := range dataPointsRaw {
+
+		if pointRaw == "" {
+			continue
+		}
+
+		// Split each point at comma.
+		point := strings.Split(pointRaw, ", ")
+		if len(point) != 2 {
+			return nil, fmt.Errorf("malformed line '%s' in '%s'", pointRaw, fileName)
+		}
+
+		seq, err := strconv.Atoi(point[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert string ID to int in '%s'", fileName)
+		}
+
+		latency, err := strconv.ParseInt(point[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert string value to int in '%s'", fileName)
+		}
+
+		recs = append(recs, Record{
+			Version:  Version,
+			Scenario: scenario,
+			Target:   platform,
+			Conn:     conn,
+			Seq:      seq,
+			Op:       op,
+			Start:    date,
+			Latency:  latency,
+			Status:   "OK",
+		})
+	}
+
+	return recs, nil
+}
+
+// ParseLegacy reads a legacy log file or a folder of
+// legacy 'conn-NNN.log' files of a concurrent test
+// and returns all contained lines as records.
+func ParseLegacy(path string) ([]Record, error) {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() != true {
+		return ParseLegacyFile(path, 0)
+	}
+
+	// Find all connection files in supplied folder.
+	files, err := filepath.Glob(filepath.Join(path, "conn-*.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	recs := make([]Record, 0, 100)
+
+	for _, file := range files {
+
+		// Extract connection number from file name.
+		connRaw := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(file), "conn-"), ".log")
+
+		conn, err := strconv.Atoi(connRaw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to extract connection number from '%s'", file)
+		}
+
+		fileRecs, err := ParseLegacyFile(file, conn)
+		if err != nil {
+			return nil, err
+		}
+
+		recs = append(recs, fileRecs...)
+	}
+
+	return recs, nil
+}
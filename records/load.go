@@ -0,0 +1,53 @@
+package records
+
+import (
+	"os"
+	"strings"
+
+	"path/filepath"
+)
+
+// Functions
+
+// Load reads all records of a result set. The path may
+// point to a results file in JSON Lines or CSV format,
+// to a run manifest listing results files, or to a
+// legacy log file or folder of a concurrent test.
+func Load(path string) ([]Record, error) {
+
+	if strings.HasSuffix(path, ".manifest.json") {
+
+		m, err := ReadManifest(path)
+		if err != nil {
+			return nil, err
+		}
+
+		recs := make([]Record, 0, 100)
+
+		for _, file := range m.Files {
+
+			// Files are listed relative to the evaluation
+			// directory. If the result set was moved, look
+			// for them next to the manifest instead.
+			if _, err := os.Stat(file); err != nil {
+				file = filepath.Join(filepath.Dir(path), filepath.Base(file))
+			}
+
+			fileRecs, err := ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+
+			recs = append(recs, fileRecs...)
+		}
+
+		return recs, nil
+	}
+
+	switch filepath.Ext(path) {
+	case ".jsonl", ".csv":
+		return ReadFile(path)
+	}
+
+	return ParseLegacy(path)
+}
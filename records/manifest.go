@@ -0,0 +1,301 @@
+package records
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os/exec"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+)
+
+// Variables
+
+// ToolVersion and GitCommit are set at build time via
+// '-ldflags "-X ..."', see Makefile. If GitCommit is
+// left empty, it is looked up when a run starts.
+var ToolVersion = "dev"
+var GitCommit = ""
+
+// Structs
+
+// Manifest describes one test run so that every
+// results file can be traced back to how it was made.
+type Manifest struct {
+	Version     int               `json:"version"`
+	ToolVersion string            `json:"tool_version"`
+	GitCommit   string            `json:"git_commit"`
+	Scenario    string            `json:"scenario"`
+	Date        time.Time         `json:"date"`
+	Finished    time.Time         `json:"finished,omitempty"`
+	Command     []string          `json:"command"`
+	Parameters  map[string]string `json:"parameters"`
+	ConfigFile  string            `json:"config_file"`
+	ConfigHash  string            `json:"config_hash"`
+	Host        Host              `json:"host"`
+	Servers     map[string]Server `json:"servers"`
+	Files       []string          `json:"files"`
+}
+
+// Host carries information about the machine the
+// test client was executed on.
+type Host struct {
+	Hostname  string `json:"hostname"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Kernel    string `json:"kernel"`
+	CPUModel  string `json:"cpu_model"`
+	NumCPU    int    `json:"num_cpu"`
+	GoVersion string `json:"go_version"`
+}
+
+// Server describes what an IMAP server under test
+// announced about itself and how it was connected to.
+type Server struct {
+	Addr          string   `json:"addr"`
+	Mode          string   `json:"conn_mode"`
+	TLSVersion    string   `json:"tls_version"`
+	CipherSuite   string   `json:"cipher_suite,omitempty"`
+	Verification  string   `json:"tls_verification,omitempty"`
+	Pins          []string `json:"tls_pins,omitempty"`
+	PeerSPKI      string   `json:"peer_spki,omitempty"`
+	Capability    string   `json:"capability"`
+	LoginDisabled bool     `json:"login_disabled"`
+	Auth          string   `json:"auth,omitempty"`
+	ID            string   `json:"id"`
+}
+
+// Functions
+
+// ManifestFileName returns the location of the run
+// manifest for supplied scenario and run date.
+func ManifestFileName(scenario string, date time.Time) string {
+	return fmt.Sprintf("results/%s-%s.manifest.json", scenario, date.Format("2006-01-02-15-04-05"))
+}
+
+// NewManifest collects all information about the
+// current run that is available before it starts.
+func NewManifest(scenario string, configFiles []string, date time.Time) (*Manifest, error) {
+
+	m := &Manifest{
+		Version:     Version,
+		ToolVersion: ToolVersion,
+		GitCommit:   GitCommit,
+		Scenario:    scenario,
+		Date:        date,
+		Command:     maskedArgs(os.Args),
+		Parameters:  make(map[string]string),
+		ConfigFile:  strings.Join(configFiles, " + "),
+		Servers:     make(map[string]Server),
+		Files:       make([]string, 0, 2),
+		Host: Host{
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+			Kernel:    kernelVersion(),
+			CPUModel:  cpuModel(),
+			NumCPU:    runtime.NumCPU(),
+			GoVersion: runtime.Version(),
+		},
+	}
+
+	// Capture values of all command-line flags,
+	// including defaults that were not supplied.
+	// Overrides may set passwords, which are masked.
+	flag.VisitAll(func(f *flag.Flag) {
+
+		m.Parameters[f.Name] = f.Value.String()
+
+		getter, isGetter := f.Value.(flag.Getter)
+		if (f.Name != "set") || (isGetter != true) {
+			return
+		}
+
+		overrides, ok := getter.Get().([]string)
+		if ok != true {
+			return
+		}
+
+		masked := make([]string, len(overrides))
+		for i, override := range overrides {
+			masked[i] = config.MaskOverride(override)
+		}
+
+		m.Parameters[f.Name] = strings.Join(masked, ",")
+	})
+
+	// Hash config files in order so that runs with
+	// identical setups can be recognized later on.
+	configHash := sha256.New()
+
+	for _, configFile := range configFiles {
+
+		configRaw, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file for hashing: %s", err.Error())
+		}
+
+		configHash.Write(configRaw)
+	}
+
+	m.ConfigHash = hex.EncodeToString(configHash.Sum(nil))
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	m.Host.Hostname = hostname
+
+	// Fall back to asking git directly if the commit
+	// was not compiled into the binary.
+	if m.GitCommit == "" {
+
+		out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+		if err == nil {
+			m.GitCommit = strings.TrimSpace(string(out))
+		} else {
+			m.GitCommit = "unknown"
+		}
+	}
+
+	return m, nil
+}
+
+// maskedArgs returns a copy of command-line args
+// with secrets set via -set masked, whether given as
+// '-set key=value' or '-set=key=value'.
+func maskedArgs(args []string) []string {
+
+	masked := make([]string, len(args))
+	isOverride := false
+
+	for i, arg := range args {
+
+		masked[i] = arg
+
+		if isOverride {
+			masked[i] = config.MaskOverride(arg)
+		}
+
+		for _, prefix := range []string{"-set=", "--set="} {
+
+			if strings.HasPrefix(arg, prefix) {
+				masked[i] = (prefix + config.MaskOverride(strings.TrimPrefix(arg, prefix)))
+			}
+		}
+
+		isOverride = (arg == "-set") || (arg == "--set")
+	}
+
+	return masked
+}
+
+// kernelVersion returns the release of the running
+// kernel or 'unknown' if it cannot be determined.
+func kernelVersion() string {
+
+	release, err := ioutil.ReadFile("/proc/sys/kernel/osrelease")
+	if err == nil {
+		return strings.TrimSpace(string(release))
+	}
+
+	out, err := exec.Command("uname", "-r").Output()
+	if err == nil {
+		return strings.TrimSpace(string(out))
+	}
+
+	return "unknown"
+}
+
+// cpuModel returns the model name of the first CPU
+// listed in /proc/cpuinfo or 'unknown'.
+func cpuModel() string {
+
+	cpuInfo, err := ioutil.ReadFile("/proc/cpuinfo")
+	if err != nil {
+		return "unknown"
+	}
+
+	for _, line := range strings.Split(string(cpuInfo), "\n") {
+
+		if strings.HasPrefix(line, "model name") {
+
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) == 2 {
+				return strings.TrimSpace(parts[1])
+			}
+		}
+	}
+
+	return "unknown"
+}
+
+// SetParameter records a parameter of the run that
+// is not passed as command-line flag, e.g. the size
+// of appended messages.
+func (m *Manifest) SetParameter(name string, value interface{}) {
+	m.Parameters[name] = fmt.Sprintf("%v", value)
+}
+
+// AddServer records what the server of target
+// announced about itself.
+func (m *Manifest) AddServer(target string, server Server) {
+	m.Servers[target] = server
+}
+
+// AddFile registers a results file produced by this run.
+func (m *Manifest) AddFile(fileName string) {
+	m.Files = append(m.Files, fileName)
+}
+
+// Finish notes the end of the run and stores
+// the final manifest.
+func (m *Manifest) Finish(fileName string) error {
+
+	m.Finished = time.Now()
+
+	return m.Write(fileName)
+}
+
+// Write stores the manifest as indented JSON.
+func (m *Manifest) Write(fileName string) error {
+
+	manifestRaw, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %s", err.Error())
+	}
+
+	err = ioutil.WriteFile(fileName, append(manifestRaw, '\n'), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest '%s': %s", fileName, err.Error())
+	}
+
+	return nil
+}
+
+// ReadManifest loads a manifest previously stored
+// with Write.
+func ReadManifest(fileName string) (*Manifest, error) {
+
+	manifestRaw, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+
+	err = json.Unmarshal(manifestRaw, m)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest '%s': %s", fileName, err.Error())
+	}
+
+	return m, nil
+}
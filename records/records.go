@@ -0,0 +1,343 @@
+package records
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"encoding/csv"
+	"encoding/json"
+	"path/filepath"
+)
+
+// Constants
+
+// Version identifies the layout of Record. It is
+// increased whenever fields change their meaning.
+const Version = 1
+
+// Structs
+
+// Record describes the outcome of one IMAP command
+// sent during a test.
+type Record struct {
+	Version  int       `json:"version"`
+	Scenario string    `json:"scenario"`
+	Target   string    `json:"target"`
+	User     string    `json:"user"`
+	Conn     int       `json:"conn"`
+	Seq      int       `json:"seq"`
+	Op       string    `json:"op"`
+	Start    time.Time `json:"start"`
+	Latency  int64     `json:"latency_ns"`
+	Bytes    int       `json:"bytes"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Writer appends records to a results file either as
+// JSON Lines or as CSV with a header line, depending on
+// the file extension. The first failure to write is
+// kept and returned by every later Write and by Close,
+// so that it cannot go unnoticed. It is safe for
+// concurrent use.
+type Writer struct {
+	lock       *sync.Mutex
+	file       *os.File
+	buf        *bufio.Writer
+	csvWriter  *csv.Writer
+	jsonWriter *json.Encoder
+	observers  []func(Record)
+	err        error
+	closed     bool
+}
+
+// Variables
+
+// header names the CSV columns in the order
+// fields are written by a Writer.
+var header = []string{"version", "scenario", "target", "user", "conn", "seq", "op", "start", "latency_ns", "bytes", "status", "error"}
+
+// Functions
+
+// FileName returns the name of the results file that
+// belongs to supplied legacy log file or log folder.
+func FileName(logName string, format string) string {
+	return fmt.Sprintf("%s.%s", strings.TrimSuffix(logName, ".log"), format)
+}
+
+// NewWriter creates the results file at fileName. The
+// extension determines the format: '.jsonl' or '.csv'.
+func NewWriter(fileName string) (*Writer, error) {
+
+	ext := filepath.Ext(fileName)
+	if (ext != ".jsonl") && (ext != ".csv") {
+		return nil, fmt.Errorf("unsupported results format '%s', use .jsonl or .csv", ext)
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create results file '%s': %s", fileName, err.Error())
+	}
+
+	w := &Writer{
+		lock: &sync.Mutex{},
+		file: file,
+		buf:  bufio.NewWriter(file),
+	}
+
+	if ext == ".csv" {
+
+		w.csvWriter = csv.NewWriter(w.buf)
+
+		// Write column names as first line.
+		err = w.csvWriter.Write(header)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write CSV header to '%s': %s", fileName, err.Error())
+		}
+	} else {
+		w.jsonWriter = json.NewEncoder(w.buf)
+	}
+
+	return w, nil
+}
+
+// Observe registers fn to be called with every
+// record written from now on, e.g. to show progress.
+func (w *Writer) Observe(fn func(Record)) {
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.observers = append(w.observers, fn)
+}
+
+// Write appends one record to the results file and
+// hands it to all observers. Once writing failed or
+// the file was closed, records are not written anymore
+// and the first error is returned.
+func (w *Writer) Write(r Record) error {
+
+	r.Version = Version
+
+	w.lock.Lock()
+
+	if w.closed {
+		w.lock.Unlock()
+		return fmt.Errorf("results file '%s' already closed", w.file.Name())
+	}
+
+	if w.err == nil {
+
+		if w.csvWriter != nil {
+			w.err = w.csvWriter.Write(r.fields())
+		} else {
+			w.err = w.jsonWriter.Encode(r)
+		}
+
+		if w.err != nil {
+			w.err = fmt.Errorf("failed to write to results file '%s': %s", w.file.Name(), w.err.Error())
+		}
+	}
+
+	err := w.err
+	observers := w.observers
+
+	w.lock.Unlock()
+
+	for _, observe := range observers {
+		observe(r)
+	}
+
+	return err
+}
+
+// Close flushes all buffered records to storage
+// and closes the results file. It returns the first
+// error of any Write as well. Closing more than once
+// does nothing, so that callers may close the writer
+// before exiting on a failure.
+func (w *Writer) Close() error {
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.closed {
+		return w.err
+	}
+
+	w.closed = true
+
+	var err error
+
+	if w.csvWriter != nil {
+		w.csvWriter.Flush()
+		err = w.csvWriter.Error()
+	}
+
+	if err == nil {
+		err = w.buf.Flush()
+	}
+
+	if err == nil {
+		err = w.file.Sync()
+	}
+
+	closeErr := w.file.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if (err != nil) && (w.err == nil) {
+		w.err = fmt.Errorf("failed to store results file '%s': %s", w.file.Name(), err.Error())
+	}
+
+	return w.err
+}
+
+// fields returns r as CSV columns in header order.
+func (r Record) fields() []string {
+
+	return []string{
+		strconv.Itoa(r.Version),
+		r.Scenario,
+		r.Target,
+		r.User,
+		strconv.Itoa(r.Conn),
+		strconv.Itoa(r.Seq),
+		r.Op,
+		r.Start.UTC().Format(time.RFC3339Nano),
+		strconv.FormatInt(r.Latency, 10),
+		strconv.Itoa(r.Bytes),
+		r.Status,
+		r.Error,
+	}
+}
+
+// parseFields builds a record from CSV columns
+// that are named as in cols.
+func parseFields(cols []string, fields []string) (Record, error) {
+
+	r := Record{}
+
+	if len(fields) != len(cols) {
+		return r, fmt.Errorf("expected %d columns, found %d", len(cols), len(fields))
+	}
+
+	var err error
+
+	for i, col := range cols {
+
+		value := fields[i]
+
+		switch col {
+		case "version":
+			r.Version, err = strconv.Atoi(value)
+		case "scenario":
+			r.Scenario = value
+		case "target":
+			r.Target = value
+		case "user":
+			r.User = value
+		case "conn":
+			r.Conn, err = strconv.Atoi(value)
+		case "seq":
+			r.Seq, err = strconv.Atoi(value)
+		case "op":
+			r.Op = value
+		case "start":
+			if value != "" {
+				r.Start, err = time.Parse(time.RFC3339Nano, value)
+			}
+		case "latency_ns":
+			r.Latency, err = strconv.ParseInt(value, 10, 64)
+		case "bytes":
+			r.Bytes, err = strconv.Atoi(value)
+		case "status":
+			r.Status = value
+		case "error":
+			r.Error = value
+		}
+
+		if err != nil {
+			return r, fmt.Errorf("invalid value '%s' in column %s: %s", value, col, err.Error())
+		}
+	}
+
+	return r, nil
+}
+
+// ReadFile reads all records from a results file
+// in JSON Lines or CSV format.
+func ReadFile(fileName string) ([]Record, error) {
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	recs := make([]Record, 0, 100)
+
+	if filepath.Ext(fileName) == ".csv" {
+
+		reader := csv.NewReader(bufio.NewReader(file))
+
+		// First line names the columns.
+		cols, err := reader.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV header of '%s': %s", fileName, err.Error())
+		}
+
+		for {
+
+			fields, err := reader.Read()
+			if err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, fmt.Errorf("failed to read '%s': %s", fileName, err.Error())
+			}
+
+			r, err := parseFields(cols, fields)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse '%s': %s", fileName, err.Error())
+			}
+
+			if r.Version > Version {
+				return nil, fmt.Errorf("'%s' uses results format version %d, newer than supported %d", fileName, r.Version, Version)
+			}
+
+			recs = append(recs, r)
+		}
+
+		return recs, nil
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+
+	for {
+
+		r := Record{}
+
+		err := decoder.Decode(&r)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to parse '%s': %s", fileName, err.Error())
+		}
+
+		if r.Version > Version {
+			return nil, fmt.Errorf("'%s' uses results format version %d, newer than supported %d", fileName, r.Version, Version)
+		}
+
+		recs = append(recs, r)
+	}
+
+	return recs, nil
+}
@@ -0,0 +1,199 @@
+package records
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Functions
+
+// TestWriterRoundTrip checks that records written in
+// either format are read back unchanged.
+func TestWriterRoundTrip(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "records")
+	if err != nil {
+		t.Fatalf("failed to create temporary folder: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	rec := Record{
+		Scenario: "append",
+		Target:   "pluto",
+		User:     "user0",
+		Conn:     2,
+		Seq:      7,
+		Op:       "APPEND",
+		Start:    time.Date(2017, 6, 1, 12, 0, 0, 123, time.UTC),
+		Latency:  4200000,
+		Bytes:    512,
+		Status:   "NO",
+		Error:    "quota, \"exceeded\"",
+	}
+
+	for _, format := range []string{"jsonl", "csv"} {
+
+		fileName := filepath.Join(dir, ("results." + format))
+
+		w, err := NewWriter(fileName)
+		if err != nil {
+			t.Fatalf("%s: failed to create writer: %s", format, err.Error())
+		}
+
+		observed := 0
+		w.Observe(func(Record) {
+			observed++
+		})
+
+		for i := 0; i < 3; i++ {
+
+			err = w.Write(rec)
+			if err != nil {
+				t.Fatalf("%s: failed to write record: %s", format, err.Error())
+			}
+		}
+
+		err = w.Close()
+		if err != nil {
+			t.Fatalf("%s: failed to close writer: %s", format, err.Error())
+		}
+
+		if observed != 3 {
+			t.Errorf("%s: expected 3 observed records but got %d", format, observed)
+		}
+
+		recs, err := ReadFile(fileName)
+		if err != nil {
+			t.Fatalf("%s: failed to read records: %s", format, err.Error())
+		}
+
+		if len(recs) != 3 {
+			t.Fatalf("%s: expected 3 records but got %d", format, len(recs))
+		}
+
+		expected := rec
+		expected.Version = Version
+
+		for _, r := range recs {
+
+			if (r.Start.Equal(expected.Start) != true) || (r.Error != expected.Error) {
+				t.Errorf("%s: expected %+v but got %+v", format, expected, r)
+			}
+
+			r.Start = expected.Start
+			if r != expected {
+				t.Errorf("%s: expected %+v but got %+v", format, expected, r)
+			}
+		}
+	}
+}
+
+// TestWriterClosed checks that writing to a closed
+// writer fails and closing twice does not.
+func TestWriterClosed(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "records")
+	if err != nil {
+		t.Fatalf("failed to create temporary folder: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(filepath.Join(dir, "results.jsonl"))
+	if err != nil {
+		t.Fatalf("failed to create writer: %s", err.Error())
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Fatalf("failed to close writer: %s", err.Error())
+	}
+
+	err = w.Write(Record{})
+	if err == nil {
+		t.Errorf("expected write to closed writer to fail")
+	}
+
+	err = w.Close()
+	if err != nil {
+		t.Errorf("expected second close to succeed but got: %s", err.Error())
+	}
+
+	_, err = NewWriter(filepath.Join(dir, "results.txt"))
+	if err == nil {
+		t.Errorf("expected unsupported extension to be rejected")
+	}
+}
+
+// TestReadFileVersion checks that results of a newer
+// format version are rejected in both formats.
+func TestReadFileVersion(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "records")
+	if err != nil {
+		t.Fatalf("failed to create temporary folder: %s", err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"newer.jsonl": "{\"version\": 99, \"op\": \"APPEND\"}\n",
+		"newer.csv":   (strings.Join(header, ",") + "\n99,append,pluto,user0,0,1,APPEND,,1,0,OK,\n"),
+	}
+
+	for name, content := range files {
+
+		fileName := filepath.Join(dir, name)
+
+		err := ioutil.WriteFile(fileName, []byte(content), 0600)
+		if err != nil {
+			t.Fatalf("failed to write '%s': %s", name, err.Error())
+		}
+
+		_, err = ReadFile(fileName)
+		if (err == nil) || (strings.Contains(err.Error(), "version 99") != true) {
+			t.Errorf("%s: expected newer version to be rejected but got: %v", name, err)
+		}
+	}
+}
+
+// TestMaskedArgs checks that secrets set via -set
+// are masked in the command line of a manifest while
+// all other arguments are kept.
+func TestMaskedArgs(t *testing.T) {
+
+	args := []string{
+		"./test-append",
+		"-set", "Pluto.AppendTest.Password=hunter2",
+		"-set=gmail.oauth.clientsecret=abc",
+		"--set", "Gmail.OAuth.RefreshToken=1//xyz",
+		"-set", "Gmail.OAuth.TokenURL=http://127.0.0.1:8080/token",
+		"-set", "Pluto.ConcurrentTest.PasswordPattern=env:PASSWORD%03d",
+		"-set", "Pluto.IP=10.0.0.1",
+		"-runs", "10",
+	}
+
+	expected := []string{
+		"./test-append",
+		"-set", "Pluto.AppendTest.Password=********",
+		"-set=gmail.oauth.clientsecret=********",
+		"--set", "Gmail.OAuth.RefreshToken=********",
+		"-set", "Gmail.OAuth.TokenURL=http://127.0.0.1:8080/token",
+		"-set", "Pluto.ConcurrentTest.PasswordPattern=env:PASSWORD%03d",
+		"-set", "Pluto.IP=10.0.0.1",
+		"-runs", "10",
+	}
+
+	masked := maskedArgs(args)
+
+	if strings.Join(masked, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected %q but got %q", expected, masked)
+	}
+
+	if args[2] != "Pluto.AppendTest.Password=hunter2" {
+		t.Errorf("expected original args to be kept but got %q", args)
+	}
+}
@@ -0,0 +1,123 @@
+package records
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Structs
+
+// Warmup describes the initial part of every run that
+// is excluded from analysis, either the first Count
+// commands of each connection or all commands started
+// within Duration after the start of the run.
+type Warmup struct {
+	Count    int
+	Duration time.Duration
+}
+
+// Functions
+
+// ParseWarmup reads a warm-up window given as number
+// of commands, e.g. '50', or as duration, e.g. '5s'.
+// An empty string means no warm-up.
+func ParseWarmup(window string) (Warmup, error) {
+
+	window = strings.TrimSpace(window)
+	if (window == "") || (window == "0") {
+		return Warmup{}, nil
+	}
+
+	count, err := strconv.Atoi(window)
+	if err == nil {
+
+		if count < 0 {
+			return Warmup{}, fmt.Errorf("negative warm-up count '%s'", window)
+		}
+
+		return Warmup{Count: count}, nil
+	}
+
+	duration, err := time.ParseDuration(window)
+	if (err != nil) || (duration < 0) {
+		return Warmup{}, fmt.Errorf("invalid warm-up '%s', use a number of commands like 50 or a duration like 5s", window)
+	}
+
+	return Warmup{Duration: duration}, nil
+}
+
+// IsZero reports whether no warm-up is excluded.
+func (w Warmup) IsZero() bool {
+	return (w.Count == 0) && (w.Duration == 0)
+}
+
+// String describes the warm-up window.
+func (w Warmup) String() string {
+
+	if w.Count > 0 {
+		return fmt.Sprintf("first %d commands per connection", w.Count)
+	}
+
+	if w.Duration > 0 {
+		return fmt.Sprintf("first %s of run", w.Duration)
+	}
+
+	return "none"
+}
+
+// Split separates records within the warm-up window
+// from the ones to analyze. The start of a run is the
+// earliest start of any record of the same scenario
+// and target. Time-based warm-up needs absolute
+// timestamps, which legacy log files do not carry.
+func (w Warmup) Split(recs []Record) ([]Record, []Record, error) {
+
+	if w.IsZero() {
+		return recs, nil, nil
+	}
+
+	// Find start of each run.
+	starts := make(map[string]time.Time)
+	distinct := make(map[string]bool)
+
+	for _, rec := range recs {
+
+		key := fmt.Sprintf("%s/%s", rec.Scenario, rec.Target)
+
+		start, found := starts[key]
+		if found != true {
+			starts[key] = rec.Start
+			continue
+		}
+
+		if rec.Start.Equal(start) != true {
+			distinct[key] = true
+		}
+
+		if rec.Start.Before(start) {
+			starts[key] = rec.Start
+		}
+	}
+
+	measured := make([]Record, 0, len(recs))
+	excluded := make([]Record, 0)
+
+	for _, rec := range recs {
+
+		key := fmt.Sprintf("%s/%s", rec.Scenario, rec.Target)
+
+		if (w.Duration > 0) && (distinct[key] != true) && (len(recs) > 1) {
+			return nil, nil, fmt.Errorf("time-based warm-up needs absolute timestamps, but %s has none", key)
+		}
+
+		if ((w.Count > 0) && (rec.Seq <= w.Count)) || ((w.Duration > 0) && (rec.Start.Sub(starts[key]) < w.Duration)) {
+			excluded = append(excluded, rec)
+		} else {
+			measured = append(measured, rec)
+		}
+	}
+
+	return measured, excluded, nil
+}
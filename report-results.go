@@ -0,0 +1,595 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"encoding/base64"
+	"html/template"
+	"math/rand"
+	"path/filepath"
+
+	"github.com/gonum/plot/vg"
+	"github.com/numbleroot/pluto-evaluation/plots"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+)
+
+// Structs
+
+// Run is one run manifest of the reported directory
+// together with the records of all its files.
+type Run struct {
+	File     string
+	Manifest *records.Manifest
+	Records  []records.Record
+}
+
+// Row summarizes completion times of one operation
+// on one target.
+type Row struct {
+	Op       string
+	Target   string
+	Summary  stats.Summary
+	Outliers stats.Outliers
+}
+
+// Table lists all operations and targets of one scenario.
+type Table struct {
+	Scenario string
+	Rows     []Row
+}
+
+// ErrorCount counts failed commands of one kind.
+type ErrorCount struct {
+	Key    string
+	Status string
+	Error  string
+	Count  int
+}
+
+// Figure is a plot embedded into the report.
+type Figure struct {
+	Title string
+	Data  template.URL
+}
+
+// Comparison holds the changes of one operation on
+// one target against the baseline run.
+type Comparison struct {
+	Key        string
+	N          string
+	P          float64
+	Deltas     []stats.Delta
+	Regression bool
+}
+
+// Report is everything rendered into the HTML file.
+type Report struct {
+	Title       string
+	Generated   time.Time
+	Runs        []Run
+	Tables      []Table
+	Errors      []ErrorCount
+	Figures     []Figure
+	Warmup      string
+	Baseline    string
+	Threshold   float64
+	Comparisons []Comparison
+}
+
+// Variables
+
+// reportTemplate lays out the report as one
+// self-contained HTML page.
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms": func(ns interface{}) string {
+		switch v := ns.(type) {
+		case int64:
+			return fmt.Sprintf("%.3f", (float64(v) / float64(time.Millisecond)))
+		case float64:
+			return fmt.Sprintf("%.3f", (v / float64(time.Millisecond)))
+		}
+		return ""
+	},
+	"pct": func(v float64) string {
+		return fmt.Sprintf("%+.1f%%", (v * 100.0))
+	},
+	"date": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format("2006-01-02 15:04:05 MST")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: Helvetica, Arial, sans-serif; margin: 2em auto; max-width: 70em; color: #222; }
+h1, h2, h3 { font-weight: normal; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; font-family: Courier, monospace; font-size: 0.9em; }
+th { background: #f0f0f0; }
+td.num { text-align: right; }
+tr.regression td { background: #fbe3e4; }
+img { max-width: 100%; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated {{date .Generated}}.</p>
+
+{{range .Runs}}
+<h2>Run {{.File}}</h2>
+{{with .Manifest}}
+<table>
+<tr><th>Scenario</th><td>{{.Scenario}}</td></tr>
+<tr><th>Started</th><td>{{date .Date}}</td></tr>
+<tr><th>Finished</th><td>{{date .Finished}}</td></tr>
+<tr><th>Tool version</th><td>{{.ToolVersion}} ({{.GitCommit}})</td></tr>
+<tr><th>Command</th><td>{{range .Command}}{{.}} {{end}}</td></tr>
+<tr><th>Config</th><td>{{.ConfigFile}} (sha256 {{.ConfigHash}})</td></tr>
+<tr><th>Host</th><td>{{.Host.Hostname}}, {{.Host.OS}}/{{.Host.Arch}}, kernel {{.Host.Kernel}}, {{.Host.NumCPU}} x {{.Host.CPUModel}}, {{.Host.GoVersion}}</td></tr>
+{{range $name, $value := .Parameters}}<tr><th>{{$name}}</th><td>{{$value}}</td></tr>
+{{end}}
+</table>
+{{if .Servers}}
+<table>
+<tr><th>Target</th><th>Address</th><th>Mode</th><th>TLS</th><th>Cipher suite</th><th>Certificate</th><th>Auth</th><th>Capability</th><th>ID</th></tr>
+{{range $target, $server := .Servers}}<tr><td>{{$target}}</td><td>{{$server.Addr}}</td><td>{{$server.Mode}}{{if $server.LoginDisabled}} (LOGINDISABLED){{end}}</td><td>{{$server.TLSVersion}}</td><td>{{$server.CipherSuite}}</td><td>{{$server.Verification}}</td><td>{{$server.Auth}}</td><td>{{$server.Capability}}</td><td>{{$server.ID}}</td></tr>
+{{end}}
+</table>
+{{end}}
+{{else}}
+<p>No run manifest available.</p>
+{{end}}
+{{end}}
+
+<h2>Completion times (ms)</h2>
+{{if .Warmup}}<p>Excluded as warm-up: {{.Warmup}}.</p>{{end}}
+{{range .Tables}}
+<h3>{{.Scenario}}</h3>
+<table>
+<tr><th>Operation</th><th>Target</th><th>Count</th><th>Errors</th><th>Min</th><th>p50</th><th>p90</th><th>p99</th><th>p99.9</th><th>Max</th><th>Mean</th><th>Stddev</th><th>Outliers (IQR)</th></tr>
+{{range .Rows}}<tr><td>{{.Op}}</td><td>{{.Target}}</td><td class="num">{{.Summary.Count}}</td><td class="num">{{.Summary.Errors}}</td><td class="num">{{ms .Summary.Min}}</td><td class="num">{{ms .Summary.P50}}</td><td class="num">{{ms .Summary.P90}}</td><td class="num">{{ms .Summary.P99}}</td><td class="num">{{ms .Summary.P999}}</td><td class="num">{{ms .Summary.Max}}</td><td class="num">{{ms .Summary.Mean}}</td><td class="num">{{ms .Summary.StdDev}}</td><td class="num">{{.Outliers.Count}}{{if .Outliers.High}} (&gt; {{printf "%.3f" .Outliers.Upper}}){{end}}</td></tr>
+{{end}}
+</table>
+{{end}}
+
+{{range .Figures}}
+<h3>{{.Title}}</h3>
+<img src="{{.Data}}" alt="{{.Title}}">
+{{end}}
+
+<h2>Errors</h2>
+{{if .Errors}}
+<table>
+<tr><th>Scenario/operation/target</th><th>Status</th><th>Error</th><th>Count</th></tr>
+{{range .Errors}}<tr><td>{{.Key}}</td><td>{{.Status}}</td><td>{{.Error}}</td><td class="num">{{.Count}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>All commands succeeded.</p>
+{{end}}
+
+{{if .Baseline}}
+<h2>Comparison to baseline {{.Baseline}}</h2>
+<p>Changes of percentiles with bootstrapped 95% confidence intervals. Rows are marked if the lower bound exceeds {{pct .Threshold}} and a Mann-Whitney U test is significant.</p>
+<table>
+<tr><th>Scenario/operation/target</th><th>n (base vs. current)</th><th>p-value</th><th>Percentile</th><th>Base</th><th>Current</th><th>Change</th><th>CI</th></tr>
+{{range $c := .Comparisons}}{{range .Deltas}}<tr{{if $c.Regression}} class="regression"{{end}}><td>{{$c.Key}}</td><td>{{$c.N}}</td><td class="num">{{printf "%.4f" $c.P}}</td><td>p{{.Percentile}}</td><td class="num">{{printf "%.3f" .Base}}</td><td class="num">{{printf "%.3f" .Current}}</td><td class="num">{{pct .Relative}}</td><td>[{{pct .Lower}}, {{pct .Upper}}]</td></tr>
+{{end}}{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+// Functions
+
+// LoadRuns reads all run manifests of a directory, or
+// a single manifest or results file, with their records.
+func LoadRuns(path string) ([]Run, error) {
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{path}
+
+	if info.IsDir() {
+
+		files, err = filepath.Glob(filepath.Join(path, "*.manifest.json"))
+		if err != nil {
+			return nil, err
+		}
+
+		if len(files) == 0 {
+			return nil, fmt.Errorf("no run manifests found in '%s'", path)
+		}
+
+		sort.Strings(files)
+	}
+
+	runs := make([]Run, 0, len(files))
+
+	for _, file := range files {
+
+		run := Run{
+			File: file,
+		}
+
+		if strings.HasSuffix(file, ".manifest.json") {
+
+			run.Manifest, err = records.ReadManifest(file)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		run.Records, err = records.Load(file)
+		if err != nil {
+			return nil, err
+		}
+
+		runs = append(runs, run)
+	}
+
+	return runs, nil
+}
+
+// SplitRecords sorts records into groups keyed by
+// 'scenario/op/target' and returns the sorted keys.
+func SplitRecords(recs []records.Record) ([]string, map[string][]records.Record) {
+
+	groups := make(map[string][]records.Record)
+
+	for _, rec := range recs {
+
+		key := fmt.Sprintf("%s/%s/%s", rec.Scenario, rec.Op, rec.Target)
+		groups[key] = append(groups[key], rec)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys, groups
+}
+
+// Latencies returns completion times of all successful
+// records in milliseconds.
+func Latencies(recs []records.Record) []float64 {
+
+	latencies := make([]float64, 0, len(recs))
+
+	for _, rec := range recs {
+
+		if rec.Status == "OK" {
+			latencies = append(latencies, (float64(rec.Latency) / float64(time.Millisecond)))
+		}
+	}
+
+	return latencies
+}
+
+// BuildTables summarizes every operation on every
+// target, grouped into one table per scenario.
+func BuildTables(keys []string, groups map[string][]records.Record) []Table {
+
+	tables := make([]Table, 0, 1)
+
+	for _, key := range keys {
+
+		recs := groups[key]
+
+		results := stats.NewHistogram(3)
+		for _, rec := range recs {
+
+			if rec.Status == "OK" {
+				results.Record(rec.Latency)
+			} else {
+				results.RecordError()
+			}
+		}
+
+		if (len(tables) == 0) || (tables[(len(tables)-1)].Scenario != recs[0].Scenario) {
+			tables = append(tables, Table{
+				Scenario: recs[0].Scenario,
+			})
+		}
+
+		// Outliers are reported, not removed.
+		outliers, _ := stats.DetectOutliers(Latencies(recs), "iqr", 0)
+
+		table := &tables[(len(tables) - 1)]
+		table.Rows = append(table.Rows, Row{
+			Op:       recs[0].Op,
+			Target:   recs[0].Target,
+			Summary:  results.Summarize(),
+			Outliers: outliers,
+		})
+	}
+
+	return tables
+}
+
+// CountErrors counts failed commands by status and
+// error message.
+func CountErrors(keys []string, groups map[string][]records.Record) []ErrorCount {
+
+	counts := make([]ErrorCount, 0)
+
+	for _, key := range keys {
+
+		index := make(map[string]int)
+
+		for _, rec := range groups[key] {
+
+			if rec.Status == "OK" {
+				continue
+			}
+
+			kind := fmt.Sprintf("%s\x00%s", rec.Status, rec.Error)
+
+			i, found := index[kind]
+			if found != true {
+
+				i = len(counts)
+				index[kind] = i
+
+				counts = append(counts, ErrorCount{
+					Key:    key,
+					Status: rec.Status,
+					Error:  rec.Error,
+				})
+			}
+
+			counts[i].Count++
+		}
+	}
+
+	return counts
+}
+
+// BuildFigures draws a CDF and a latency-over-time plot
+// for each scenario with one data set per target and
+// encodes them as SVG data URLs.
+func BuildFigures(recs []records.Record) ([]Figure, error) {
+
+	scenarios := make([]string, 0, 1)
+	targets := make(map[string][]string)
+	split := make(map[string][]records.Record)
+
+	for _, rec := range recs {
+
+		if _, found := targets[rec.Scenario]; found != true {
+			scenarios = append(scenarios, rec.Scenario)
+			targets[rec.Scenario] = make([]string, 0, 2)
+		}
+
+		key := fmt.Sprintf("%s/%s", rec.Scenario, rec.Target)
+		if _, found := split[key]; found != true {
+			targets[rec.Scenario] = append(targets[rec.Scenario], rec.Target)
+		}
+
+		split[key] = append(split[key], rec)
+	}
+
+	figures := make([]Figure, 0, (2 * len(scenarios)))
+
+	for _, scenario := range scenarios {
+
+		sets := make([]plots.DataSet, 0, len(targets[scenario]))
+		for i, target := range targets[scenario] {
+			sets = append(sets, plots.FromRecords(target, i, split[fmt.Sprintf("%s/%s", scenario, target)]))
+		}
+
+		for _, kind := range []string{"cdf", "latency-time"} {
+
+			title := fmt.Sprintf("%s: %s", scenario, kind)
+
+			p, err := plots.New(kind, title, sets, plots.Options{
+				Window:     time.Second,
+				Percentile: 99.0,
+				PerConn:    true,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to plot %s: %s", title, err.Error())
+			}
+
+			svg, err := plots.Render(p, (8 * vg.Inch), (6 * vg.Inch), "svg")
+			if err != nil {
+				return nil, err
+			}
+
+			figures = append(figures, Figure{
+				Title: title,
+				Data:  template.URL(fmt.Sprintf("data:image/svg+xml;base64,%s", base64.StdEncoding.EncodeToString(svg))),
+			})
+		}
+	}
+
+	return figures, nil
+}
+
+// Compare computes changes of the median and tail
+// percentiles of all operations present in the current
+// and the baseline run, as compare-results does.
+func Compare(keys []string, groups map[string][]records.Record, baseGroups map[string][]records.Record, threshold float64, alpha float64) []Comparison {
+
+	rng := rand.New(rand.NewSource(1))
+	comparisons := make([]Comparison, 0, len(keys))
+
+	for _, key := range keys {
+
+		baseRecs, found := baseGroups[key]
+		if found != true {
+			continue
+		}
+
+		base := Latencies(baseRecs)
+		current := Latencies(groups[key])
+
+		if (len(base) == 0) || (len(current) == 0) {
+			continue
+		}
+
+		_, _, p := stats.MannWhitneyU(base, current)
+
+		c := Comparison{
+			Key: key,
+			N:   fmt.Sprintf("%d vs. %d", len(base), len(current)),
+			P:   p,
+		}
+
+		for _, percentile := range []float64{50, 90, 99} {
+
+			d := stats.BootstrapDelta(base, current, percentile, 1000, 0.95, rng)
+			if (d.Lower > threshold) && (p < alpha) {
+				c.Regression = true
+			}
+
+			c.Deltas = append(c.Deltas, d)
+		}
+
+		comparisons = append(comparisons, c)
+	}
+
+	return comparisons
+}
+
+// Usage prints out how to use this script and exits.
+func Usage() {
+
+	fmt.Printf("Please specify a run to report on.\nFor example:\n")
+	fmt.Printf("\t$ ./report-results -run results/append-2017-01-01-10-00-00.manifest.json\n")
+	fmt.Printf("\t$ ./report-results -run results/ -baseline old-results/ -out report.html\n")
+
+	os.Exit(1)
+}
+
+func main() {
+
+	runFlag := flag.String("run", "", "Supply run to report on: run directory containing run manifests, a single run manifest or results file.")
+	baselineFlag := flag.String("baseline", "", "Supply baseline run to compare against, in the same forms as -run.")
+	outFlag := flag.String("out", "", "Specify file name of HTML report. Defaults to 'report-<date>.html' next to the run.")
+	thresholdFlag := flag.Float64("threshold", 0.10, "Specify relative percentile increase regarded as regression, e.g. 0.10 for 10%.")
+	alphaFlag := flag.Float64("alpha", 0.05, "Specify significance level of Mann-Whitney U test a regression also needs to pass.")
+	warmupFlag := flag.String("warmup", "", "Exclude warm-up from analysis: first number of commands of each connection, e.g. 50, or first duration of each run, e.g. 5s.")
+	flag.Parse()
+
+	if *runFlag == "" {
+		Usage()
+	}
+
+	runs, err := LoadRuns(*runFlag)
+	if err != nil {
+		fmt.Printf("Failed to load run: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	warmup, err := records.ParseWarmup(*warmupFlag)
+	if err != nil {
+		fmt.Printf("Invalid warm-up: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	all := make([]records.Record, 0, 100)
+	for _, run := range runs {
+		all = append(all, run.Records...)
+	}
+
+	all, _, err = warmup.Split(all)
+	if err != nil {
+		fmt.Printf("Failed to exclude warm-up: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if len(all) == 0 {
+		fmt.Printf("Run contains no records.\n")
+		os.Exit(1)
+	}
+
+	keys, groups := SplitRecords(all)
+
+	report := Report{
+		Title:     fmt.Sprintf("pluto-evaluation report: %s", *runFlag),
+		Generated: time.Now(),
+		Runs:      runs,
+		Tables:    BuildTables(keys, groups),
+		Errors:    CountErrors(keys, groups),
+		Threshold: *thresholdFlag,
+	}
+
+	if warmup.IsZero() != true {
+		report.Warmup = warmup.String()
+	}
+
+	report.Figures, err = BuildFigures(all)
+	if err != nil {
+		fmt.Printf("Failed to draw plots: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if *baselineFlag != "" {
+
+		baseRuns, err := LoadRuns(*baselineFlag)
+		if err != nil {
+			fmt.Printf("Failed to load baseline run: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		baseRecs := make([]records.Record, 0, 100)
+		for _, run := range baseRuns {
+			baseRecs = append(baseRecs, run.Records...)
+		}
+
+		baseRecs, _, err = warmup.Split(baseRecs)
+		if err != nil {
+			fmt.Printf("Failed to exclude warm-up of baseline run: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		_, baseGroups := SplitRecords(baseRecs)
+
+		report.Baseline = *baselineFlag
+		report.Comparisons = Compare(keys, groups, baseGroups, *thresholdFlag, *alphaFlag)
+	}
+
+	// Place report next to the run by default.
+	outFileName := *outFlag
+	if outFileName == "" {
+
+		dir := *runFlag
+		if info, err := os.Stat(dir); (err != nil) || (info.IsDir() != true) {
+			dir = filepath.Dir(dir)
+		}
+
+		outFileName = filepath.Join(dir, fmt.Sprintf("report-%s.html", report.Generated.Format("2006-01-02-15-04-05")))
+	}
+
+	outFile, err := os.Create(outFileName)
+	if err != nil {
+		fmt.Printf("Failed to create report file: %s\n", err.Error())
+		os.Exit(1)
+	}
+	defer outFile.Close()
+
+	err = reportTemplate.Execute(outFile, report)
+	if err != nil {
+		fmt.Printf("Failed to write report: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	fmt.Printf("Wrote report to %s.\n", outFileName)
+}
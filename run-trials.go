@@ -0,0 +1,410 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"encoding/json"
+	"io/ioutil"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+)
+
+// Structs
+
+// Trial is one execution of the test binary. Target
+// is empty if the trial ran the test on all systems.
+type Trial struct {
+	Number   int       `json:"number"`
+	Target   string    `json:"target,omitempty"`
+	Manifest string    `json:"manifest"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+}
+
+// TrialSet describes all trials of one invocation
+// so that they can be analyzed again later on.
+type TrialSet struct {
+	Test    string    `json:"test"`
+	Args    []string  `json:"args"`
+	Targets []string  `json:"targets,omitempty"`
+	Date    time.Time `json:"date"`
+	Trials  []Trial   `json:"trials"`
+}
+
+// Variables
+
+// targetTests lists the tests that accept -target and
+// can thus be restricted to one target per trial. The
+// concurrent, conflict and interleaved tests always
+// run on all of their targets.
+var targetTests = []string{"test-append", "test-create", "test-delete", "test-store", "test-auth", "test-tls-matrix"}
+
+// Functions
+
+// SupportsTarget reports whether the test binary at
+// test accepts -target.
+func SupportsTarget(test string) bool {
+
+	name := strings.TrimSuffix(filepath.Base(test), ".exe")
+
+	for _, targetTest := range targetTests {
+
+		if name == targetTest {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Manifests returns all run manifests currently
+// present in the results folder.
+func Manifests() (map[string]bool, error) {
+
+	files, err := filepath.Glob("results/*.manifest.json")
+	if err != nil {
+		return nil, err
+	}
+
+	manifests := make(map[string]bool)
+	for _, file := range files {
+		manifests[file] = true
+	}
+
+	return manifests, nil
+}
+
+// RunTrial executes the test binary once, restricted
+// to target if not empty, and returns the trial with
+// the run manifest the test created.
+func RunTrial(test string, args []string, number int, target string) (Trial, error) {
+
+	trial := Trial{
+		Number: number,
+		Target: target,
+	}
+
+	before, err := Manifests()
+	if err != nil {
+		return trial, err
+	}
+
+	if target != "" {
+		args = append([]string{"-target", target}, args...)
+	}
+
+	cmd := exec.Command(test, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	trial.Started = time.Now()
+
+	err = cmd.Run()
+	if err != nil {
+		return trial, fmt.Errorf("test failed: %s", err.Error())
+	}
+
+	trial.Finished = time.Now()
+
+	after, err := Manifests()
+	if err != nil {
+		return trial, err
+	}
+
+	created := make([]string, 0, 1)
+	for file := range after {
+
+		if before[file] != true {
+			created = append(created, file)
+		}
+	}
+
+	if len(created) != 1 {
+		return trial, fmt.Errorf("expected test to create one run manifest in results folder, found %d", len(created))
+	}
+
+	trial.Manifest = created[0]
+
+	return trial, nil
+}
+
+// TrialMedians loads the records of each trial and
+// returns per group of scenario, operation and target
+// the median latency in ms of every trial containing
+// the group. Records in the warm-up window and failed
+// commands are left out.
+func TrialMedians(set *TrialSet, warmup records.Warmup) (map[string][]float64, error) {
+
+	medians := make(map[string][]float64)
+
+	for _, trial := range set.Trials {
+
+		recs, err := records.Load(trial.Manifest)
+		if err != nil {
+			return nil, fmt.Errorf("trial %d: %s", trial.Number, err.Error())
+		}
+
+		recs, _, err = warmup.Split(recs)
+		if err != nil {
+			return nil, fmt.Errorf("trial %d: %s", trial.Number, err.Error())
+		}
+
+		latencies := make(map[string][]float64)
+
+		for _, rec := range recs {
+
+			if rec.Status != "OK" {
+				continue
+			}
+
+			key := fmt.Sprintf("%s/%s/%s", rec.Scenario, rec.Op, rec.Target)
+			latencies[key] = append(latencies[key], (float64(rec.Latency) / float64(time.Millisecond)))
+		}
+
+		for key, values := range latencies {
+			medians[key] = append(medians[key], stats.Percentile(stats.Sorted(values), 50.0))
+		}
+	}
+
+	return medians, nil
+}
+
+// PrintTrials reports mean, confidence interval and
+// between-trial spread of the per-trial medians of each
+// group and compares targets of the same operation.
+func PrintTrials(medians map[string][]float64, confidence float64) {
+
+	keys := make([]string, 0, len(medians))
+	for key := range medians {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// Remember groups per operation in order to
+	// compare targets afterwards.
+	summaries := make(map[string]stats.Trials)
+	ops := make([]string, 0, len(keys))
+	targets := make(map[string][]string)
+
+	for _, key := range keys {
+
+		t := stats.SummarizeTrials(medians[key], confidence)
+		summaries[key] = t
+
+		parts := make([]string, len(t.Values))
+		for i, value := range t.Values {
+			parts[i] = fmt.Sprintf("%.3f", value)
+		}
+
+		fmt.Printf("\n%s: %d trials, medians %s ms\n", key, len(t.Values), strings.Join(parts, " "))
+
+		if len(t.Values) < 2 {
+			fmt.Printf("\tmean of medians %.3f ms, too few trials for confidence interval and variance\n", t.Mean)
+		} else {
+			fmt.Printf("\tmean of medians %.3f ms, %g%% CI [%.3f, %.3f] ms, between-trial variance %.4f ms², SD %.3f ms (CV %.1f%%)\n",
+				t.Mean, (confidence * 100.0), t.Lower, t.Upper, t.Variance, t.StdDev, (t.CV() * 100.0))
+		}
+
+		op := key[:strings.LastIndex(key, "/")]
+		if _, found := targets[op]; found != true {
+			ops = append(ops, op)
+		}
+		targets[op] = append(targets[op], key[(strings.LastIndex(key, "/")+1):])
+	}
+
+	for _, op := range ops {
+
+		if len(targets[op]) < 2 {
+			continue
+		}
+
+		fmt.Printf("\n%s:\n", op)
+
+		// Compare every further target against the first one.
+		base := summaries[fmt.Sprintf("%s/%s", op, targets[op][0])]
+
+		for _, target := range targets[op][1:] {
+
+			diff, lower, upper := stats.DiffTrials(base, summaries[fmt.Sprintf("%s/%s", op, target)], confidence)
+
+			if math.IsNaN(lower) {
+				fmt.Printf("\t%s vs. %s: %+.3f ms, too few trials for confidence interval\n", target, targets[op][0], diff)
+				continue
+			}
+
+			verdict := "no significant difference"
+			if (lower > 0) || (upper < 0) {
+				verdict = "significant"
+			}
+
+			fmt.Printf("\t%s vs. %s: %+.3f ms, %g%% CI [%+.3f, %+.3f] ms, %s\n",
+				target, targets[op][0], diff, (confidence * 100.0), lower, upper, verdict)
+		}
+	}
+}
+
+// Usage prints out how to use this script and exits.
+func Usage() {
+
+	fmt.Printf("Please specify a test binary to repeat or a trials file to analyze.\nFor example:\n")
+	fmt.Printf("\t$ ./run-trials -test ./test-append -trials 10 -abab -- -runs 200\n")
+	fmt.Printf("\t$ ./run-trials -analyze results/trials-append-2017-01-01-10-00-00.json -warmup 20\n")
+
+	os.Exit(1)
+}
+
+func main() {
+
+	// Make test binary, number of trials, alternation of
+	// targets and analysis configurable. All remaining
+	// arguments are handed to the test binary.
+	testFlag := flag.String("test", "", "Specify test binary to repeat, e.g. ./test-append.")
+	trialsFlag := flag.Int("trials", 5, "Specify how many trials of the test to run.")
+	ababFlag := flag.Bool("abab", false, "Alternate targets between trials (pluto, Dovecot, pluto, ...) instead of testing all targets within each trial.")
+	targetsFlag := flag.String("targets", "pluto,Dovecot", "Specify comma-separated targets to alternate between with -abab.")
+	pauseFlag := flag.Duration("pause", (2 * time.Second), "Specify pause between trials, at least 1s.")
+	analyzeFlag := flag.String("analyze", "", "Analyze trials file of an earlier invocation instead of running trials.")
+	confidenceFlag := flag.Float64("confidence", 0.95, "Specify level of confidence intervals.")
+	warmupFlag := flag.String("warmup", "", "Exclude warm-up of each trial: first number of commands of each connection, e.g. 50, or first duration of each run, e.g. 5s.")
+	flag.Parse()
+
+	if (*testFlag == "") == (*analyzeFlag == "") {
+		Usage()
+	}
+
+	warmup, err := records.ParseWarmup(*warmupFlag)
+	if err != nil {
+		fmt.Printf("Invalid warm-up: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if (*confidenceFlag <= 0) || (*confidenceFlag >= 1) {
+		fmt.Printf("Confidence level has to lie between 0 and 1.\n")
+		os.Exit(1)
+	}
+
+	set := &TrialSet{}
+
+	if *analyzeFlag != "" {
+
+		setRaw, err := ioutil.ReadFile(*analyzeFlag)
+		if err != nil {
+			fmt.Printf("Failed to read trials file: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		err = json.Unmarshal(setRaw, set)
+		if err != nil {
+			fmt.Printf("Failed to parse trials file '%s': %s\n", *analyzeFlag, err.Error())
+			os.Exit(1)
+		}
+
+	} else {
+
+		if *trialsFlag < 1 {
+			fmt.Printf("Please run at least one trial.\n")
+			os.Exit(1)
+		}
+
+		// Run manifests are named by the second the run
+		// started in, trials must not share one.
+		if *pauseFlag < time.Second {
+			fmt.Printf("Pause between trials has to be at least 1s.\n")
+			os.Exit(1)
+		}
+
+		set.Test = *testFlag
+		set.Args = flag.Args()
+		set.Date = time.Now()
+
+		// Without alternation, each trial tests all targets
+		// in the order built into the test.
+		targets := []string{""}
+		if *ababFlag {
+
+			if SupportsTarget(set.Test) != true {
+				fmt.Printf("Test '%s' cannot be restricted to one target, -abab only works with %s.\n", set.Test, strings.Join(targetTests, ", "))
+				os.Exit(1)
+			}
+
+			set.Targets = strings.Split(*targetsFlag, ",")
+			targets = set.Targets
+		}
+
+		setFileName := fmt.Sprintf("results/trials-%s-%s.json",
+			strings.TrimPrefix(filepath.Base(set.Test), "test-"), set.Date.Format("2006-01-02-15-04-05"))
+
+		// Store trials after each one so that an aborted
+		// invocation can still be analyzed.
+		writeSet := func() {
+
+			setRaw, err := json.MarshalIndent(set, "", "\t")
+			if err != nil {
+				fmt.Printf("Failed to encode trials: %s\n", err.Error())
+				os.Exit(1)
+			}
+
+			err = ioutil.WriteFile(setFileName, append(setRaw, '\n'), 0600)
+			if err != nil {
+				fmt.Printf("Failed to write trials file: %s\n", err.Error())
+				os.Exit(1)
+			}
+		}
+
+		for number := 1; number <= *trialsFlag; number++ {
+
+			for _, target := range targets {
+
+				if len(set.Trials) > 0 {
+					time.Sleep(*pauseFlag)
+				}
+
+				if target == "" {
+					fmt.Printf("Running trial %d of %d...\n", number, *trialsFlag)
+				} else {
+					fmt.Printf("Running trial %d of %d on %s...\n", number, *trialsFlag, target)
+				}
+
+				trial, err := RunTrial(set.Test, set.Args, number, strings.TrimSpace(target))
+				if err != nil {
+					fmt.Printf("Trial %d failed: %s\n", number, err.Error())
+					os.Exit(1)
+				}
+
+				set.Trials = append(set.Trials, trial)
+				writeSet()
+			}
+		}
+
+		fmt.Printf("\nStored trials in '%s'.\n", setFileName)
+	}
+
+	medians, err := TrialMedians(set, warmup)
+	if err != nil {
+		fmt.Printf("Failed to load trials: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if len(medians) == 0 {
+		fmt.Printf("Trials contain no successful commands.\n")
+		os.Exit(1)
+	}
+
+	order := "all targets within each trial"
+	if len(set.Targets) > 0 {
+		order = fmt.Sprintf("alternating %s", strings.Join(set.Targets, ", "))
+	}
+
+	fmt.Printf("\nTrials of '%s', %s:\n", strings.Join(append([]string{set.Test}, set.Args...), " "), order)
+
+	PrintTrials(medians, *confidenceFlag)
+}
@@ -0,0 +1,193 @@
+package stats
+
+import (
+	"math"
+	"sort"
+
+	"math/rand"
+)
+
+// Structs
+
+// Delta describes the relative change of one percentile
+// between a base and a current sample together with a
+// bootstrapped confidence interval of that change.
+type Delta struct {
+	Percentile float64
+	Base       float64
+	Current    float64
+	Relative   float64
+	Lower      float64
+	Upper      float64
+}
+
+// Functions
+
+// Percentile returns the value at percentile p (0-100)
+// of an ascendingly sorted sample, interpolating
+// linearly between the two closest ranks.
+func Percentile(sorted []float64, p float64) float64 {
+
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+
+	rank := (p / 100.0) * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+
+	if lower < 0 {
+		return sorted[0]
+	}
+
+	if upper >= len(sorted) {
+		return sorted[(len(sorted) - 1)]
+	}
+
+	frac := rank - float64(lower)
+
+	return sorted[lower] + (frac * (sorted[upper] - sorted[lower]))
+}
+
+// Sorted returns an ascendingly sorted copy of values.
+func Sorted(values []float64) []float64 {
+
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+
+	return sorted
+}
+
+// resamplePercentile draws len(values) values with
+// replacement and returns percentile p of the draw.
+func resamplePercentile(values []float64, buf []float64, p float64, rng *rand.Rand) float64 {
+
+	for i := range buf {
+		buf[i] = values[rng.Intn(len(values))]
+	}
+
+	sort.Float64s(buf)
+
+	return Percentile(buf, p)
+}
+
+// BootstrapDelta computes the relative change of
+// percentile p from base to current and a confidence
+// interval of it at level confidence (e.g. 0.95) via
+// the percentile bootstrap with supplied iterations.
+func BootstrapDelta(base []float64, current []float64, p float64, iterations int, confidence float64, rng *rand.Rand) Delta {
+
+	d := Delta{
+		Percentile: p,
+		Base:       Percentile(Sorted(base), p),
+		Current:    Percentile(Sorted(current), p),
+	}
+
+	d.Relative = (d.Current - d.Base) / d.Base
+
+	baseBuf := make([]float64, len(base))
+	currentBuf := make([]float64, len(current))
+	deltas := make([]float64, 0, iterations)
+
+	for i := 0; i < iterations; i++ {
+
+		b := resamplePercentile(base, baseBuf, p, rng)
+		c := resamplePercentile(current, currentBuf, p, rng)
+
+		if b != 0 {
+			deltas = append(deltas, ((c - b) / b))
+		}
+	}
+
+	sort.Float64s(deltas)
+
+	alpha := (1.0 - confidence) / 2.0
+	d.Lower = Percentile(deltas, (alpha * 100.0))
+	d.Upper = Percentile(deltas, ((1.0 - alpha) * 100.0))
+
+	return d
+}
+
+// MannWhitneyU performs a two-sided Mann-Whitney U test
+// of whether values in a and b stem from the same
+// distribution. It returns the U statistic of a, the
+// z score and the p-value of the normal approximation
+// with tie and continuity correction.
+func MannWhitneyU(a []float64, b []float64) (float64, float64, float64) {
+
+	type sample struct {
+		value float64
+		fromA bool
+	}
+
+	n1 := float64(len(a))
+	n2 := float64(len(b))
+	n := n1 + n2
+
+	if (n1 == 0) || (n2 == 0) {
+		return math.NaN(), math.NaN(), math.NaN()
+	}
+
+	all := make([]sample, 0, (len(a) + len(b)))
+	for _, v := range a {
+		all = append(all, sample{v, true})
+	}
+	for _, v := range b {
+		all = append(all, sample{v, false})
+	}
+
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].value < all[j].value
+	})
+
+	// Assign average ranks to tied values and
+	// accumulate the tie correction term.
+	rankSumA := 0.0
+	tieTerm := 0.0
+
+	for i := 0; i < len(all); {
+
+		j := i
+		for (j < len(all)) && (all[j].value == all[i].value) {
+			j++
+		}
+
+		rank := (float64(i+1) + float64(j)) / 2.0
+		ties := float64(j - i)
+		tieTerm += (ties * ties * ties) - ties
+
+		for k := i; k < j; k++ {
+			if all[k].fromA {
+				rankSumA += rank
+			}
+		}
+
+		i = j
+	}
+
+	u := rankSumA - ((n1 * (n1 + 1)) / 2.0)
+	mean := (n1 * n2) / 2.0
+	sigma := math.Sqrt(((n1 * n2) / 12.0) * ((n + 1) - (tieTerm / (n * (n - 1)))))
+
+	if sigma == 0 {
+		return u, 0, 1
+	}
+
+	// Apply continuity correction towards the mean.
+	diff := u - mean
+	if diff > 0 {
+		diff -= 0.5
+	} else if diff < 0 {
+		diff += 0.5
+	}
+
+	z := diff / sigma
+	p := math.Erfc(math.Abs(z) / math.Sqrt2)
+
+	return u, z, p
+}
@@ -0,0 +1,127 @@
+package stats
+
+import (
+	"math"
+	"testing"
+
+	"math/rand"
+)
+
+// Functions
+
+// TestPercentile checks linear interpolation between
+// closest ranks against values determined by hand.
+func TestPercentile(t *testing.T) {
+
+	tests := []struct {
+		sorted   []float64
+		p        float64
+		expected float64
+	}{
+		{[]float64{7}, 50.0, 7},
+		{[]float64{1, 2, 3, 4}, 0.0, 1},
+		{[]float64{1, 2, 3, 4}, 50.0, 2.5},
+		{[]float64{1, 2, 3, 4}, 100.0, 4},
+		{[]float64{10, 20, 30, 40, 50}, 90.0, 46},
+		{[]float64{10, 20, 30, 40, 50}, 25.0, 20},
+		{[]float64{10, 20, 30, 40, 50}, 110.0, 50},
+		{[]float64{10, 20, 30, 40, 50}, -10.0, 10},
+	}
+
+	for _, test := range tests {
+
+		value := Percentile(test.sorted, test.p)
+		if math.Abs(value-test.expected) > 1e-9 {
+			t.Errorf("p%v of %v: expected %v but got %v", test.p, test.sorted, test.expected, value)
+		}
+	}
+
+	if math.IsNaN(Percentile([]float64{}, 50.0)) != true {
+		t.Errorf("expected percentile of empty sample to be NaN")
+	}
+}
+
+// TestMannWhitneyU checks U statistic, z score and
+// p-value of the normal approximation with continuity
+// and tie correction against reference values.
+func TestMannWhitneyU(t *testing.T) {
+
+	tests := []struct {
+		name string
+		a    []float64
+		b    []float64
+		u    float64
+		z    float64
+		p    float64
+	}{
+		// Complete separation of 3 and 3 values:
+		// sigma = sqrt(9/12 * 7), z = -4 / sigma.
+		{"separated", []float64{1, 2, 3}, []float64{4, 5, 6}, 0, -1.7457431218879391, 0.080855598},
+		{"separated reversed", []float64{4, 5, 6}, []float64{1, 2, 3}, 9, 1.7457431218879391, 0.080855598},
+
+		// Interleaved values of equal rank sums.
+		{"interleaved", []float64{1, 4, 5, 8}, []float64{2, 3, 6, 7}, 8, 0, 1},
+
+		// Ties across samples: ranks 1, 3, 3, 5.5 of a,
+		// tie term 24 + 6 = 30 reduces sigma to
+		// sqrt(16/12 * (9 - 30/56)).
+		{"ties", []float64{1, 2, 2, 3}, []float64{2, 3, 4, 5}, 2.5, -1.4883513944689681, 0.136658248},
+
+		// All values equal, no evidence of a shift.
+		{"identical", []float64{3, 3, 3}, []float64{3, 3}, 3, 0, 1},
+	}
+
+	for _, test := range tests {
+
+		u, z, p := MannWhitneyU(test.a, test.b)
+
+		if math.Abs(u-test.u) > 1e-9 {
+			t.Errorf("%s: expected U %v but got %v", test.name, test.u, u)
+		}
+
+		if math.Abs(z-test.z) > 1e-9 {
+			t.Errorf("%s: expected z %v but got %v", test.name, test.z, z)
+		}
+
+		if math.Abs(p-test.p) > 1e-6 {
+			t.Errorf("%s: expected p-value %v but got %v", test.name, test.p, p)
+		}
+	}
+
+	u, z, p := MannWhitneyU([]float64{}, []float64{1})
+	if (math.IsNaN(u) != true) || (math.IsNaN(z) != true) || (math.IsNaN(p) != true) {
+		t.Errorf("expected NaN results for empty sample but got %v, %v, %v", u, z, p)
+	}
+}
+
+// TestBootstrapDelta checks relative change and
+// interval of samples whose resamples cannot vary.
+func TestBootstrapDelta(t *testing.T) {
+
+	base := []float64{10, 10, 10, 10}
+	current := []float64{12, 12, 12}
+
+	d := BootstrapDelta(base, current, 50.0, 200, 0.95, rand.New(rand.NewSource(1)))
+
+	if (d.Base != 10) || (d.Current != 12) {
+		t.Errorf("expected base 10 and current 12 but got %v and %v", d.Base, d.Current)
+	}
+
+	for _, value := range []float64{d.Relative, d.Lower, d.Upper} {
+
+		if math.Abs(value-0.2) > 1e-9 {
+			t.Errorf("expected relative change and interval of 0.2 but got %+v", d)
+			break
+		}
+	}
+
+	// Resamples of one sample vary, the interval
+	// needs to cover the observed change.
+	sample := []float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	d = BootstrapDelta(sample, sample, 50.0, 500, 0.95, rand.New(rand.NewSource(1)))
+
+	if (d.Relative != 0) || (d.Lower > 0) || (d.Upper < 0) || (d.Lower >= d.Upper) {
+		t.Errorf("expected interval around 0 but got %+v", d)
+	}
+}
@@ -0,0 +1,67 @@
+package stats
+
+import (
+	"math"
+)
+
+// Functions
+
+// Bandwidth returns the bandwidth for a Gaussian kernel
+// density estimate of values following Silverman's
+// rule of thumb.
+func Bandwidth(values []float64) float64 {
+
+	n := float64(len(values))
+	if n < 2 {
+		return 1.0
+	}
+
+	sorted := Sorted(values)
+
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean = mean / n
+
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+	stdDev := math.Sqrt(variance / (n - 1))
+
+	iqr := (Percentile(sorted, 75.0) - Percentile(sorted, 25.0)) / 1.34
+
+	spread := stdDev
+	if (iqr > 0) && (iqr < spread) {
+		spread = iqr
+	}
+
+	if spread == 0 {
+		return 1.0
+	}
+
+	return 0.9 * spread * math.Pow(n, -0.2)
+}
+
+// KernelDensity estimates the probability density of
+// values at each of points using a Gaussian kernel of
+// supplied bandwidth.
+func KernelDensity(values []float64, points []float64, bandwidth float64) []float64 {
+
+	densities := make([]float64, len(points))
+	norm := 1.0 / (float64(len(values)) * bandwidth * math.Sqrt(2.0*math.Pi))
+
+	for i, x := range points {
+
+		sum := 0.0
+		for _, v := range values {
+			u := (x - v) / bandwidth
+			sum += math.Exp(-0.5 * u * u)
+		}
+
+		densities[i] = sum * norm
+	}
+
+	return densities
+}
@@ -0,0 +1,4 @@
+/*
+Package stats provides facilities to record measured latencies and summarize them.
+*/
+package stats
@@ -0,0 +1,28 @@
+package stats
+
+// Functions
+
+// JainIndex computes Jain's fairness index of values,
+// e.g. the throughput of each connection. It ranges
+// from 1/n, if one value dominates all others, to 1,
+// if all values are equal.
+func JainIndex(values []float64) float64 {
+
+	if len(values) == 0 {
+		return 0.0
+	}
+
+	sum := 0.0
+	sumSquares := 0.0
+
+	for _, v := range values {
+		sum += v
+		sumSquares += v * v
+	}
+
+	if sumSquares == 0 {
+		return 1.0
+	}
+
+	return (sum * sum) / (float64(len(values)) * sumSquares)
+}
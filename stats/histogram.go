@@ -0,0 +1,275 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"math/bits"
+)
+
+// Structs
+
+// Histogram records latencies in nanoseconds in the
+// fashion of an HDR histogram: values are sorted into
+// buckets of exponentially growing size, each split into
+// a fixed number of linear sub-buckets. This keeps the
+// relative error of every reported percentile below
+// the configured number of significant digits while
+// memory stays independent of the number of samples.
+// It is safe for concurrent use.
+type Histogram struct {
+	lock          *sync.Mutex
+	subBucketBits uint
+	counts        []int64
+	count         int64
+	errors        int64
+	min           int64
+	max           int64
+	sum           float64
+	sumSquares    float64
+}
+
+// Summary condenses a histogram into the statistics
+// printed at the end of each test run.
+type Summary struct {
+	Count  int64
+	Errors int64
+	Min    int64
+	Max    int64
+	Mean   float64
+	StdDev float64
+	P50    int64
+	P90    int64
+	P99    int64
+	P999   int64
+}
+
+// Functions
+
+// NewHistogram returns an empty histogram recording
+// values with supplied number of significant digits.
+func NewHistogram(significantDigits int) *Histogram {
+
+	// Sub-buckets of each bucket need to be able to
+	// distinguish 2 * 10^digits values.
+	largestSingleUnit := 2 * int64(math.Pow10(significantDigits))
+	subBucketBits := uint(bits.Len64(uint64(largestSingleUnit - 1)))
+
+	return &Histogram{
+		lock:          &sync.Mutex{},
+		subBucketBits: subBucketBits,
+		counts:        make([]int64, (1 << subBucketBits)),
+		min:           math.MaxInt64,
+	}
+}
+
+// index returns the position in the counts slice
+// value is to be recorded at.
+func (h *Histogram) index(value int64) int {
+
+	subBucketCount := int64(1) << h.subBucketBits
+
+	// Small values are recorded exactly.
+	if value < subBucketCount {
+		return int(value)
+	}
+
+	// Determine by how many bits value needs to be
+	// shifted to fit into the sub-buckets.
+	shift := uint(bits.Len64(uint64(value))) - h.subBucketBits
+	subBucket := value >> shift
+
+	// Only the upper half of the sub-buckets is used
+	// by every bucket after the first.
+	halfCount := subBucketCount / 2
+
+	return int(subBucketCount + (int64(shift-1) * halfCount) + (subBucket - halfCount))
+}
+
+// highestEquivalentValue returns the largest value
+// that is recorded into the counts slot at index.
+func (h *Histogram) highestEquivalentValue(index int) int64 {
+
+	subBucketCount := int64(1) << h.subBucketBits
+
+	if int64(index) < subBucketCount {
+		return int64(index)
+	}
+
+	halfCount := subBucketCount / 2
+	offset := int64(index) - subBucketCount
+
+	shift := uint(offset/halfCount) + 1
+	subBucket := (offset % halfCount) + halfCount
+
+	return ((subBucket + 1) << shift) - 1
+}
+
+// Record adds one measured value in nanoseconds.
+func (h *Histogram) Record(value int64) {
+
+	if value < 0 {
+		value = 0
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	i := h.index(value)
+
+	// Grow counts slice on demand.
+	if i >= len(h.counts) {
+		counts := make([]int64, (i + 1))
+		copy(counts, h.counts)
+		h.counts = counts
+	}
+
+	h.counts[i]++
+	h.count++
+	h.sum += float64(value)
+	h.sumSquares += float64(value) * float64(value)
+
+	if value < h.min {
+		h.min = value
+	}
+
+	if value > h.max {
+		h.max = value
+	}
+}
+
+// RecordError counts one command that did not
+// complete successfully.
+func (h *Histogram) RecordError() {
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.errors++
+}
+
+// ValueAtPercentile returns the value below or equal
+// to which percentile percent of recorded values fall.
+func (h *Histogram) ValueAtPercentile(percentile float64) int64 {
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.valueAtPercentile(percentile)
+}
+
+// valueAtPercentile expects the lock to be held.
+func (h *Histogram) valueAtPercentile(percentile float64) int64 {
+
+	if h.count == 0 {
+		return 0
+	}
+
+	if percentile > 100.0 {
+		percentile = 100.0
+	}
+
+	// Determine how many values need to be passed.
+	target := int64(math.Ceil((percentile / 100.0) * float64(h.count)))
+	if target < 1 {
+		target = 1
+	}
+
+	var seen int64 = 0
+
+	for i, count := range h.counts {
+
+		seen += count
+
+		if seen >= target {
+
+			value := h.highestEquivalentValue(i)
+
+			// Never report more than was recorded.
+			if value > h.max {
+				value = h.max
+			}
+
+			return value
+		}
+	}
+
+	return h.max
+}
+
+// Summarize computes all statistics of interest
+// over the values recorded so far.
+func (h *Histogram) Summarize() Summary {
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	s := Summary{
+		Count:  h.count,
+		Errors: h.errors,
+		Max:    h.max,
+		P50:    h.valueAtPercentile(50.0),
+		P90:    h.valueAtPercentile(90.0),
+		P99:    h.valueAtPercentile(99.0),
+		P999:   h.valueAtPercentile(99.9),
+	}
+
+	if h.count > 0 {
+
+		s.Min = h.min
+		s.Mean = h.sum / float64(h.count)
+
+		variance := (h.sumSquares / float64(h.count)) - (s.Mean * s.Mean)
+		if variance > 0 {
+			s.StdDev = math.Sqrt(variance)
+		}
+	}
+
+	return s
+}
+
+// ms converts nanoseconds to milliseconds.
+func ms(value float64) float64 {
+	return value / float64(time.Millisecond)
+}
+
+// String formats the summary as lines of 'key: value'
+// pairs with all latencies given in milliseconds.
+func (s Summary) String() string {
+
+	return fmt.Sprintf("count: %d\nerrors: %d\nmin: %f\nmean: %f\nstddev: %f\np50: %f\np90: %f\np99: %f\np99.9: %f\nmax: %f\n",
+		s.Count, s.Errors, ms(float64(s.Min)), ms(s.Mean), ms(s.StdDev),
+		ms(float64(s.P50)), ms(float64(s.P90)), ms(float64(s.P99)), ms(float64(s.P999)), ms(float64(s.Max)))
+}
+
+// Line formats the summary into one line suitable
+// for printing at the end of a test run.
+func (s Summary) Line() string {
+
+	return fmt.Sprintf("p50 %.3f ms, p90 %.3f ms, p99 %.3f ms, p99.9 %.3f ms, max %.3f ms, mean %.3f ms, stddev %.3f ms, %d errors",
+		ms(float64(s.P50)), ms(float64(s.P90)), ms(float64(s.P99)), ms(float64(s.P999)), ms(float64(s.Max)),
+		ms(s.Mean), ms(s.StdDev), s.Errors)
+}
+
+// WriteSummaryFile stores supplied summary next to the
+// raw results of a run, prepended with the same meta
+// information the result log files carry.
+func WriteSummaryFile(fileName string, subject string, platform string, date time.Time, s Summary) error {
+
+	summaryFile, err := os.Create(fileName)
+	if err != nil {
+		return fmt.Errorf("failed to create summary file '%s': %s", fileName, err.Error())
+	}
+	defer summaryFile.Close()
+
+	// Prepend file with meta information about this test.
+	_, err = summaryFile.WriteString(fmt.Sprintf("Subject: %s\nPlatform: %s\nDate: %s\n-----\n%s", subject, platform, date.Format("2006-01-02-15-04-05"), s.String()))
+	if err != nil {
+		return fmt.Errorf("failed to write summary file '%s': %s", fileName, err.Error())
+	}
+
+	return summaryFile.Sync()
+}
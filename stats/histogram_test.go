@@ -0,0 +1,169 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+// Functions
+
+// TestHistogramPercentiles checks percentiles of small
+// samples, which are recorded exactly, against values
+// determined by hand.
+func TestHistogramPercentiles(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		values     []int64
+		percentile float64
+		expected   int64
+	}{
+		{"empty", []int64{}, 50.0, 0},
+		{"single", []int64{42}, 50.0, 42},
+		{"single p0", []int64{42}, 0.0, 42},
+		{"1 to 100 p50", sequence(1, 100), 50.0, 50},
+		{"1 to 100 p90", sequence(1, 100), 90.0, 90},
+		{"1 to 100 p99", sequence(1, 100), 99.0, 99},
+		{"1 to 100 p99.9", sequence(1, 100), 99.9, 100},
+		{"1 to 100 p100", sequence(1, 100), 100.0, 100},
+		{"1 to 100 above p100", sequence(1, 100), 150.0, 100},
+		{"1 to 1000 p50", sequence(1, 1000), 50.0, 500},
+		{"negative as zero", []int64{-5, 10}, 50.0, 0},
+	}
+
+	for _, test := range tests {
+
+		h := NewHistogram(3)
+		for _, v := range test.values {
+			h.Record(v)
+		}
+
+		value := h.ValueAtPercentile(test.percentile)
+		if value != test.expected {
+			t.Errorf("%s: expected p%v to be %d but got %d", test.name, test.percentile, test.expected, value)
+		}
+	}
+}
+
+// TestHistogramPrecision checks that large values are
+// reported with a relative error below the configured
+// number of significant digits and never above max.
+func TestHistogramPrecision(t *testing.T) {
+
+	tests := []struct {
+		digits int
+		value  int64
+	}{
+		{3, 2047},
+		{3, 2048},
+		{3, 2049},
+		{3, 123456},
+		{3, 1000000},
+		{3, 987654321},
+		{2, 54321},
+		{2, 3000000000},
+		{4, 12345678},
+	}
+
+	for _, test := range tests {
+
+		h := NewHistogram(test.digits)
+
+		// Record next to a larger value, so that the
+		// median is not capped at max.
+		h.Record(test.value)
+		h.Record(test.value * 4)
+
+		value := h.ValueAtPercentile(50.0)
+		limit := math.Pow10(-test.digits)
+
+		if value < test.value {
+			t.Errorf("%d digits: expected p50 of at least %d but got %d", test.digits, test.value, value)
+		}
+
+		if (float64(value-test.value) / float64(test.value)) > limit {
+			t.Errorf("%d digits: p50 %d deviates from %d by more than %v", test.digits, value, test.value, limit)
+		}
+
+		max := h.ValueAtPercentile(100.0)
+		if max != (test.value * 4) {
+			t.Errorf("%d digits: expected p100 to be max %d but got %d", test.digits, (test.value * 4), max)
+		}
+	}
+}
+
+// TestHistogramBuckets checks that every counts slot
+// reports the largest value mapped to it.
+func TestHistogramBuckets(t *testing.T) {
+
+	h := NewHistogram(3)
+
+	for _, value := range []int64{0, 1, 2047, 2048, 2049, 4095, 4096, 4097, 65535, 65536, 1 << 40} {
+
+		i := h.index(value)
+		highest := h.highestEquivalentValue(i)
+
+		if highest < value {
+			t.Errorf("value %d: slot %d reports smaller value %d", value, i, highest)
+		}
+
+		if h.index(highest) != i {
+			t.Errorf("value %d: highest equivalent value %d maps to slot %d instead of %d", value, highest, h.index(highest), i)
+		}
+
+		if h.index(highest+1) != (i + 1) {
+			t.Errorf("value %d: value %d after slot %d maps to slot %d", value, (highest + 1), i, h.index(highest+1))
+		}
+	}
+}
+
+// TestHistogramSummarize checks mean, standard
+// deviation and counters of a known sample.
+func TestHistogramSummarize(t *testing.T) {
+
+	h := NewHistogram(3)
+
+	for _, v := range []int64{2, 4, 4, 4, 5, 5, 7, 9} {
+		h.Record(v)
+	}
+
+	h.RecordError()
+
+	s := h.Summarize()
+
+	if (s.Count != 8) || (s.Errors != 1) {
+		t.Errorf("expected 8 values and 1 error but got %d and %d", s.Count, s.Errors)
+	}
+
+	if (s.Min != 2) || (s.Max != 9) {
+		t.Errorf("expected min 2 and max 9 but got %d and %d", s.Min, s.Max)
+	}
+
+	if s.Mean != 5.0 {
+		t.Errorf("expected mean 5 but got %v", s.Mean)
+	}
+
+	if math.Abs(s.StdDev-2.0) > 1e-9 {
+		t.Errorf("expected standard deviation 2 but got %v", s.StdDev)
+	}
+
+	if (s.P50 != 4) || (s.P90 != 9) {
+		t.Errorf("expected p50 4 and p90 9 but got %d and %d", s.P50, s.P90)
+	}
+
+	empty := NewHistogram(3).Summarize()
+	if (empty.Count != 0) || (empty.Min != 0) || (empty.Mean != 0) {
+		t.Errorf("expected empty summary to be zero but got %+v", empty)
+	}
+}
+
+// sequence returns all values from first to last.
+func sequence(first int64, last int64) []int64 {
+
+	values := make([]int64, 0, (last - first + 1))
+	for v := first; v <= last; v++ {
+		values = append(values, v)
+	}
+
+	return values
+}
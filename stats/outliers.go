@@ -0,0 +1,133 @@
+package stats
+
+import (
+	"fmt"
+	"math"
+)
+
+// Structs
+
+// Outliers holds the bounds outside of which values
+// are considered outliers and all values found there.
+type Outliers struct {
+	Method string
+	K      float64
+	Lower  float64
+	Upper  float64
+	Low    []float64
+	High   []float64
+}
+
+// Variables
+
+// OutlierMethods lists all supported methods of
+// outlier detection with their default factor.
+var OutlierMethods = map[string]float64{
+	"iqr": 1.5,
+	"mad": 3.5,
+}
+
+// Functions
+
+// median returns the median of an ascendingly
+// sorted sample.
+func median(sorted []float64) float64 {
+	return Percentile(sorted, 50.0)
+}
+
+// DetectOutliers finds outliers in values. With method
+// 'iqr', values further than k interquartile ranges
+// below the first or above the third quartile are
+// outliers (Tukey's fences). With method 'mad', values
+// further than k scaled median absolute deviations
+// from the median are. A k of 0 selects the default.
+func DetectOutliers(values []float64, method string, k float64) (Outliers, error) {
+
+	defaultK, found := OutlierMethods[method]
+	if found != true {
+		return Outliers{}, fmt.Errorf("unknown outlier method '%s', use iqr or mad", method)
+	}
+
+	if k <= 0 {
+		k = defaultK
+	}
+
+	o := Outliers{
+		Method: method,
+		K:      k,
+		Lower:  math.Inf(-1),
+		Upper:  math.Inf(1),
+	}
+
+	if len(values) < 4 {
+		return o, nil
+	}
+
+	sorted := Sorted(values)
+
+	switch method {
+
+	case "iqr":
+
+		q1 := Percentile(sorted, 25.0)
+		q3 := Percentile(sorted, 75.0)
+		o.Lower = q1 - (k * (q3 - q1))
+		o.Upper = q3 + (k * (q3 - q1))
+
+	case "mad":
+
+		m := median(sorted)
+
+		deviations := make([]float64, len(sorted))
+		for i, v := range sorted {
+			deviations[i] = math.Abs(v - m)
+		}
+
+		// Scale MAD to estimate the standard deviation
+		// of normally distributed values.
+		mad := 1.4826 * median(Sorted(deviations))
+		o.Lower = m - (k * mad)
+		o.Upper = m + (k * mad)
+	}
+
+	for _, v := range sorted {
+
+		if v < o.Lower {
+			o.Low = append(o.Low, v)
+		} else if v > o.Upper {
+			o.High = append(o.High, v)
+		}
+	}
+
+	return o, nil
+}
+
+// Count returns the number of outliers found.
+func (o Outliers) Count() int {
+	return len(o.Low) + len(o.High)
+}
+
+// IsOutlier reports whether v lies outside the bounds.
+func (o Outliers) IsOutlier(v float64) bool {
+	return (v < o.Lower) || (v > o.Upper)
+}
+
+// String describes found outliers in one line.
+func (o Outliers) String() string {
+
+	if o.Count() == 0 {
+		return fmt.Sprintf("no outliers (%s, k = %g)", o.Method, o.K)
+	}
+
+	max := math.Inf(-1)
+	for _, v := range o.High {
+		max = math.Max(max, v)
+	}
+
+	s := fmt.Sprintf("%d outliers (%s, k = %g): %d below %.3f, %d above %.3f", o.Count(), o.Method, o.K, len(o.Low), o.Lower, len(o.High), o.Upper)
+	if len(o.High) > 0 {
+		s = fmt.Sprintf("%s, up to %.3f", s, max)
+	}
+
+	return s
+}
@@ -0,0 +1,223 @@
+package stats
+
+import (
+	"math"
+)
+
+// Structs
+
+// Trials aggregates one statistic, e.g. the median
+// latency, measured once in each of several repeated
+// trials of the same scenario.
+type Trials struct {
+	Values     []float64
+	Mean       float64
+	Variance   float64
+	StdDev     float64
+	Confidence float64
+	Lower      float64
+	Upper      float64
+}
+
+// Functions
+
+// SummarizeTrials computes mean and between-trial
+// variance of values together with a confidence
+// interval of the mean at level confidence (e.g. 0.95)
+// based on Student's t distribution. With fewer than
+// two trials, variance and interval are NaN.
+func SummarizeTrials(values []float64, confidence float64) Trials {
+
+	t := Trials{
+		Values:     values,
+		Mean:       math.NaN(),
+		Variance:   math.NaN(),
+		StdDev:     math.NaN(),
+		Confidence: confidence,
+		Lower:      math.NaN(),
+		Upper:      math.NaN(),
+	}
+
+	n := float64(len(values))
+	if n == 0 {
+		return t
+	}
+
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	t.Mean = sum / n
+
+	if n < 2 {
+		return t
+	}
+
+	squares := 0.0
+	for _, v := range values {
+		squares += (v - t.Mean) * (v - t.Mean)
+	}
+
+	t.Variance = squares / (n - 1)
+	t.StdDev = math.Sqrt(t.Variance)
+
+	half := StudentTQuantile((1.0-((1.0-confidence)/2.0)), (n-1)) * (t.StdDev / math.Sqrt(n))
+	t.Lower = t.Mean - half
+	t.Upper = t.Mean + half
+
+	return t
+}
+
+// CV returns the coefficient of variation of the
+// trials, i.e. their standard deviation relative
+// to their mean.
+func (t Trials) CV() float64 {
+	return t.StdDev / t.Mean
+}
+
+// DiffTrials returns the difference of the means of
+// b and a together with a confidence interval of it
+// at level confidence, following Welch's unequal
+// variances t-test.
+func DiffTrials(a Trials, b Trials, confidence float64) (float64, float64, float64) {
+
+	diff := b.Mean - a.Mean
+
+	na := float64(len(a.Values))
+	nb := float64(len(b.Values))
+
+	if (na < 2) || (nb < 2) {
+		return diff, math.NaN(), math.NaN()
+	}
+
+	va := a.Variance / na
+	vb := b.Variance / nb
+
+	if (va + vb) == 0 {
+		return diff, diff, diff
+	}
+
+	// Welch-Satterthwaite degrees of freedom.
+	df := ((va + vb) * (va + vb)) / (((va * va) / (na - 1)) + ((vb * vb) / (nb - 1)))
+
+	half := StudentTQuantile((1.0-((1.0-confidence)/2.0)), df) * math.Sqrt(va+vb)
+
+	return diff, (diff - half), (diff + half)
+}
+
+// StudentTQuantile returns the value below which a
+// fraction p of Student's t distribution with df
+// degrees of freedom lies.
+func StudentTQuantile(p float64, df float64) float64 {
+
+	if (p <= 0) || (p >= 1) || (df <= 0) {
+		return math.NaN()
+	}
+
+	if p < 0.5 {
+		return -StudentTQuantile((1.0 - p), df)
+	}
+
+	// Bisect the distribution function, which is
+	// monotonic, until the interval is small enough.
+	low := 0.0
+	high := 1.0
+
+	for studentTCDF(high, df) < p {
+		high *= 2
+	}
+
+	for i := 0; i < 100; i++ {
+
+		mid := (low + high) / 2.0
+
+		if studentTCDF(mid, df) < p {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return (low + high) / 2.0
+}
+
+// studentTCDF returns the probability of a value of
+// Student's t distribution with df degrees of freedom
+// being at most t.
+func studentTCDF(t float64, df float64) float64 {
+
+	tail := 0.5 * regularizedBeta((df/(df+(t*t))), (df/2.0), 0.5)
+
+	if t > 0 {
+		return 1.0 - tail
+	}
+
+	return tail
+}
+
+// regularizedBeta computes the regularized incomplete
+// beta function I_x(a, b) by its continued fraction.
+func regularizedBeta(x float64, a float64, b float64) float64 {
+
+	if x <= 0 {
+		return 0.0
+	}
+
+	if x >= 1 {
+		return 1.0
+	}
+
+	// The continued fraction converges quickly only
+	// below this bound, use the symmetry otherwise.
+	if x > ((a + 1.0) / (a + b + 2.0)) {
+		return 1.0 - regularizedBeta((1.0-x), b, a)
+	}
+
+	lga, _ := math.Lgamma(a)
+	lgb, _ := math.Lgamma(b)
+	lgab, _ := math.Lgamma(a + b)
+
+	front := math.Exp((lgab-lga-lgb)+(a*math.Log(x))+(b*math.Log(1.0-x))) / a
+
+	// Evaluate the continued fraction with the
+	// modified Lentz method.
+	const tiny = 1e-300
+
+	f := 1.0
+	c := 1.0
+	d := 0.0
+
+	for i := 0; i <= 300; i++ {
+
+		m := float64(i / 2)
+
+		var numerator float64
+		switch {
+		case i == 0:
+			numerator = 1.0
+		case (i % 2) == 0:
+			numerator = (m * (b - m) * x) / ((a + (2.0 * m) - 1.0) * (a + (2.0 * m)))
+		default:
+			numerator = -((a + m) * (a + b + m) * x) / ((a + (2.0 * m)) * (a + (2.0 * m) + 1.0))
+		}
+
+		d = 1.0 + (numerator * d)
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		d = 1.0 / d
+
+		c = 1.0 + (numerator / c)
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+
+		f *= c * d
+
+		if math.Abs(1.0-(c*d)) < 1e-12 {
+			return front * (f - 1.0)
+		}
+	}
+
+	return front * (f - 1.0)
+}
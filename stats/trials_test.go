@@ -0,0 +1,111 @@
+package stats
+
+import (
+	"math"
+	"testing"
+)
+
+// Functions
+
+// TestStudentTQuantile checks quantiles of Student's t
+// distribution against values of common t tables.
+func TestStudentTQuantile(t *testing.T) {
+
+	tests := []struct {
+		p        float64
+		df       float64
+		expected float64
+	}{
+		{0.975, 1, 12.706204736},
+		{0.975, 4, 2.776445105},
+		{0.975, 10, 2.228138852},
+		{0.95, 5, 2.015048373},
+		{0.995, 30, 2.749995654},
+		{0.5, 7, 0},
+		{0.025, 10, -2.228138852},
+	}
+
+	for _, test := range tests {
+
+		value := StudentTQuantile(test.p, test.df)
+		if math.Abs(value-test.expected) > 1e-6 {
+			t.Errorf("quantile %v with %v degrees of freedom: expected %v but got %v", test.p, test.df, test.expected, value)
+		}
+	}
+
+	for _, p := range []float64{0, 1} {
+
+		if math.IsNaN(StudentTQuantile(p, 5)) != true {
+			t.Errorf("expected quantile %v to be NaN", p)
+		}
+	}
+}
+
+// TestSummarizeTrials checks mean, sample variance and
+// confidence interval of the mean of known trials.
+func TestSummarizeTrials(t *testing.T) {
+
+	trials := SummarizeTrials([]float64{1, 2, 3, 4, 5}, 0.95)
+
+	if (trials.Mean != 3) || (trials.Variance != 2.5) {
+		t.Errorf("expected mean 3 and variance 2.5 but got %v and %v", trials.Mean, trials.Variance)
+	}
+
+	// Half width is t(0.975, 4) * sqrt(2.5) / sqrt(5).
+	if (math.Abs(trials.Lower-1.036756839) > 1e-6) || (math.Abs(trials.Upper-4.963243161) > 1e-6) {
+		t.Errorf("expected interval [1.036757, 4.963243] but got [%v, %v]", trials.Lower, trials.Upper)
+	}
+
+	single := SummarizeTrials([]float64{7}, 0.95)
+	if (single.Mean != 7) || (math.IsNaN(single.Variance) != true) || (math.IsNaN(single.Lower) != true) {
+		t.Errorf("expected mean 7 and NaN variance of single trial but got %+v", single)
+	}
+}
+
+// TestDiffTrials checks the Welch interval of the
+// difference of two means.
+func TestDiffTrials(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		a     []float64
+		b     []float64
+		diff  float64
+		lower float64
+		upper float64
+	}{
+		// Equal variances and sizes give 4 degrees
+		// of freedom, half width t(0.975, 4) * sqrt(2/3).
+		{"equal variances", []float64{1, 2, 3}, []float64{4, 5, 6}, 3, 0.733042065, 5.266957935},
+
+		// Without any variance, the interval collapses.
+		{"constant", []float64{2, 2}, []float64{5, 5, 5}, 3, 3, 3},
+	}
+
+	for _, test := range tests {
+
+		diff, lower, upper := DiffTrials(SummarizeTrials(test.a, 0.95), SummarizeTrials(test.b, 0.95), 0.95)
+
+		if (math.Abs(diff-test.diff) > 1e-9) || (math.Abs(lower-test.lower) > 1e-6) || (math.Abs(upper-test.upper) > 1e-6) {
+			t.Errorf("%s: expected %v [%v, %v] but got %v [%v, %v]", test.name, test.diff, test.lower, test.upper, diff, lower, upper)
+		}
+	}
+
+	// Unequal variances reduce degrees of freedom
+	// below the pooled n1 + n2 - 2 and widen the
+	// interval compared to a t quantile with those.
+	a := SummarizeTrials([]float64{1, 2, 3, 4, 5}, 0.95)
+	b := SummarizeTrials([]float64{2, 4, 6, 8, 10}, 0.95)
+
+	_, lower, upper := DiffTrials(a, b, 0.95)
+	pooled := StudentTQuantile(0.975, 8) * math.Sqrt((a.Variance/5)+(b.Variance/5))
+
+	if (upper - lower) <= (2 * pooled) {
+		t.Errorf("expected Welch interval wider than %v but got [%v, %v]", (2 * pooled), lower, upper)
+	}
+
+	_, lower, upper = DiffTrials(SummarizeTrials([]float64{1}, 0.95), b, 0.95)
+	if (math.IsNaN(lower) != true) || (math.IsNaN(upper) != true) {
+		t.Errorf("expected NaN interval with a single trial but got [%v, %v]", lower, upper)
+	}
+}
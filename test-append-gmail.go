@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"flag"
 	"fmt"
@@ -10,21 +9,29 @@ import (
 	"strings"
 	"time"
 
-	"crypto/tls"
-
 	"github.com/numbleroot/pluto-evaluation/config"
 	"github.com/numbleroot/pluto-evaluation/messages"
-	"github.com/numbleroot/pluto/imap"
+	"github.com/numbleroot/pluto-evaluation/metrics"
+	"github.com/numbleroot/pluto-evaluation/progress"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+	"github.com/numbleroot/pluto-evaluation/tracing"
+	"github.com/numbleroot/pluto-evaluation/utils"
 )
 
 // Functions
 
 func main() {
 
-	// Make test config file location and number of messages
-	// to send per test configurable.
-	configFlag := flag.String("config", "test-config.toml", "Specify location of config file that describes test setup configuration.")
+	// Make test config file location, number of messages
+	// to send per test and results format configurable.
+	configSource := config.Flags()
 	runsFlag := flag.Int("runs", 100, "Specify how many times the command of this test is to be sent to server.")
+	formatFlag := flag.String("format", "jsonl", "Specify format of machine-readable results file: jsonl or csv.")
+	progressFlag := flag.Duration("progress", time.Second, "Specify interval of live progress updates, 0 disables them.")
+	metricsFlag := flag.String("metrics", "", "Serve Prometheus metrics on this address, e.g. :9100. Empty disables them.")
+	traceFlag := flag.String("trace", "", "Export spans of all commands via OTLP/HTTP to this collector, e.g. http://localhost:4318.")
+	traceFileFlag := flag.String("traceFile", "", "Export spans of all commands as OTLP JSON to this file.")
 	flag.Parse()
 
 	runs := *runsFlag
@@ -32,56 +39,41 @@ func main() {
 	log.Printf("Testing APPEND command on gmail...\n")
 
 	// Read configuration from file.
-	config, err := config.LoadConfig(*configFlag)
+	config, err := config.Load(configSource)
 	if err != nil {
 		log.Fatalf("Error loading config: %s\n", err.Error())
 	}
 
-	// Create connection string to connect to gmail.
-	gmailIMAPAddr := fmt.Sprintf("%s:%s", config.Gmail.Server, config.Gmail.Port)
-
-	log.Printf("Connecting to gmail...\n")
-
-	// Connect to remote gmail system.
-	gmailConn, err := tls.Dial("tcp", gmailIMAPAddr, nil)
+	// Check that all settings this test needs are present.
+	err = config.Require("Gmail", "AppendTest")
 	if err != nil {
-		log.Fatalf("Was unable to connect to remote gmail server: %s\n", err.Error())
-	}
-
-	// Create a new connection struct based on it.
-	gmailC := &imap.Connection{
-		OutConn:   gmailConn,
-		OutReader: bufio.NewReader(gmailConn),
+		log.Fatalf("Error in config for gmail: %s\n", err.Error())
 	}
 
-	// Consume mandatory IMAP greeting.
-	_, err = gmailC.Receive(false)
+	// Create TLS config verifying Gmail's certificate.
+	gmailTLSConfig, err := utils.InitGmailTLSConfig(config)
 	if err != nil {
-		log.Fatalf("Error during receiving initial server greeting: %s\n", err.Error())
+		log.Fatalf("Error loading TLS config for gmail: %s\n", err.Error())
 	}
 
-	// Log in as first user.
-	err = gmailC.Send(false, fmt.Sprintf("appendA LOGIN %s %s", config.Gmail.AppendTest.Name, config.Gmail.AppendTest.Password))
-	if err != nil {
-		log.Fatalf("Sending LOGIN to server failed with: %s\n", err.Error())
-	}
+	// Create connection string to connect to gmail.
+	gmailIMAPAddr := fmt.Sprintf("%s:%s", config.Gmail.Server, config.Gmail.Port)
 
-	// Wait for success message.
-	answer, err := gmailC.Receive(false)
+	// Export spans of all commands if requested.
+	tracer, err := tracing.New(*traceFlag, *traceFileFlag)
 	if err != nil {
-		log.Fatalf("Error during LOGIN as user %s: %s\n", config.Gmail.AppendTest.Name, err.Error())
+		log.Fatalf("Failed to prepare tracing: %s\n", err.Error())
 	}
 
-	// Receive next line from server.
-	nextAnswer, err := gmailC.Receive(false)
-	if err != nil {
-		log.Fatalf("Error receiving second part of LOGIN response: %s\n", err.Error())
-	}
+	log.Printf("Connecting to gmail...\n")
 
-	answer = fmt.Sprintf("%s\r\n%s", answer, nextAnswer)
+	// Connect to remote gmail system and log in as
+	// first user, with an access token if configured.
+	gmail := utils.NewGmailSession(config, gmailTLSConfig, config.Gmail.AppendTest, tracer)
 
-	if strings.Contains(answer, "appendA OK") != true {
-		log.Fatalf("Server responded unexpectedly to LOGIN: a'%s'a\n", answer)
+	gmailC, err := gmail.Login("appendA")
+	if err != nil {
+		log.Fatalf("Failed to log in to Gmail: %s\n", err.Error())
 	}
 
 	log.Printf("Logged in as '%s'.\n", config.Gmail.AppendTest.Name)
@@ -104,27 +96,91 @@ func main() {
 	// Prepend file with meta information about this test.
 	gmailLogFile.WriteString(fmt.Sprintf("Subject: APPEND\nPlatform: gmail\nDate: %s\n-----\n", logFileTime.Format("2006-01-02-15-04-05")))
 
-	// Prepare buffer to append individual results to.
-	results := make([]int64, runs)
+	// Describe this run in a manifest next to its results.
+	manifestFileName := records.ManifestFileName("append", logFileTime)
+
+	manifest, err := records.NewManifest("append", configSource.FileNames(), logFileTime)
+	if err != nil {
+		log.Fatalf("Failed to prepare run manifest: %s\n", err.Error())
+	}
+
+	// Serve live metrics of the run if requested.
+	if *metricsFlag != "" {
+
+		err = metrics.Serve(*metricsFlag)
+		if err != nil {
+			log.Fatalf("Failed to serve metrics: %s\n", err.Error())
+		}
+	}
+
+	// Show live progress of the run.
+	dashboard := progress.New(*progressFlag)
+	dashboard.Start()
+
+	// Create machine-readable results file for gmail.
+	gmailRecordsFileName := records.FileName(gmailLogFileName, *formatFlag)
+
+	gmailRecords, err := records.NewWriter(gmailRecordsFileName)
+	if err != nil {
+		log.Fatalf("Failed to create results file: %s\n", err.Error())
+	}
+	gmailRecords.Observe(dashboard.Record)
+	gmailRecords.Observe(metrics.Record)
+
+	manifest.AddFile(gmailRecordsFileName)
+
+	// Record what the server announces about itself.
+	gmailInfo, err := utils.ProbeServer(gmailC, "appendI", gmailIMAPAddr, config.Gmail.Verify)
+	if err != nil {
+		log.Fatalf("Failed to probe gmail: %s\n", err.Error())
+	}
+
+	manifest.AddServer("gmail", gmailInfo)
+
+	err = manifest.Write(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
+
+	// Prepare histogram to record individual results in.
+	results := stats.NewHistogram(3)
 
 	// Prepare message to append.
 	appendMsg := bytes.NewBufferString(messages.Msg01)
 	appendMsgSize := appendMsg.Len()
 
+	// Note size of appended message in manifest.
+	manifest.SetParameter("message_size", appendMsgSize)
+
 	log.Printf("Running tests on gmail...\n")
 
 	for num := 1; num <= runs; num++ {
 
-		i := num - 1
+		// Log in again on a new connection before the
+		// access token expires, outside of the measured time.
+		renewed, err := gmail.Renew("appendA")
+		if err != nil {
+			log.Fatalf("%d: Failed to log in to Gmail again: %s\n", num, err.Error())
+		}
+
+		if renewed {
+
+			gmailC = gmail.Conn
+			log.Printf("%d: Logged in again with a new access token.\n", num)
+		}
 
 		// Prepare command to send.
 		command := fmt.Sprintf("append%d APPEND INBOX {%d}", num, appendMsgSize)
 
+		// Trace command below the current session.
+		span := gmail.Session.Command("gmail", fmt.Sprintf("append%d", num), "APPEND", "INBOX")
+		span.Set("imap.message_size", appendMsgSize)
+
 		// Take current time stamp.
 		timeStart := time.Now().UnixNano()
 
 		// Send APPEND commmand to server.
-		err := gmailC.Send(false, command)
+		err = gmailC.Send(false, command)
 		if err != nil {
 			log.Fatalf("%d: Failed during sending APPEND command: %s\n", num, err.Error())
 		}
@@ -139,12 +195,18 @@ func main() {
 			log.Fatalf("%d: Did not receive continuation command from server: %s\n", num, answer)
 		}
 
+		// Time upload of the literal on its own.
+		literal := span.Child("literal upload")
+		literal.Set("imap.message_size", appendMsgSize)
+
 		// Send mail message without additional newline.
 		_, err = fmt.Fprintf(gmailC.OutConn, "%s\r\n", appendMsg)
 		if err != nil {
 			log.Fatalf("%d: Sending mail message to server failed with: %s\n", num, err.Error())
 		}
 
+		literal.End("OK")
+
 		// Receive answer to message transfer.
 		answer, err = gmailC.Receive(false)
 		if err != nil {
@@ -158,14 +220,34 @@ func main() {
 			log.Fatalf("%d: Server responded unexpectedly to APPEND command: %s\n", num, answer)
 		}
 
+		span.Set("imap.status", "OK")
+		span.EndAt("OK", time.Unix(0, timeEnd))
+
 		// Calculate round-trip time.
 		rtt := timeEnd - timeStart
 
-		// Store result in buffer.
-		results[i] = rtt
+		// Record result in histogram.
+		results.Record(rtt)
 
 		// Append log line to file.
 		gmailLogFile.WriteString(fmt.Sprintf("%d, %d\n", num, rtt))
+
+		// Append record to results file.
+		err = gmailRecords.Write(records.Record{
+			Scenario: "append",
+			Target:   "gmail",
+			User:     config.Gmail.AppendTest.Name,
+			Seq:      num,
+			Op:       "APPEND",
+			Start:    time.Unix(0, timeStart),
+			Latency:  rtt,
+			Bytes:    len(command) + appendMsgSize,
+			Status:   "OK",
+		})
+		if err != nil {
+			gmailRecords.Close()
+			log.Fatalf("Failed to write record: %s\n", err.Error())
+		}
 	}
 
 	// Log out.
@@ -175,13 +257,13 @@ func main() {
 	}
 
 	// Receive first part of answer.
-	answer, err = gmailC.Receive(false)
+	answer, err := gmailC.Receive(false)
 	if err != nil {
 		log.Fatalf("Error receiving first part of LOGOUT response: %s\n", err.Error())
 	}
 
 	// Receive next line from server.
-	nextAnswer, err = gmailC.Receive(false)
+	nextAnswer, err := gmailC.Receive(false)
 	if err != nil {
 		log.Fatalf("Error receiving second part of LOGOUT response: %s\n", err.Error())
 	}
@@ -192,13 +274,47 @@ func main() {
 		log.Fatalf("Server responded unexpectedly to LOGOUT: %s\n", answer)
 	}
 
-	// Calculate statistics and print them.
-	var sum int64 = 0
-	for _, result := range results {
-		sum += result
+	gmail.Session.End("OK")
+
+	// Calculate statistics, print and store them.
+	summary := results.Summarize()
+
+	log.Printf("Done on gmail, sent %d messages: %s\n\n", runs, summary.Line())
+
+	err = stats.WriteSummaryFile(strings.Replace(gmailLogFileName, ".log", ".summary", 1), "APPEND", "gmail", logFileTime, summary)
+	if err != nil {
+		log.Fatalf("Failed to store summary: %s\n", err.Error())
+	}
+
+	// Stop live progress updates.
+	dashboard.Stop()
+
+	// Store all buffered records.
+	err = gmailRecords.Close()
+	if err != nil {
+		log.Fatalf("Failed to store results: %s\n", err.Error())
+	}
+
+	// Stop serving metrics.
+	err = metrics.Shutdown()
+	if err != nil {
+		log.Printf("%s\n", err.Error())
 	}
 
-	msAvg := (float64(sum) / float64(runs)) / float64(time.Millisecond)
+	// Export remaining spans.
+	err = tracer.Close()
+	if err != nil {
+		log.Printf("Failed to export spans: %s\n", err.Error())
+	}
 
-	log.Printf("Done on gmail, sent %d messages, each took %f ms on average.\n\n", runs, msAvg)
+	// Note how many access tokens were needed.
+	if gmail.Tokens != nil {
+		manifest.SetParameter("access_tokens", gmail.Tokens.Refreshes())
+	}
+
+	// Note end of run in manifest.
+	err = manifest.Finish(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
 }
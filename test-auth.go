@@ -0,0 +1,428 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"crypto/tls"
+	"io/ioutil"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+	"github.com/numbleroot/pluto-evaluation/metrics"
+	"github.com/numbleroot/pluto-evaluation/progress"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+	"github.com/numbleroot/pluto-evaluation/tracing"
+	"github.com/numbleroot/pluto-evaluation/utils"
+)
+
+// Structs
+
+// Target names one system to log in to, how to
+// connect to it, its configured mechanism and the
+// user to authenticate as.
+type Target struct {
+	Name      string
+	Addr      string
+	Mode      string
+	TLSConfig *tls.Config
+	Verify    config.Verify
+	Auth      string
+	User      config.User
+}
+
+// Result summarizes the logins with one mechanism
+// on one target.
+type Result struct {
+	Target    string
+	Mechanism string
+	Logins    *stats.Histogram
+	Failure   string
+}
+
+// Functions
+
+// Mechanisms returns the mechanisms to measure on
+// target: its configured one if list is empty, all
+// supported ones for 'all', or the listed ones.
+func Mechanisms(list string, target Target) ([]string, error) {
+
+	if strings.TrimSpace(list) == "" {
+		return []string{target.Auth}, nil
+	}
+
+	if strings.EqualFold(strings.TrimSpace(list), "all") {
+		return config.AuthMechanisms, nil
+	}
+
+	mechanisms := make([]string, 0)
+
+	for _, mechanism := range strings.Split(list, ",") {
+
+		mechanism = strings.ToUpper(strings.TrimSpace(mechanism))
+		if mechanism == "" {
+			continue
+		}
+
+		if config.IsAuthMechanism(mechanism) != true {
+			return nil, fmt.Errorf("unknown mechanism '%s', choose one of %s", mechanism, strings.Join(config.AuthMechanisms, ", "))
+		}
+
+		mechanisms = append(mechanisms, mechanism)
+	}
+
+	return mechanisms, nil
+}
+
+// Command returns the IMAP command that logs in
+// via mechanism.
+func Command(mechanism string) string {
+
+	if mechanism == config.AuthLogin {
+		return "LOGIN"
+	}
+
+	return fmt.Sprintf("AUTHENTICATE %s", mechanism)
+}
+
+// RunMechanism measures runs logins via mechanism
+// on target, each one on a fresh connection so that
+// no session state is reused. Only the login itself
+// is timed. A mechanism the server does not accept is
+// given up after its first failure.
+func RunMechanism(target Target, mechanism string, conn int, runs int, recs *records.Writer) Result {
+
+	result := Result{
+		Target:    target.Name,
+		Mechanism: mechanism,
+		Logins:    stats.NewHistogram(3),
+	}
+
+	for num := 1; num <= runs; num++ {
+
+		c, err := utils.Dial(target.Addr, target.TLSConfig, target.Mode, nil)
+		if err != nil {
+			result.Failure = err.Error()
+			return result
+		}
+
+		// Let the server announce its capabilities
+		// up front so that they are not part of the
+		// measured time.
+		_, err = utils.Capability(c, "authC")
+		if err != nil {
+			c.OutConn.Close()
+			result.Failure = err.Error()
+			return result
+		}
+
+		// Take current time stamps around login.
+		start := time.Now()
+
+		err = utils.Authenticate(c, "authA", mechanism, target.User, nil)
+
+		latency := time.Since(start).Nanoseconds()
+
+		rec := records.Record{
+			Scenario: fmt.Sprintf("auth-%s", strings.ToLower(mechanism)),
+			Target:   target.Name,
+			User:     target.User.Name,
+			Conn:     conn,
+			Seq:      num,
+			Op:       Command(mechanism),
+			Start:    start,
+			Latency:  latency,
+			Status:   "OK",
+		}
+
+		if err != nil {
+			rec.Status = "ERROR"
+			rec.Error = err.Error()
+			result.Logins.RecordError()
+		} else {
+			result.Logins.Record(latency)
+		}
+
+		err = recs.Write(rec)
+		if err != nil {
+			recs.Close()
+			log.Fatalf("Failed to write record: %s\n", err.Error())
+		}
+
+		// Do not keep trying credentials or
+		// mechanisms the server refused already.
+		if (rec.Status != "OK") && (num == 1) {
+			c.OutConn.Close()
+			result.Failure = rec.Error
+			return result
+		}
+
+		if rec.Status == "OK" {
+
+			err = utils.Logout(c, "authZ")
+			if err != nil {
+				log.Printf("Failed to log out from %s: %s\n", target.Name, err.Error())
+			}
+		}
+
+		c.OutConn.Close()
+	}
+
+	return result
+}
+
+// FormatResults returns a table of login times
+// per target and mechanism.
+func FormatResults(results []Result) string {
+
+	out := &bytes.Buffer{}
+
+	fmt.Fprintf(out, "%-8s %-14s %7s %9s %9s %9s %7s\n",
+		"Target", "Mechanism", "Count", "p50 ms", "p90 ms", "p99 ms", "Errors")
+
+	for _, r := range results {
+
+		if r.Failure != "" {
+			fmt.Fprintf(out, "%-8s %-14s failed: %s\n", r.Target, r.Mechanism, r.Failure)
+			continue
+		}
+
+		s := r.Logins.Summarize()
+
+		fmt.Fprintf(out, "%-8s %-14s %7d %9.3f %9.3f %9.3f %7d\n",
+			r.Target, r.Mechanism, s.Count,
+			(float64(s.P50) / float64(time.Millisecond)), (float64(s.P90) / float64(time.Millisecond)),
+			(float64(s.P99) / float64(time.Millisecond)), s.Errors)
+	}
+
+	return out.String()
+}
+
+func main() {
+
+	// Make test config file location, number of logins
+	// per mechanism, the mechanisms and results format
+	// configurable.
+	configSource := config.Flags()
+	runsFlag := flag.Int("runs", 100, "Specify how many logins are measured per mechanism and system.")
+	formatFlag := flag.String("format", "jsonl", "Specify format of machine-readable results file: jsonl or csv.")
+	progressFlag := flag.Duration("progress", time.Second, "Specify interval of live progress updates, 0 disables them.")
+	metricsFlag := flag.String("metrics", "", "Serve Prometheus metrics on this address, e.g. :9100. Empty disables them.")
+	traceFlag := flag.String("trace", "", "Export spans of all commands via OTLP/HTTP to this collector, e.g. http://localhost:4318.")
+	traceFileFlag := flag.String("traceFile", "", "Export spans of all commands as OTLP JSON to this file.")
+	targetFlag := flag.String("target", "all", "Specify which system to test: all, pluto or Dovecot.")
+	mechanismsFlag := flag.String("mechanisms", "", "Specify comma-separated mechanisms to measure, 'all' for every supported one. Default is the configured Auth of each system.")
+	flag.Parse()
+
+	runs := *runsFlag
+
+	// Determine which of both systems to test.
+	runPluto, runDovecot, err := utils.ParseTarget(*targetFlag)
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+
+	log.Printf("Testing login mechanisms on %s...\n", utils.TargetNames(runPluto, runDovecot))
+
+	// Read configuration from file.
+	config, err := config.Load(configSource)
+	if err != nil {
+		log.Fatalf("Error loading config: %s\n", err.Error())
+	}
+
+	// Check that all settings this test needs are present.
+	if runPluto {
+		err = config.Require("Pluto", "AppendTest")
+		if err != nil {
+			log.Fatalf("Error in config for pluto: %s\n", err.Error())
+		}
+	}
+
+	if runDovecot {
+		err = config.Require("Dovecot", "AppendTest")
+		if err != nil {
+			log.Fatalf("Error in config for Dovecot: %s\n", err.Error())
+		}
+	}
+
+	// Create needed TLS configs with correct certificates.
+	plutoTLSConfig, dovecotTLSConfig, err := utils.InitTLSConfigs(config)
+	if err != nil {
+		log.Fatalf("Error loading TLS configs for pluto and Dovecot: %s\n", err.Error())
+	}
+
+	targets := make([]Target, 0, 2)
+
+	if runPluto {
+		targets = append(targets, Target{
+			Name:      "pluto",
+			Addr:      fmt.Sprintf("%s:%s", config.Pluto.IP, config.Pluto.Port),
+			Mode:      config.Pluto.Mode(),
+			TLSConfig: plutoTLSConfig,
+			Verify:    config.Pluto.Verify,
+			Auth:      config.Pluto.Auth,
+			User:      config.Pluto.AppendTest,
+		})
+	}
+
+	if runDovecot {
+		targets = append(targets, Target{
+			Name:      "Dovecot",
+			Addr:      fmt.Sprintf("%s:%s", config.Dovecot.IP, config.Dovecot.Port),
+			Mode:      config.Dovecot.Mode(),
+			TLSConfig: dovecotTLSConfig,
+			Verify:    config.Dovecot.Verify,
+			Auth:      config.Dovecot.Auth,
+			User:      config.Dovecot.AppendTest,
+		})
+	}
+
+	// Determine mechanisms per target before
+	// connecting anywhere.
+	mechanisms := make(map[string][]string)
+
+	for _, target := range targets {
+
+		mechanisms[target.Name], err = Mechanisms(*mechanismsFlag, target)
+		if err != nil {
+			log.Fatalf("%s\n", err.Error())
+		}
+	}
+
+	// Take current time stamp shared by all files of this run.
+	logFileTime := time.Now()
+
+	// Describe this run in a manifest next to its results.
+	manifestFileName := records.ManifestFileName("auth", logFileTime)
+
+	manifest, err := records.NewManifest("auth", configSource.FileNames(), logFileTime)
+	if err != nil {
+		log.Fatalf("Failed to prepare run manifest: %s\n", err.Error())
+	}
+
+	// Serve live metrics of the run if requested.
+	if *metricsFlag != "" {
+
+		err = metrics.Serve(*metricsFlag)
+		if err != nil {
+			log.Fatalf("Failed to serve metrics: %s\n", err.Error())
+		}
+	}
+
+	// Export spans of all commands if requested.
+	tracer, err := tracing.New(*traceFlag, *traceFileFlag)
+	if err != nil {
+		log.Fatalf("Failed to prepare tracing: %s\n", err.Error())
+	}
+
+	// Show live progress of the run.
+	dashboard := progress.New(*progressFlag)
+	dashboard.Start()
+
+	// Create machine-readable results file shared by
+	// all mechanisms, each record names its own.
+	recordsFileName := records.FileName(fmt.Sprintf("results/auth-%s.log", logFileTime.Format("2006-01-02-15-04-05")), *formatFlag)
+
+	recs, err := records.NewWriter(recordsFileName)
+	if err != nil {
+		log.Fatalf("Failed to create results file: %s\n", err.Error())
+	}
+	recs.Observe(dashboard.Record)
+	recs.Observe(metrics.Record)
+	recs.Observe(tracer.Record)
+
+	manifest.AddFile(recordsFileName)
+
+	// Record what each server announces about itself
+	// before logging in.
+	for _, target := range targets {
+
+		c, err := utils.Dial(target.Addr, target.TLSConfig, target.Mode, nil)
+		if err != nil {
+			log.Fatalf("Failed to connect to %s: %s\n", target.Name, err.Error())
+		}
+
+		info, err := utils.ProbeServer(c, "authI", target.Addr, target.Verify)
+		if err != nil {
+			log.Fatalf("Failed to probe %s: %s\n", target.Name, err.Error())
+		}
+
+		manifest.AddServer(target.Name, info)
+		manifest.SetParameter(fmt.Sprintf("%s_mechanisms", strings.ToLower(target.Name)), strings.Join(mechanisms[target.Name], ","))
+
+		err = utils.Logout(c, "authZ")
+		if err != nil {
+			log.Fatalf("Failed to log out from %s: %s\n", target.Name, err.Error())
+		}
+
+		c.OutConn.Close()
+	}
+
+	err = manifest.Write(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
+
+	results := make([]Result, 0)
+
+	for _, target := range targets {
+
+		for i, mechanism := range mechanisms[target.Name] {
+
+			log.Printf("Running %d logins on %s via %s as '%s'...\n", runs, target.Name, mechanism, target.User.Name)
+
+			result := RunMechanism(target, mechanism, i, runs, recs)
+			if result.Failure != "" {
+				log.Printf("Mechanism not accepted by %s: %s\n", target.Name, result.Failure)
+			}
+
+			results = append(results, result)
+		}
+	}
+
+	// Stop live progress updates.
+	dashboard.Stop()
+
+	// Print login times of all mechanisms and
+	// store them next to the results.
+	table := FormatResults(results)
+
+	log.Printf("Done, login times per mechanism:\n\n%s\n", table)
+
+	summaryFileName := fmt.Sprintf("results/auth-%s.summary", logFileTime.Format("2006-01-02-15-04-05"))
+
+	err = ioutil.WriteFile(summaryFileName, []byte(table), 0600)
+	if err != nil {
+		log.Fatalf("Failed to store summary: %s\n", err.Error())
+	}
+
+	manifest.AddFile(summaryFileName)
+
+	// Store all buffered records.
+	err = recs.Close()
+	if err != nil {
+		log.Fatalf("Failed to store results: %s\n", err.Error())
+	}
+
+	// Stop serving metrics.
+	err = metrics.Shutdown()
+	if err != nil {
+		log.Printf("%s\n", err.Error())
+	}
+
+	// Export remaining spans.
+	err = tracer.Close()
+	if err != nil {
+		log.Printf("Failed to export spans: %s\n", err.Error())
+	}
+
+	// Note end of run in manifest.
+	err = manifest.Finish(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,761 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"crypto/tls"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+	"github.com/numbleroot/pluto-evaluation/messages"
+	"github.com/numbleroot/pluto-evaluation/metrics"
+	"github.com/numbleroot/pluto-evaluation/progress"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+	"github.com/numbleroot/pluto-evaluation/tracing"
+	"github.com/numbleroot/pluto-evaluation/utils"
+	"github.com/numbleroot/pluto/imap"
+)
+
+// Structs
+
+// Target bundles everything needed to run the
+// conflict scenario against one IMAP system.
+type Target struct {
+	Name          string
+	Addr          string
+	Mode          string
+	Auth          string
+	TLSConfig     *tls.Config
+	Verify        config.Verify
+	Test          config.ConflictTest
+	LiteralSuffix string
+	Tracer        *tracing.Tracer
+}
+
+// Op records the outcome of one command a session
+// issued during a conflict phase.
+type Op struct {
+	Kind   string
+	Key    int
+	Status string
+	End    int64
+}
+
+// Report collects the observed final state of one
+// system after all conflict phases have completed.
+type Report struct {
+	Target string
+	Lines  []string
+}
+
+// Functions
+
+// ConflictTester runs one session of a conflict phase.
+// Sessions with an even connection number add state
+// (+FLAGS, CREATE), sessions with an odd one remove it
+// again (-FLAGS, DELETE). In the APPEND phase, all
+// sessions append to the same mailbox.
+func ConflictTester(start chan struct{}, done chan []Op, c *imap.Connection, session *tracing.Span, target Target, phase string, connNum int, runs int, msgNum int, logFolder string, logFileTime time.Time, results *stats.Histogram, recs *records.Writer) {
+
+	// Define an individual test log file name.
+	logFileName := fmt.Sprintf("%s/conn-%03d.log", logFolder, connNum)
+
+	// Attempt to create a test log file containing
+	// measured test times for this session.
+	logFile, err := os.Create(logFileName)
+	if err != nil {
+		log.Fatalf("Failed to create test log file '%s': %s\n", logFileName, err.Error())
+	}
+
+	// Sync to storage and close on any exit.
+	defer logFile.Close()
+	defer logFile.Sync()
+
+	// Prepend file with meta information about this test.
+	logFile.WriteString(fmt.Sprintf("Subject: Conflict %s\nPlatform: %s\nDate: %s\n-----\n", phase, target.Name, logFileTime.Format("2006-01-02-15-04-05")))
+
+	// Prepare message to append.
+	appendMsg := bytes.NewBufferString(messages.Msg01)
+	appendMsgSize := appendMsg.Len()
+
+	// Collect outcome of every issued command.
+	ops := make([]Op, 0, runs)
+
+	// Wait for signal to start test.
+	<-start
+
+	for num := 1; num <= runs; num++ {
+
+		tag := fmt.Sprintf("conflict%d", num)
+
+		var kind string
+		var command string
+		mailbox := "INBOX"
+
+		// Prepare command to send depending on phase
+		// and role of this session.
+		switch phase {
+
+		case "STORE":
+			if (connNum % 2) == 0 {
+				kind = "add"
+				command = fmt.Sprintf("%s STORE %d +FLAGS.SILENT (\\Flagged)", tag, msgNum)
+			} else {
+				kind = "remove"
+				command = fmt.Sprintf("%s STORE %d -FLAGS.SILENT (\\Flagged)", tag, msgNum)
+			}
+
+		case "CREATE-DELETE":
+			if (connNum % 2) == 0 {
+				kind = "create"
+				command = fmt.Sprintf("%s CREATE conflict-mailbox-%d", tag, num)
+			} else {
+				kind = "delete"
+				command = fmt.Sprintf("%s DELETE conflict-mailbox-%d", tag, num)
+			}
+
+			mailbox = fmt.Sprintf("conflict-mailbox-%d", num)
+
+		case "APPEND":
+			kind = "append"
+			command = fmt.Sprintf("%s APPEND INBOX {%d}", tag, appendMsgSize)
+		}
+
+		// Trace command below the session.
+		span := session.Command(target.Name, tag, strings.Fields(command)[1], mailbox)
+
+		// Take current time stamp.
+		timeStart := time.Now().UnixNano()
+
+		// Send command to server.
+		err := c.Send(false, command)
+		if err != nil {
+			log.Fatalf("%d: Failed during sending %s command: %s\n", num, phase, err.Error())
+		}
+
+		if phase == "APPEND" {
+
+			// Receive continuation request.
+			answer, err := c.Receive(false)
+			if err != nil {
+				log.Fatalf("%d: Error receiving response to APPEND: %s\n", num, err.Error())
+			}
+
+			if strings.HasPrefix(answer, "+") != true {
+				log.Fatalf("%d: Did not receive continuation command from server: %s\n", num, answer)
+			}
+
+			// Send mail message.
+			literal := span.Child("literal upload")
+			literal.Set("imap.message_size", appendMsgSize)
+
+			_, err = fmt.Fprintf(c.OutConn, "%s%s", appendMsg, target.LiteralSuffix)
+			if err != nil {
+				log.Fatalf("%d: Sending mail message to server failed with: %s\n", num, err.Error())
+			}
+
+			literal.End("OK")
+			span.Set("imap.message_size", appendMsgSize)
+		}
+
+		// Receive tagged completion of command.
+		answer, status, err := utils.ReceiveTagged(c, tag)
+		if err != nil {
+			log.Fatalf("%d: Error receiving response to %s: %s\n", num, phase, err.Error())
+		}
+
+		// Take time stamp after function execution.
+		timeEnd := time.Now().UnixNano()
+
+		span.Set("imap.status", status)
+		span.EndAt(status, time.Unix(0, timeEnd))
+
+		// Conflicting CREATE and DELETE commands are
+		// expected to be refused with NO occasionally,
+		// but BAD always indicates a broken test.
+		if status == "BAD" {
+			log.Fatalf("%d: Server responded unexpectedly to %s command: %s\n", num, phase, answer)
+		}
+
+		// Record latency of successful commands in the
+		// phase histogram and count refused ones.
+		if status == "OK" {
+			results.Record(timeEnd - timeStart)
+		} else {
+			results.RecordError()
+		}
+
+		// APPEND commands send their message as well.
+		bytesSent := len(command)
+		if phase == "APPEND" {
+			bytesSent += appendMsgSize
+		}
+
+		// Append record to shared results file.
+		err = recs.Write(records.Record{
+			Scenario: fmt.Sprintf("conflict-%s", strings.ToLower(phase)),
+			Target:   target.Name,
+			User:     target.Test.User.Name,
+			Conn:     connNum,
+			Seq:      num,
+			Op:       strings.Fields(command)[1],
+			Start:    time.Unix(0, timeStart),
+			Latency:  (timeEnd - timeStart),
+			Bytes:    bytesSent,
+			Status:   status,
+		})
+		if err != nil {
+			recs.Close()
+			log.Fatalf("Failed to write record: %s\n", err.Error())
+		}
+
+		ops = append(ops, Op{
+			Kind:   kind,
+			Key:    num,
+			Status: status,
+			End:    timeEnd,
+		})
+
+		// Append log line to file.
+		logFile.WriteString(fmt.Sprintf("%d, %d\n", num, (timeEnd - timeStart)))
+	}
+
+	// Send collected outcomes back.
+	done <- ops
+}
+
+// OpenSession connects and logs in one more session
+// of the conflict test user on supplied target. It
+// also returns the span tracing this session.
+func OpenSession(target Target) (*imap.Connection, *tracing.Span) {
+
+	session := target.Tracer.Session(target.Name, target.Test.User.Name)
+
+	c, err := utils.Dial(target.Addr, target.TLSConfig, target.Mode, session)
+	if err != nil {
+		log.Fatalf("Failed to connect to %s: %s\n", target.Name, err.Error())
+	}
+
+	err = utils.Authenticate(c, "conflictA", target.Auth, target.Test.User, session)
+	if err != nil {
+		log.Fatalf("Failed to log in to %s: %s\n", target.Name, err.Error())
+	}
+
+	return c, session
+}
+
+// Execute sends a simple command to the server and
+// returns the complete answer and completion status.
+func Execute(c *imap.Connection, tag string, command string) (string, string) {
+
+	err := c.Send(false, fmt.Sprintf("%s %s", tag, command))
+	if err != nil {
+		log.Fatalf("Sending '%s' to server failed with: %s\n", command, err.Error())
+	}
+
+	answer, status, err := utils.ReceiveTagged(c, tag)
+	if err != nil {
+		log.Fatalf("Error receiving response to '%s': %s\n", command, err.Error())
+	}
+
+	return answer, status
+}
+
+// UntaggedNumber extracts the number n of the first
+// untagged response line "* n <suffix>" in answer.
+func UntaggedNumber(answer string, suffix string) int {
+
+	for _, line := range strings.Split(answer, "\r\n") {
+
+		fields := strings.Fields(line)
+
+		if (len(fields) == 3) && (fields[0] == "*") && (strings.ToUpper(fields[2]) == suffix) {
+
+			n, err := strconv.Atoi(fields[1])
+			if err == nil {
+				return n
+			}
+		}
+	}
+
+	return -1
+}
+
+// StatusMessages returns the number of messages in
+// mailbox as reported by a STATUS command.
+func StatusMessages(c *imap.Connection, mailbox string) int {
+
+	answer, status := Execute(c, "conflictS", fmt.Sprintf("STATUS %s (MESSAGES)", mailbox))
+	if status != "OK" {
+		log.Fatalf("Server responded unexpectedly to STATUS: %s\n", answer)
+	}
+
+	// Extract number from '* STATUS INBOX (MESSAGES n)'.
+	i := strings.Index(strings.ToUpper(answer), "(MESSAGES ")
+	if i == -1 {
+		log.Fatalf("STATUS response did not contain number of messages: %s\n", answer)
+	}
+
+	numRaw := answer[(i + len("(MESSAGES ")):]
+	numRaw = numRaw[:strings.IndexAny(numRaw, ")\r")]
+
+	n, err := strconv.Atoi(numRaw)
+	if err != nil {
+		log.Fatalf("Failed to parse number of messages from STATUS response: %s\n", answer)
+	}
+
+	return n
+}
+
+// RunPhase opens one session per configured session
+// slot, starts all of them at the same time and
+// returns the outcomes of all issued commands.
+func RunPhase(target Target, phase string, runs int, msgNum int, logFileTime time.Time, manifest *records.Manifest, format string, dashboard *progress.Dashboard) []Op {
+
+	numSessions := target.Test.Sessions
+
+	// Prepare buffered channels to signal start and
+	// finish over to involved testing routines.
+	start := make(chan struct{}, numSessions)
+	done := make(chan []Op, numSessions)
+
+	// Define a log folder for this phase and create it.
+	logFolder := fmt.Sprintf("results/%s-conflict-%s-%s", strings.ToLower(target.Name), strings.ToLower(phase), logFileTime.Format("2006-01-02-15-04-05"))
+
+	err := os.Mkdir(logFolder, (os.ModeDir | 0700))
+	if err != nil {
+		log.Fatalf("Failed to create folder: %s\n", err.Error())
+	}
+
+	// Create machine-readable results file shared by
+	// all sessions of this phase.
+	recordsFileName := records.FileName(logFolder, format)
+
+	recs, err := records.NewWriter(recordsFileName)
+	if err != nil {
+		log.Fatalf("Failed to create results file: %s\n", err.Error())
+	}
+	recs.Observe(dashboard.Record)
+	recs.Observe(metrics.Record)
+
+	manifest.AddFile(recordsFileName)
+
+	err = manifest.Write(records.ManifestFileName("conflict", logFileTime))
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
+
+	// Prepare histogram shared by all sessions.
+	results := stats.NewHistogram(3)
+
+	log.Printf("Connecting %d sessions of '%s' to %s for conflicting %s...\n", numSessions, target.Test.User.Name, target.Name, phase)
+
+	sessions := make([]*imap.Connection, numSessions)
+	spans := make([]*tracing.Span, numSessions)
+
+	for connNum := 0; connNum < numSessions; connNum++ {
+
+		c, session := OpenSession(target)
+
+		// STORE addresses messages by sequence number,
+		// thus INBOX needs to be selected beforehand.
+		if phase == "STORE" {
+
+			answer, status := Execute(c, "conflictB", "SELECT INBOX")
+			if status != "OK" {
+				log.Fatalf("Server responded unexpectedly to SELECT: %s\n", answer)
+			}
+		}
+
+		sessions[connNum] = c
+		spans[connNum] = session
+
+		// Dispatch to own goroutine.
+		go ConflictTester(start, done, c, session, target, phase, connNum, runs, msgNum, logFolder, logFileTime, results, recs)
+	}
+
+	// Send start signal to ready routines.
+	for signal := 0; signal < numSessions; signal++ {
+		start <- struct{}{}
+	}
+
+	ops := make([]Op, 0, (numSessions * runs))
+
+	// Wait for all done signals to come in.
+	for signal := 0; signal < numSessions; signal++ {
+		ops = append(ops, <-done...)
+	}
+
+	// Calculate statistics over all sessions,
+	// print and store them.
+	summary := results.Summarize()
+
+	log.Printf("Done with conflicting %s on %s: %s\n", phase, target.Name, summary.Line())
+
+	err = stats.WriteSummaryFile(fmt.Sprintf("%s.summary", logFolder), fmt.Sprintf("Conflict %s", phase), target.Name, logFileTime, summary)
+	if err != nil {
+		log.Fatalf("Failed to store summary: %s\n", err.Error())
+	}
+
+	// Log out all sessions of this phase.
+	for i, c := range sessions {
+
+		err := utils.Logout(c, "conflictZ")
+		if err != nil {
+			log.Fatalf("Failed to log out from %s: %s\n", target.Name, err.Error())
+		}
+
+		spans[i].End("OK")
+	}
+
+	// Store all buffered records.
+	err = recs.Close()
+	if err != nil {
+		log.Fatalf("Failed to store results: %s\n", err.Error())
+	}
+
+	return ops
+}
+
+// LastAcknowledged returns the latest completion time
+// of a successful operation of kind on key.
+func LastAcknowledged(ops []Op, kind string, key int) int64 {
+
+	var last int64 = 0
+
+	for _, op := range ops {
+
+		if (op.Kind == kind) && (op.Key == key) && (op.Status == "OK") && (op.End > last) {
+			last = op.End
+		}
+	}
+
+	return last
+}
+
+// CountStatus returns how many operations of kind
+// completed with supplied status.
+func CountStatus(ops []Op, kind string, status string) int {
+
+	count := 0
+
+	for _, op := range ops {
+
+		if (op.Kind == kind) && (op.Status == status) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Semantics classifies a final state against the
+// operation acknowledged last: if both agree, the
+// system behaved like a last-writer-wins register.
+func Semantics(present bool, lastAdd int64, lastRemove int64) string {
+
+	if (lastAdd == 0) && (lastRemove == 0) {
+		return "no successful operation"
+	}
+
+	if present && (lastAdd >= lastRemove) {
+		return "last-writer-wins"
+	}
+
+	if (present != true) && (lastRemove > lastAdd) {
+		return "last-writer-wins"
+	}
+
+	if present {
+		return "add-wins"
+	}
+
+	return "remove-wins"
+}
+
+// RunConflictScenario executes all conflict phases
+// against target and inspects the resulting state.
+func RunConflictScenario(target Target, runs int, logFileTime time.Time, manifest *records.Manifest, format string, dashboard *progress.Dashboard) Report {
+
+	report := Report{
+		Target: target.Name,
+		Lines:  make([]string, 0, 8),
+	}
+
+	// Open a separate session used to prepare the
+	// scenario and to inspect the final state.
+	checkC, checkSession := OpenSession(target)
+
+	// Record what the server announces about itself.
+	info, err := utils.ProbeServer(checkC, "conflictI", target.Addr, target.Verify)
+	if err != nil {
+		log.Fatalf("Failed to probe %s: %s\n", target.Name, err.Error())
+	}
+
+	manifest.AddServer(target.Name, info)
+	manifest.SetParameter(fmt.Sprintf("%s_sessions", strings.ToLower(target.Name)), target.Test.Sessions)
+	manifest.SetParameter("message_size", len(messages.Msg01))
+
+	log.Printf("Preparing message to conflict on at %s...\n", target.Name)
+
+	// Append one message all STORE sessions will
+	// concurrently add and remove a flag on.
+	appendMsg := bytes.NewBufferString(messages.Msg01)
+
+	err = checkC.Send(false, fmt.Sprintf("conflictP APPEND INBOX {%d}", appendMsg.Len()))
+	if err != nil {
+		log.Fatalf("Sending APPEND to server failed with: %s\n", err.Error())
+	}
+
+	answer, err := checkC.Receive(false)
+	if err != nil {
+		log.Fatalf("Error receiving response to APPEND: %s\n", err.Error())
+	}
+
+	if strings.HasPrefix(answer, "+") != true {
+		log.Fatalf("Did not receive continuation command from server: %s\n", answer)
+	}
+
+	_, err = fmt.Fprintf(checkC.OutConn, "%s%s", appendMsg, target.LiteralSuffix)
+	if err != nil {
+		log.Fatalf("Sending mail message to server failed with: %s\n", err.Error())
+	}
+
+	answer, status, err := utils.ReceiveTagged(checkC, "conflictP")
+	if err != nil {
+		log.Fatalf("Error receiving response to APPEND: %s\n", err.Error())
+	}
+
+	if status != "OK" {
+		log.Fatalf("Server responded unexpectedly to APPEND: %s\n", answer)
+	}
+
+	// The freshly appended message is the last one.
+	answer, status = Execute(checkC, "conflictB", "SELECT INBOX")
+	if status != "OK" {
+		log.Fatalf("Server responded unexpectedly to SELECT: %s\n", answer)
+	}
+
+	msgNum := UntaggedNumber(answer, "EXISTS")
+	if msgNum < 1 {
+		log.Fatalf("Could not determine number of messages in INBOX: %s\n", answer)
+	}
+
+	// Phase 1: concurrently add and remove \Flagged.
+	ops := RunPhase(target, "STORE", runs, msgNum, logFileTime, manifest, format, dashboard)
+
+	answer, status = Execute(checkC, "conflictF", fmt.Sprintf("FETCH %d (FLAGS)", msgNum))
+	if status != "OK" {
+		log.Fatalf("Server responded unexpectedly to FETCH: %s\n", answer)
+	}
+
+	flagged := strings.Contains(answer, "\\Flagged")
+	lastAdd := LastAcknowledged(ops, "add", msgNum)
+	lastRemove := LastAcknowledged(ops, "remove", msgNum)
+
+	report.Lines = append(report.Lines, fmt.Sprintf("STORE: final \\Flagged present: %t, %d/%d adds and %d/%d removes acknowledged, observed %s",
+		flagged, CountStatus(ops, "add", "OK"), (CountStatus(ops, "add", "OK")+CountStatus(ops, "add", "NO")),
+		CountStatus(ops, "remove", "OK"), (CountStatus(ops, "remove", "OK")+CountStatus(ops, "remove", "NO")),
+		Semantics(flagged, lastAdd, lastRemove)))
+
+	// Phase 2: concurrently create and delete the
+	// same mailbox names.
+	ops = RunPhase(target, "CREATE-DELETE", runs, msgNum, logFileTime, manifest, format, dashboard)
+
+	answer, status = Execute(checkC, "conflictL", "LIST \"\" \"conflict-mailbox-*\"")
+	if status != "OK" {
+		log.Fatalf("Server responded unexpectedly to LIST: %s\n", answer)
+	}
+
+	// Collect names of all mailboxes that survived.
+	existing := make(map[string]bool)
+	for _, line := range strings.Split(answer, "\r\n") {
+
+		fields := strings.Fields(line)
+
+		if (len(fields) > 1) && (fields[0] == "*") {
+			existing[strings.Trim(fields[(len(fields)-1)], "\"")] = true
+		}
+	}
+
+	// Classify final existence of every mailbox name.
+	outcomes := make(map[string]int)
+	for num := 1; num <= runs; num++ {
+
+		name := fmt.Sprintf("conflict-mailbox-%d", num)
+		present := existing[name]
+
+		outcomes[Semantics(present, LastAcknowledged(ops, "create", num), LastAcknowledged(ops, "delete", num))]++
+
+		// Clean up for subsequent runs.
+		if present {
+			Execute(checkC, "conflictD", fmt.Sprintf("DELETE %s", name))
+		}
+	}
+
+	report.Lines = append(report.Lines, fmt.Sprintf("CREATE/DELETE: %d CREATE OK, %d CREATE NO, %d DELETE OK, %d DELETE NO",
+		CountStatus(ops, "create", "OK"), CountStatus(ops, "create", "NO"),
+		CountStatus(ops, "delete", "OK"), CountStatus(ops, "delete", "NO")))
+
+	for _, semantics := range []string{"last-writer-wins", "add-wins", "remove-wins", "no successful operation"} {
+		report.Lines = append(report.Lines, fmt.Sprintf("CREATE/DELETE: %d of %d mailbox names observed %s", outcomes[semantics], runs, semantics))
+	}
+
+	// Phase 3: concurrently append to the same mailbox.
+	before := StatusMessages(checkC, "INBOX")
+
+	ops = RunPhase(target, "APPEND", runs, msgNum, logFileTime, manifest, format, dashboard)
+
+	after := StatusMessages(checkC, "INBOX")
+	acked := CountStatus(ops, "append", "OK")
+
+	report.Lines = append(report.Lines, fmt.Sprintf("APPEND: %d of %d appends acknowledged, INBOX grew by %d messages (%d missing)",
+		acked, len(ops), (after-before), (acked-(after-before))))
+
+	err = utils.Logout(checkC, "conflictZ")
+	if err != nil {
+		log.Fatalf("Failed to log out from %s: %s\n", target.Name, err.Error())
+	}
+
+	checkSession.End("OK")
+
+	return report
+}
+
+func main() {
+
+	// Make test config file location, number of messages
+	// to send per test and results format configurable.
+	configSource := config.Flags()
+	runsFlag := flag.Int("runs", 100, "Specify how many times the command of this test is to be sent to server.")
+	formatFlag := flag.String("format", "jsonl", "Specify format of machine-readable results file: jsonl or csv.")
+	progressFlag := flag.Duration("progress", time.Second, "Specify interval of live progress updates, 0 disables them.")
+	metricsFlag := flag.String("metrics", "", "Serve Prometheus metrics on this address, e.g. :9100. Empty disables them.")
+	traceFlag := flag.String("trace", "", "Export spans of all commands via OTLP/HTTP to this collector, e.g. http://localhost:4318.")
+	traceFileFlag := flag.String("traceFile", "", "Export spans of all commands as OTLP JSON to this file.")
+	flag.Parse()
+
+	runs := *runsFlag
+
+	log.Printf("Testing conflicting sessions of one user on pluto and Dovecot...\n\n")
+
+	// Read configuration from file.
+	config, err := config.Load(configSource)
+	if err != nil {
+		log.Fatalf("Error loading config: %s\n", err.Error())
+	}
+
+	// Check that all settings this test needs are present.
+	err = config.Require("Pluto", "ConflictTest")
+	if err != nil {
+		log.Fatalf("Error in config for pluto: %s\n", err.Error())
+	}
+
+	err = config.Require("Dovecot", "ConflictTest")
+	if err != nil {
+		log.Fatalf("Error in config for Dovecot: %s\n", err.Error())
+	}
+
+	// Create needed TLS configs with correct certificates.
+	plutoTLSConfig, dovecotTLSConfig, err := utils.InitTLSConfigs(config)
+	if err != nil {
+		log.Fatalf("Error loading TLS configs for pluto and Dovecot: %s\n", err.Error())
+	}
+
+	targets := []Target{
+		{
+			Name:          "pluto",
+			Addr:          fmt.Sprintf("%s:%s", config.Pluto.IP, config.Pluto.Port),
+			Mode:          config.Pluto.Mode(),
+			Auth:          config.Pluto.Auth,
+			TLSConfig:     plutoTLSConfig,
+			Verify:        config.Pluto.Verify,
+			Test:          config.Pluto.ConflictTest,
+			LiteralSuffix: "",
+		},
+		{
+			Name:          "Dovecot",
+			Addr:          fmt.Sprintf("%s:%s", config.Dovecot.IP, config.Dovecot.Port),
+			Mode:          config.Dovecot.Mode(),
+			Auth:          config.Dovecot.Auth,
+			TLSConfig:     dovecotTLSConfig,
+			Verify:        config.Dovecot.Verify,
+			Test:          config.Dovecot.ConflictTest,
+			LiteralSuffix: "\n",
+		},
+	}
+
+	// Take current time.
+	logFileTime := time.Now()
+
+	// Describe this run in a manifest next to its results.
+	manifest, err := records.NewManifest("conflict", configSource.FileNames(), logFileTime)
+	if err != nil {
+		log.Fatalf("Failed to prepare run manifest: %s\n", err.Error())
+	}
+
+	// Serve live metrics of the run if requested.
+	if *metricsFlag != "" {
+
+		err = metrics.Serve(*metricsFlag)
+		if err != nil {
+			log.Fatalf("Failed to serve metrics: %s\n", err.Error())
+		}
+	}
+
+	// Export spans of all commands if requested.
+	tracer, err := tracing.New(*traceFlag, *traceFileFlag)
+	if err != nil {
+		log.Fatalf("Failed to prepare tracing: %s\n", err.Error())
+	}
+
+	// Show live progress of the run.
+	dashboard := progress.New(*progressFlag)
+	dashboard.Start()
+
+	reports := make([]Report, 0, len(targets))
+
+	for _, target := range targets {
+		target.Tracer = tracer
+		reports = append(reports, RunConflictScenario(target, runs, logFileTime, manifest, *formatFlag, dashboard))
+		log.Printf("Done on %s.\n\n", target.Name)
+	}
+
+	// Stop live progress updates.
+	dashboard.Stop()
+
+	// Stop serving metrics.
+	err = metrics.Shutdown()
+	if err != nil {
+		log.Printf("%s\n", err.Error())
+	}
+
+	// Export remaining spans.
+	err = tracer.Close()
+	if err != nil {
+		log.Printf("Failed to export spans: %s\n", err.Error())
+	}
+
+	// Note end of run in manifest.
+	err = manifest.Finish(records.ManifestFileName("conflict", logFileTime))
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
+
+	// Print final states next to each other.
+	for _, report := range reports {
+
+		log.Printf("Final state on %s:\n", report.Target)
+
+		for _, line := range report.Lines {
+			log.Printf("\t%s\n", line)
+		}
+	}
+}
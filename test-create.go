@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
 	"log"
@@ -12,80 +11,42 @@ import (
 	"crypto/tls"
 
 	"github.com/numbleroot/pluto-evaluation/config"
+	"github.com/numbleroot/pluto-evaluation/metrics"
+	"github.com/numbleroot/pluto-evaluation/progress"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+	"github.com/numbleroot/pluto-evaluation/tracing"
 	"github.com/numbleroot/pluto-evaluation/utils"
-	"github.com/numbleroot/pluto/imap"
 )
 
 // Functions
 
-func main() {
-
-	// Make test config file location and number of messages
-	// to send per test configurable.
-	configFlag := flag.String("config", "test-config.toml", "Specify location of config file that describes test setup configuration.")
-	runsFlag := flag.Int("runs", 100, "Specify how many times the command of this test is to be sent to server.")
-	flag.Parse()
-
-	runs := *runsFlag
-
-	log.Printf("Testing CREATE command on pluto and Dovecot...\n")
-
-	// Read configuration from file.
-	config, err := config.LoadConfig(*configFlag)
-	if err != nil {
-		log.Fatalf("Error loading config: %s\n", err.Error())
-	}
-
-	// Create needed TLS configs with correct certificates.
-	plutoTLSConfig, dovecotTLSConfig, err := utils.InitTLSConfigs(config)
-	if err != nil {
-		log.Fatalf("Error loading TLS configs for pluto and Dovecot: %s\n", err.Error())
-	}
-
-	// Create connection string to connect to pluto and Dovecot.
-	plutoIMAPAddr := fmt.Sprintf("%s:%s", config.Pluto.IP, config.Pluto.Port)
-	dovecotIMAPAddr := fmt.Sprintf("%s:%s", config.Dovecot.IP, config.Dovecot.Port)
+// RunPluto logs in to pluto and sends runs CREATE
+// commands for numbered mailboxes, storing the
+// completion time of each next to the other
+// results of the run.
+func RunPluto(config *config.Config, plutoIMAPAddr string, plutoTLSConfig *tls.Config, runs int, logFileTime time.Time, format string, manifest *records.Manifest, manifestFileName string, dashboard *progress.Dashboard, tracer *tracing.Tracer) {
 
 	log.Printf("Connecting to pluto...\n")
 
+	// Trace this session if requested.
+	session := tracer.Session("pluto", config.Pluto.CreateTest.Name)
+
 	// Connect to remote pluto system.
-	plutoConn, err := tls.Dial("tcp", plutoIMAPAddr, plutoTLSConfig)
+	plutoC, err := utils.Dial(plutoIMAPAddr, plutoTLSConfig, config.Pluto.Mode(), session)
 	if err != nil {
 		log.Fatalf("Was unable to connect to remote pluto server: %s\n", err.Error())
 	}
 
-	// Create a new connection struct based on it.
-	plutoC := &imap.Connection{
-		OutConn:   plutoConn,
-		OutReader: bufio.NewReader(plutoConn),
-	}
-
-	// Consume mandatory IMAP greeting.
-	_, err = plutoC.Receive(false)
-	if err != nil {
-		log.Fatalf("Error during receiving initial server greeting: %s\n", err.Error())
-	}
-
 	// Log in as first user.
-	err = plutoC.Send(false, fmt.Sprintf("createA LOGIN %s %s", config.Pluto.CreateTest.Name, config.Pluto.CreateTest.Password))
-	if err != nil {
-		log.Fatalf("Sending LOGIN to server failed with: %s\n", err.Error())
-	}
-
-	// Wait for success message.
-	answer, err := plutoC.Receive(false)
+	err = utils.Authenticate(plutoC, "createA", config.Pluto.Auth, config.Pluto.CreateTest, session)
 	if err != nil {
-		log.Fatalf("Error during LOGIN as user %s: %s\n", config.Pluto.CreateTest.Name, err.Error())
-	}
-
-	if strings.HasPrefix(answer, "createA OK") != true {
-		log.Fatalf("Server responded unexpectedly to LOGIN: %s\n", answer)
+		log.Fatalf("Failed to log in to pluto: %s\n", err.Error())
 	}
 
 	log.Printf("Logged in as '%s'.\n", config.Pluto.CreateTest.Name)
 
-	// Take current time stamp and create log file name.
-	logFileTime := time.Now()
+	// Create log file name.
 	plutoLogFileName := fmt.Sprintf("results/pluto-create-%s.log", logFileTime.Format("2006-01-02-15-04-05"))
 
 	// Attempt to create a test log file containing
@@ -102,18 +63,44 @@ func main() {
 	// Prepend file with meta information about this test.
 	plutoLogFile.WriteString(fmt.Sprintf("Subject: CREATE\nPlatform: pluto\nDate: %s\n-----\n", logFileTime.Format("2006-01-02-15-04-05")))
 
-	// Prepare buffer to append individual results to.
-	results := make([]int64, runs)
+	// Create machine-readable results file for pluto.
+	plutoRecordsFileName := records.FileName(plutoLogFileName, format)
+
+	plutoRecords, err := records.NewWriter(plutoRecordsFileName)
+	if err != nil {
+		log.Fatalf("Failed to create results file: %s\n", err.Error())
+	}
+	plutoRecords.Observe(dashboard.Record)
+	plutoRecords.Observe(metrics.Record)
+
+	manifest.AddFile(plutoRecordsFileName)
+
+	// Record what the server announces about itself.
+	plutoInfo, err := utils.ProbeServer(plutoC, "createI", plutoIMAPAddr, config.Pluto.Verify)
+	if err != nil {
+		log.Fatalf("Failed to probe pluto: %s\n", err.Error())
+	}
+
+	manifest.AddServer("pluto", plutoInfo)
+
+	err = manifest.Write(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
+
+	// Prepare histogram to record individual results in.
+	results := stats.NewHistogram(3)
 
 	log.Printf("Running tests on pluto...\n")
 
 	for num := 1; num <= runs; num++ {
 
-		i := num - 1
-
 		// Prepare command to send.
 		command := fmt.Sprintf("create%d CREATE evaluation-mailbox-%d", num, num)
 
+		// Trace command below the session.
+		span := session.Command("pluto", fmt.Sprintf("create%d", num), "CREATE", fmt.Sprintf("evaluation-mailbox-%d", num))
+
 		// Take current time stamp.
 		timeStart := time.Now().UnixNano()
 
@@ -136,14 +123,34 @@ func main() {
 			log.Fatalf("%d: Server responded unexpectedly to CREATE command: %s\n", num, answer)
 		}
 
+		span.Set("imap.status", "OK")
+		span.EndAt("OK", time.Unix(0, timeEnd))
+
 		// Calculate round-trip time.
 		rtt := timeEnd - timeStart
 
-		// Store result in buffer.
-		results[i] = rtt
+		// Record result in histogram.
+		results.Record(rtt)
 
 		// Append log line to file.
 		plutoLogFile.WriteString(fmt.Sprintf("%d, %d\n", num, rtt))
+
+		// Append record to results file.
+		err = plutoRecords.Write(records.Record{
+			Scenario: "create",
+			Target:   "pluto",
+			User:     config.Pluto.CreateTest.Name,
+			Seq:      num,
+			Op:       "CREATE",
+			Start:    time.Unix(0, timeStart),
+			Latency:  rtt,
+			Bytes:    len(command),
+			Status:   "OK",
+		})
+		if err != nil {
+			plutoRecords.Close()
+			log.Fatalf("Failed to write record: %s\n", err.Error())
+		}
 	}
 
 	// Log out.
@@ -153,7 +160,7 @@ func main() {
 	}
 
 	// Receive first part of answer.
-	answer, err = plutoC.Receive(false)
+	answer, err := plutoC.Receive(false)
 	if err != nil {
 		log.Fatalf("Error receiving first part of LOGOUT response: %s\n", err.Error())
 	}
@@ -170,51 +177,46 @@ func main() {
 		log.Fatalf("Server responded unexpectedly to LOGOUT: %s\n", answer)
 	}
 
-	// Calculate statistics and print them.
-	var sum int64 = 0
-	for _, result := range results {
-		sum += result
-	}
-
-	msAvg := (float64(sum) / float64(runs)) / float64(time.Millisecond)
+	session.End("OK")
 
-	log.Printf("Done on pluto, sent %d create instructions, each took %f ms on average.\n\n", runs, msAvg)
+	// Calculate statistics, print and store them.
+	summary := results.Summarize()
 
-	// Run tests on Dovecot.
-	log.Printf("Connecting to Dovecot...\n")
+	log.Printf("Done on pluto, sent %d create instructions: %s\n\n", runs, summary.Line())
 
-	// Connect to remote Dovecot system.
-	dovecotConn, err := tls.Dial("tcp", dovecotIMAPAddr, dovecotTLSConfig)
+	err = stats.WriteSummaryFile(strings.Replace(plutoLogFileName, ".log", ".summary", 1), "CREATE", "pluto", logFileTime, summary)
 	if err != nil {
-		log.Fatalf("Was unable to connect to remote Dovecot server: %s\n", err.Error())
-	}
-
-	// Create a new connection struct based on it.
-	dovecotC := &imap.Connection{
-		OutConn:   dovecotConn,
-		OutReader: bufio.NewReader(dovecotConn),
+		log.Fatalf("Failed to store summary: %s\n", err.Error())
 	}
 
-	// Consume mandatory IMAP greeting.
-	_, err = dovecotC.Receive(false)
+	// Store all buffered records.
+	err = plutoRecords.Close()
 	if err != nil {
-		log.Fatalf("Error during receiving initial server greeting: %s\n", err.Error())
+		log.Fatalf("Failed to store results: %s\n", err.Error())
 	}
+}
 
-	// Log in as first user.
-	err = dovecotC.Send(false, fmt.Sprintf("createA LOGIN %s %s", config.Dovecot.CreateTest.Name, config.Dovecot.CreateTest.Password))
-	if err != nil {
-		log.Fatalf("Sending LOGIN to server failed with: %s\n", err.Error())
-	}
+// RunDovecot logs in to Dovecot and sends runs CREATE
+// commands for numbered mailboxes, storing the
+// completion time of each next to the other
+// results of the run.
+func RunDovecot(config *config.Config, dovecotIMAPAddr string, dovecotTLSConfig *tls.Config, runs int, logFileTime time.Time, format string, manifest *records.Manifest, manifestFileName string, dashboard *progress.Dashboard, tracer *tracing.Tracer) {
 
-	// Wait for success message.
-	answer, err = dovecotC.Receive(false)
+	log.Printf("Connecting to Dovecot...\n")
+
+	// Trace this session if requested.
+	session := tracer.Session("Dovecot", config.Dovecot.CreateTest.Name)
+
+	// Connect to remote Dovecot system.
+	dovecotC, err := utils.Dial(dovecotIMAPAddr, dovecotTLSConfig, config.Dovecot.Mode(), session)
 	if err != nil {
-		log.Fatalf("Error during LOGIN as user %s: %s\n", config.Dovecot.CreateTest.Name, err.Error())
+		log.Fatalf("Was unable to connect to remote Dovecot server: %s\n", err.Error())
 	}
 
-	if strings.HasPrefix(answer, "createA OK") != true {
-		log.Fatalf("Server responded unexpectedly to LOGIN: %s\n", answer)
+	// Log in as first user.
+	err = utils.Authenticate(dovecotC, "createA", config.Dovecot.Auth, config.Dovecot.CreateTest, session)
+	if err != nil {
+		log.Fatalf("Failed to log in to Dovecot: %s\n", err.Error())
 	}
 
 	log.Printf("Logged in as '%s'.\n", config.Dovecot.CreateTest.Name)
@@ -236,18 +238,44 @@ func main() {
 	// Prepend file with meta information about this test.
 	dovecotLogFile.WriteString(fmt.Sprintf("Subject: CREATE\nPlatform: Dovecot\nDate: %s\n-----\n", logFileTime.Format("2006-01-02-15-04-05")))
 
+	// Create machine-readable results file for Dovecot.
+	dovecotRecordsFileName := records.FileName(dovecotLogFileName, format)
+
+	dovecotRecords, err := records.NewWriter(dovecotRecordsFileName)
+	if err != nil {
+		log.Fatalf("Failed to create results file: %s\n", err.Error())
+	}
+	dovecotRecords.Observe(dashboard.Record)
+	dovecotRecords.Observe(metrics.Record)
+
+	manifest.AddFile(dovecotRecordsFileName)
+
+	// Record what the server announces about itself.
+	dovecotInfo, err := utils.ProbeServer(dovecotC, "createI", dovecotIMAPAddr, config.Dovecot.Verify)
+	if err != nil {
+		log.Fatalf("Failed to probe Dovecot: %s\n", err.Error())
+	}
+
+	manifest.AddServer("Dovecot", dovecotInfo)
+
+	err = manifest.Write(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
+
 	log.Printf("Running tests on Dovecot...\n")
 
-	// Reset results slice.
-	results = make([]int64, runs)
+	// Prepare histogram to record individual results in.
+	results := stats.NewHistogram(3)
 
 	for num := 1; num <= runs; num++ {
 
-		i := num - 1
-
 		// Prepare command to send.
 		command := fmt.Sprintf("create%d CREATE evaluation-mailbox-%d", num, num)
 
+		// Trace command below the session.
+		span := session.Command("Dovecot", fmt.Sprintf("create%d", num), "CREATE", fmt.Sprintf("evaluation-mailbox-%d", num))
+
 		// Take current time stamp.
 		timeStart := time.Now().UnixNano()
 
@@ -270,14 +298,34 @@ func main() {
 			log.Fatalf("%d: Server responded unexpectedly to CREATE command: %s\n", num, answer)
 		}
 
+		span.Set("imap.status", "OK")
+		span.EndAt("OK", time.Unix(0, timeEnd))
+
 		// Calculate round-trip time.
 		rtt := timeEnd - timeStart
 
-		// Store result in buffer.
-		results[i] = rtt
+		// Record result in histogram.
+		results.Record(rtt)
 
 		// Append log line to file.
 		dovecotLogFile.WriteString(fmt.Sprintf("%d, %d\n", num, rtt))
+
+		// Append record to results file.
+		err = dovecotRecords.Write(records.Record{
+			Scenario: "create",
+			Target:   "Dovecot",
+			User:     config.Dovecot.CreateTest.Name,
+			Seq:      num,
+			Op:       "CREATE",
+			Start:    time.Unix(0, timeStart),
+			Latency:  rtt,
+			Bytes:    len(command),
+			Status:   "OK",
+		})
+		if err != nil {
+			dovecotRecords.Close()
+			log.Fatalf("Failed to write record: %s\n", err.Error())
+		}
 	}
 
 	// Log out.
@@ -287,13 +335,13 @@ func main() {
 	}
 
 	// Receive first part of answer.
-	answer, err = dovecotC.Receive(false)
+	answer, err := dovecotC.Receive(false)
 	if err != nil {
 		log.Fatalf("Error receiving first part of LOGOUT response: %s\n", err.Error())
 	}
 
 	// Receive next line from server.
-	nextAnswer, err = dovecotC.Receive(false)
+	nextAnswer, err := dovecotC.Receive(false)
 	if err != nil {
 		log.Fatalf("Error receiving second part of LOGOUT response: %s\n", err.Error())
 	}
@@ -304,14 +352,139 @@ func main() {
 		log.Fatalf("Server responded unexpectedly to LOGOUT: %s\n", answer)
 	}
 
-	// Calculate statistics and print them.
-	sum = 0
-	for _, result := range results {
-		sum += result
+	session.End("OK")
+
+	// Calculate statistics, print and store them.
+	summary := results.Summarize()
+
+	log.Printf("Done on Dovecot, sent %d create instructions: %s", runs, summary.Line())
+
+	err = stats.WriteSummaryFile(strings.Replace(dovecotLogFileName, ".log", ".summary", 1), "CREATE", "Dovecot", logFileTime, summary)
+	if err != nil {
+		log.Fatalf("Failed to store summary: %s\n", err.Error())
+	}
+
+	// Store all buffered records.
+	err = dovecotRecords.Close()
+	if err != nil {
+		log.Fatalf("Failed to store results: %s\n", err.Error())
+	}
+}
+
+func main() {
+
+	// Make test config file location, number of messages
+	// to send per test, results format and tested systems
+	// configurable.
+	configSource := config.Flags()
+	runsFlag := flag.Int("runs", 100, "Specify how many times the command of this test is to be sent to server.")
+	formatFlag := flag.String("format", "jsonl", "Specify format of machine-readable results file: jsonl or csv.")
+	progressFlag := flag.Duration("progress", time.Second, "Specify interval of live progress updates, 0 disables them.")
+	metricsFlag := flag.String("metrics", "", "Serve Prometheus metrics on this address, e.g. :9100. Empty disables them.")
+	traceFlag := flag.String("trace", "", "Export spans of all commands via OTLP/HTTP to this collector, e.g. http://localhost:4318.")
+	traceFileFlag := flag.String("traceFile", "", "Export spans of all commands as OTLP JSON to this file.")
+	targetFlag := flag.String("target", "all", "Specify which system to test: all, pluto or Dovecot.")
+	flag.Parse()
+
+	runs := *runsFlag
+
+	// Determine which of both systems to test.
+	runPluto, runDovecot, err := utils.ParseTarget(*targetFlag)
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+
+	log.Printf("Testing CREATE command on %s...\n", utils.TargetNames(runPluto, runDovecot))
+
+	// Read configuration from file.
+	config, err := config.Load(configSource)
+	if err != nil {
+		log.Fatalf("Error loading config: %s\n", err.Error())
+	}
+
+	// Check that all settings this test needs are present.
+	if runPluto {
+		err = config.Require("Pluto", "CreateTest")
+		if err != nil {
+			log.Fatalf("Error in config for pluto: %s\n", err.Error())
+		}
+	}
+
+	if runDovecot {
+		err = config.Require("Dovecot", "CreateTest")
+		if err != nil {
+			log.Fatalf("Error in config for Dovecot: %s\n", err.Error())
+		}
+	}
+
+	// Create needed TLS configs with correct certificates.
+	plutoTLSConfig, dovecotTLSConfig, err := utils.InitTLSConfigs(config)
+	if err != nil {
+		log.Fatalf("Error loading TLS configs for pluto and Dovecot: %s\n", err.Error())
+	}
+
+	// Create connection string to connect to pluto and Dovecot.
+	plutoIMAPAddr := fmt.Sprintf("%s:%s", config.Pluto.IP, config.Pluto.Port)
+	dovecotIMAPAddr := fmt.Sprintf("%s:%s", config.Dovecot.IP, config.Dovecot.Port)
+
+	// Take current time stamp shared by all files of this run.
+	logFileTime := time.Now()
+
+	// Describe this run in a manifest next to its results.
+	manifestFileName := records.ManifestFileName("create", logFileTime)
+
+	manifest, err := records.NewManifest("create", configSource.FileNames(), logFileTime)
+	if err != nil {
+		log.Fatalf("Failed to prepare run manifest: %s\n", err.Error())
+	}
+
+	// Serve live metrics of the run if requested.
+	if *metricsFlag != "" {
+
+		err = metrics.Serve(*metricsFlag)
+		if err != nil {
+			log.Fatalf("Failed to serve metrics: %s\n", err.Error())
+		}
+	}
+
+	// Export spans of all commands if requested.
+	tracer, err := tracing.New(*traceFlag, *traceFileFlag)
+	if err != nil {
+		log.Fatalf("Failed to prepare tracing: %s\n", err.Error())
+	}
+
+	// Show live progress of the run.
+	dashboard := progress.New(*progressFlag)
+	dashboard.Start()
+
+	// Run tests on pluto.
+	if runPluto {
+		RunPluto(config, plutoIMAPAddr, plutoTLSConfig, runs, logFileTime, *formatFlag, manifest, manifestFileName, dashboard, tracer)
+	}
+
+	// Run tests on Dovecot.
+	if runDovecot {
+		RunDovecot(config, dovecotIMAPAddr, dovecotTLSConfig, runs, logFileTime, *formatFlag, manifest, manifestFileName, dashboard, tracer)
+	}
+
+	// Stop live progress updates.
+	dashboard.Stop()
+
+	// Stop serving metrics.
+	err = metrics.Shutdown()
+	if err != nil {
+		log.Printf("%s\n", err.Error())
 	}
 
-	msAvg = 0
-	msAvg = (float64(sum) / float64(runs)) / float64(time.Millisecond)
+	// Export remaining spans.
+	err = tracer.Close()
+	if err != nil {
+		log.Printf("Failed to export spans: %s\n", err.Error())
+	}
 
-	log.Printf("Done on Dovecot, sent %d create instructions, each took %f ms on average.", runs, msAvg)
+	// Note end of run in manifest.
+	err = manifest.Finish(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
 }
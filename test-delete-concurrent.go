@@ -1,7 +1,6 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
 	"log"
@@ -9,16 +8,19 @@ import (
 	"strings"
 	"time"
 
-	"crypto/tls"
-
 	"github.com/numbleroot/pluto-evaluation/config"
+	"github.com/numbleroot/pluto-evaluation/metrics"
+	"github.com/numbleroot/pluto-evaluation/progress"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+	"github.com/numbleroot/pluto-evaluation/tracing"
 	"github.com/numbleroot/pluto-evaluation/utils"
 	"github.com/numbleroot/pluto/imap"
 )
 
 // Functions
 
-func PlutoTester(start chan struct{}, done chan struct{}, plutoC *imap.Connection, connNum int, runs int, plutoLogFolder string, logFileTime time.Time) {
+func PlutoTester(start chan struct{}, done chan struct{}, plutoC *imap.Connection, session *tracing.Span, connNum int, runs int, plutoLogFolder string, logFileTime time.Time, results *stats.Histogram, recs *records.Writer, user string) {
 
 	// Define an individual test log file name.
 	plutoLogFileName := fmt.Sprintf("%s/conn-%03d.log", plutoLogFolder, connNum)
@@ -46,6 +48,9 @@ func PlutoTester(start chan struct{}, done chan struct{}, plutoC *imap.Connectio
 		// Prepare command to send.
 		command := fmt.Sprintf("delete%d DELETE evaluation-mailbox-%d", num, num)
 
+		// Trace command below the session.
+		span := session.Command("pluto", fmt.Sprintf("delete%d", num), "DELETE", fmt.Sprintf("evaluation-mailbox-%d", num))
+
 		// Take current time stamp.
 		timeStart := time.Now().UnixNano()
 
@@ -68,11 +73,35 @@ func PlutoTester(start chan struct{}, done chan struct{}, plutoC *imap.Connectio
 			log.Fatalf("%d: Server responded unexpectedly to DELETE command: %s\n", num, answer)
 		}
 
+		span.Set("imap.status", "OK")
+		span.EndAt("OK", time.Unix(0, timeEnd))
+
 		// Calculate round-trip time.
 		rtt := timeEnd - timeStart
 
+		// Record result in shared histogram.
+		results.Record(rtt)
+
 		// Append log line to file.
 		plutoLogFile.WriteString(fmt.Sprintf("%d, %d\n", num, rtt))
+
+		// Append record to shared results file.
+		err = recs.Write(records.Record{
+			Scenario: "delete-concurrent",
+			Target:   "pluto",
+			User:     user,
+			Conn:     connNum,
+			Seq:      num,
+			Op:       "DELETE",
+			Start:    time.Unix(0, timeStart),
+			Latency:  rtt,
+			Bytes:    len(command),
+			Status:   "OK",
+		})
+		if err != nil {
+			recs.Close()
+			log.Fatalf("Failed to write record: %s\n", err.Error())
+		}
 	}
 
 	// Log out.
@@ -99,11 +128,13 @@ func PlutoTester(start chan struct{}, done chan struct{}, plutoC *imap.Connectio
 		log.Fatalf("Server responded unexpectedly to LOGOUT: %s\n", answer)
 	}
 
+	session.End("OK")
+
 	// Send done signal back.
 	done <- struct{}{}
 }
 
-func DovecotTester(start chan struct{}, done chan struct{}, dovecotC *imap.Connection, connNum int, runs int, dovecotLogFolder string, logFileTime time.Time) {
+func DovecotTester(start chan struct{}, done chan struct{}, dovecotC *imap.Connection, session *tracing.Span, connNum int, runs int, dovecotLogFolder string, logFileTime time.Time, results *stats.Histogram, recs *records.Writer, user string) {
 
 	// Define an individual test log file name.
 	dovecotLogFileName := fmt.Sprintf("%s/conn-%03d.log", dovecotLogFolder, connNum)
@@ -130,6 +161,9 @@ func DovecotTester(start chan struct{}, done chan struct{}, dovecotC *imap.Conne
 		// Prepare command to send.
 		command := fmt.Sprintf("delete%d DELETE evaluation-mailbox-%d", num, num)
 
+		// Trace command below the session.
+		span := session.Command("Dovecot", fmt.Sprintf("delete%d", num), "DELETE", fmt.Sprintf("evaluation-mailbox-%d", num))
+
 		// Take current time stamp.
 		timeStart := time.Now().UnixNano()
 
@@ -152,11 +186,35 @@ func DovecotTester(start chan struct{}, done chan struct{}, dovecotC *imap.Conne
 			log.Fatalf("%d: Server responded unexpectedly to DELETE command: %s\n", num, answer)
 		}
 
+		span.Set("imap.status", "OK")
+		span.EndAt("OK", time.Unix(0, timeEnd))
+
 		// Calculate round-trip time.
 		rtt := timeEnd - timeStart
 
+		// Record result in shared histogram.
+		results.Record(rtt)
+
 		// Append log line to file.
 		dovecotLogFile.WriteString(fmt.Sprintf("%d, %d\n", num, rtt))
+
+		// Append record to shared results file.
+		err = recs.Write(records.Record{
+			Scenario: "delete-concurrent",
+			Target:   "Dovecot",
+			User:     user,
+			Conn:     connNum,
+			Seq:      num,
+			Op:       "DELETE",
+			Start:    time.Unix(0, timeStart),
+			Latency:  rtt,
+			Bytes:    len(command),
+			Status:   "OK",
+		})
+		if err != nil {
+			recs.Close()
+			log.Fatalf("Failed to write record: %s\n", err.Error())
+		}
 	}
 
 	// Log out.
@@ -183,16 +241,23 @@ func DovecotTester(start chan struct{}, done chan struct{}, dovecotC *imap.Conne
 		log.Fatalf("Server responded unexpectedly to LOGOUT: %s\n", answer)
 	}
 
+	session.End("OK")
+
 	// Send done signal back.
 	done <- struct{}{}
 }
 
 func main() {
 
-	// Make test config file location and number of messages
-	// to send per test configurable.
-	configFlag := flag.String("config", "test-config.toml", "Specify location of config file that describes test setup configuration.")
+	// Make test config file location, number of messages
+	// to send per test and results format configurable.
+	configSource := config.Flags()
 	runsFlag := flag.Int("runs", 100, "Specify how many times the command of this test is to be sent to server.")
+	formatFlag := flag.String("format", "jsonl", "Specify format of machine-readable results file: jsonl or csv.")
+	progressFlag := flag.Duration("progress", time.Second, "Specify interval of live progress updates, 0 disables them.")
+	metricsFlag := flag.String("metrics", "", "Serve Prometheus metrics on this address, e.g. :9100. Empty disables them.")
+	traceFlag := flag.String("trace", "", "Export spans of all commands via OTLP/HTTP to this collector, e.g. http://localhost:4318.")
+	traceFileFlag := flag.String("traceFile", "", "Export spans of all commands as OTLP JSON to this file.")
 	flag.Parse()
 
 	runs := *runsFlag
@@ -200,20 +265,25 @@ func main() {
 	log.Printf("Testing DELETE command concurrently on pluto and Dovecot...\n\n")
 
 	// Read configuration from file.
-	config, err := config.LoadConfig(*configFlag)
+	config, err := config.Load(configSource)
 	if err != nil {
 		log.Fatalf("Error loading config: %s\n", err.Error())
 	}
 
-	// Save number of concurrent tests for later use.
-	numTests := len(config.Pluto.ConcurrentTest.User)
+	// Check that all settings this test needs are present.
+	err = config.Require("Pluto", "ConcurrentTest")
+	if err != nil {
+		log.Fatalf("Error in config for pluto: %s\n", err.Error())
+	}
 
-	// Check that same amount of users is configured for
-	// both systems, pluto and Dovecot.
-	if numTests != len(config.Dovecot.ConcurrentTest.User) {
-		log.Fatalf("Please configure an equal number of concurrent test users for pluto and Dovecot.\n")
+	err = config.Require("Dovecot", "ConcurrentTest")
+	if err != nil {
+		log.Fatalf("Error in config for Dovecot: %s\n", err.Error())
 	}
 
+	// Save number of concurrent tests for later use.
+	numTests := len(config.Pluto.ConcurrentTest.User)
+
 	// Prepare buffered channels to signal start and
 	// finish over to involved testing routines.
 	start := make(chan struct{}, numTests)
@@ -248,48 +318,101 @@ func main() {
 		log.Fatalf("Failed to create folder: %s\n", err.Error())
 	}
 
-	log.Printf("Connecting %d times to pluto...\n", numTests)
+	// Describe this run in a manifest next to its results.
+	manifestFileName := records.ManifestFileName("delete-concurrent", logFileTime)
 
-	for connNum := 0; connNum < numTests; connNum++ {
+	manifest, err := records.NewManifest("delete-concurrent", configSource.FileNames(), logFileTime)
+	if err != nil {
+		log.Fatalf("Failed to prepare run manifest: %s\n", err.Error())
+	}
 
-		// Connect to remote pluto system.
-		plutoConn, err := tls.Dial("tcp", plutoIMAPAddr, plutoTLSConfig)
+	// Serve live metrics of the run if requested.
+	if *metricsFlag != "" {
+
+		err = metrics.Serve(*metricsFlag)
 		if err != nil {
-			log.Fatalf("Was unable to connect to remote pluto server: %s\n", err.Error())
+			log.Fatalf("Failed to serve metrics: %s\n", err.Error())
 		}
+	}
 
-		// Create a new connection struct based on it.
-		plutoC := &imap.Connection{
-			OutConn:   plutoConn,
-			OutReader: bufio.NewReader(plutoConn),
-		}
+	// Export spans of all commands if requested.
+	tracer, err := tracing.New(*traceFlag, *traceFileFlag)
+	if err != nil {
+		log.Fatalf("Failed to prepare tracing: %s\n", err.Error())
+	}
+
+	// Show live progress of the run.
+	dashboard := progress.New(*progressFlag)
+	dashboard.Start()
+
+	// Create one machine-readable results file per
+	// system, shared by all of its connections.
+	plutoRecordsFileName := records.FileName(plutoLogFolder, *formatFlag)
+
+	plutoRecords, err := records.NewWriter(plutoRecordsFileName)
+	if err != nil {
+		log.Fatalf("Failed to create results file: %s\n", err.Error())
+	}
+	plutoRecords.Observe(dashboard.Record)
+	plutoRecords.Observe(metrics.Record)
+
+	dovecotRecordsFileName := records.FileName(dovecotLogFolder, *formatFlag)
+
+	dovecotRecords, err := records.NewWriter(dovecotRecordsFileName)
+	if err != nil {
+		log.Fatalf("Failed to create results file: %s\n", err.Error())
+	}
+	dovecotRecords.Observe(dashboard.Record)
+	dovecotRecords.Observe(metrics.Record)
+
+	manifest.SetParameter("concurrency", numTests)
+
+	manifest.AddFile(plutoRecordsFileName)
+	manifest.AddFile(dovecotRecordsFileName)
+
+	err = manifest.Write(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
+
+	// Prepare histogram shared by all connections.
+	plutoResults := stats.NewHistogram(3)
+
+	log.Printf("Connecting %d times to pluto...\n", numTests)
+
+	for connNum := 0; connNum < numTests; connNum++ {
+
+		// Trace this session if requested.
+		session := tracer.Session("pluto", config.Pluto.ConcurrentTest.User[connNum].Name)
 
-		// Consume mandatory IMAP greeting.
-		_, err = plutoC.Receive(false)
+		// Connect to remote pluto system.
+		plutoC, err := utils.Dial(plutoIMAPAddr, plutoTLSConfig, config.Pluto.Mode(), session)
 		if err != nil {
-			log.Fatalf("Error during receiving initial server greeting: %s\n", err.Error())
+			log.Fatalf("Was unable to connect to remote pluto server: %s\n", err.Error())
 		}
 
 		// Log in as first user.
-		err = plutoC.Send(false, fmt.Sprintf("deleteA LOGIN %s %s", config.Pluto.ConcurrentTest.User[connNum].Name, config.Pluto.ConcurrentTest.User[connNum].Password))
+		err = utils.Authenticate(plutoC, "deleteA", config.Pluto.Auth, config.Pluto.ConcurrentTest.User[connNum], session)
 		if err != nil {
-			log.Fatalf("Sending LOGIN to server failed with: %s\n", err.Error())
+			log.Fatalf("Failed to log in to pluto: %s\n", err.Error())
 		}
 
-		// Wait for success message.
-		answer, err := plutoC.Receive(false)
-		if err != nil {
-			log.Fatalf("Error during LOGIN as user %s: %s\n", config.Pluto.ConcurrentTest.User[connNum].Name, err.Error())
-		}
+		log.Printf("Logged in as '%s'.\n", config.Pluto.ConcurrentTest.User[connNum].Name)
 
-		if strings.HasPrefix(answer, "deleteA OK") != true {
-			log.Fatalf("Server responded unexpectedly to LOGIN: %s\n", answer)
-		}
+		// Record what the server announces about itself
+		// once, on the first connection.
+		if connNum == 0 {
 
-		log.Printf("Logged in as '%s'.\n", config.Pluto.ConcurrentTest.User[connNum].Name)
+			plutoInfo, err := utils.ProbeServer(plutoC, "deleteI", plutoIMAPAddr, config.Pluto.Verify)
+			if err != nil {
+				log.Fatalf("Failed to probe pluto: %s\n", err.Error())
+			}
+
+			manifest.AddServer("pluto", plutoInfo)
+		}
 
 		// Dispatch to own goroutine.
-		go PlutoTester(start, done, plutoC, connNum, runs, plutoLogFolder, logFileTime)
+		go PlutoTester(start, done, plutoC, session, connNum, runs, plutoLogFolder, logFileTime, plutoResults, plutoRecords, config.Pluto.ConcurrentTest.User[connNum].Name)
 	}
 
 	// Send start signal to ready routines.
@@ -302,51 +425,57 @@ func main() {
 		<-done
 	}
 
-	log.Printf("Done on pluto, sent %d * %d = %d messages.\n\n", numTests, runs, (numTests * runs))
+	// Calculate statistics over all connections,
+	// print and store them.
+	summary := plutoResults.Summarize()
+
+	log.Printf("Done on pluto, sent %d * %d = %d messages: %s\n\n", numTests, runs, (numTests * runs), summary.Line())
+
+	err = stats.WriteSummaryFile(fmt.Sprintf("%s.summary", plutoLogFolder), "Concurrent DELETE", "pluto", logFileTime, summary)
+	if err != nil {
+		log.Fatalf("Failed to store summary: %s\n", err.Error())
+	}
 
 	// Run tests on Dovecot.
+
+	// Prepare histogram shared by all connections.
+	dovecotResults := stats.NewHistogram(3)
+
 	log.Printf("Connecting %d times to Dovecot...\n", numTests)
 
 	for connNum := 0; connNum < numTests; connNum++ {
 
+		// Trace this session if requested.
+		session := tracer.Session("Dovecot", config.Dovecot.ConcurrentTest.User[connNum].Name)
+
 		// Connect to remote Dovecot system.
-		dovecotConn, err := tls.Dial("tcp", dovecotIMAPAddr, dovecotTLSConfig)
+		dovecotC, err := utils.Dial(dovecotIMAPAddr, dovecotTLSConfig, config.Dovecot.Mode(), session)
 		if err != nil {
 			log.Fatalf("Was unable to connect to remote Dovecot server: %s\n", err.Error())
 		}
 
-		// Create a new connection struct based on it.
-		dovecotC := &imap.Connection{
-			OutConn:   dovecotConn,
-			OutReader: bufio.NewReader(dovecotConn),
-		}
-
-		// Consume mandatory IMAP greeting.
-		_, err = dovecotC.Receive(false)
-		if err != nil {
-			log.Fatalf("Error during receiving initial server greeting: %s\n", err.Error())
-		}
-
 		// Log in as first user.
-		err = dovecotC.Send(false, fmt.Sprintf("deleteA LOGIN %s %s", config.Dovecot.ConcurrentTest.User[connNum].Name, config.Dovecot.ConcurrentTest.User[connNum].Password))
+		err = utils.Authenticate(dovecotC, "deleteA", config.Dovecot.Auth, config.Dovecot.ConcurrentTest.User[connNum], session)
 		if err != nil {
-			log.Fatalf("Sending LOGIN to server failed with: %s\n", err.Error())
+			log.Fatalf("Failed to log in to Dovecot: %s\n", err.Error())
 		}
 
-		// Wait for success message.
-		answer, err := dovecotC.Receive(false)
-		if err != nil {
-			log.Fatalf("Error during LOGIN as user %s: %s\n", config.Dovecot.ConcurrentTest.User[connNum].Name, err.Error())
-		}
+		log.Printf("Logged in as '%s'.\n", config.Dovecot.ConcurrentTest.User[connNum].Name)
 
-		if strings.HasPrefix(answer, "deleteA OK") != true {
-			log.Fatalf("Server responded unexpectedly to LOGIN: %s\n", answer)
-		}
+		// Record what the server announces about itself
+		// once, on the first connection.
+		if connNum == 0 {
 
-		log.Printf("Logged in as '%s'.\n", config.Dovecot.ConcurrentTest.User[connNum].Name)
+			dovecotInfo, err := utils.ProbeServer(dovecotC, "deleteI", dovecotIMAPAddr, config.Dovecot.Verify)
+			if err != nil {
+				log.Fatalf("Failed to probe Dovecot: %s\n", err.Error())
+			}
+
+			manifest.AddServer("Dovecot", dovecotInfo)
+		}
 
 		// Dispatch into own goroutine.
-		go DovecotTester(start, done, dovecotC, connNum, runs, dovecotLogFolder, logFileTime)
+		go DovecotTester(start, done, dovecotC, session, connNum, runs, dovecotLogFolder, logFileTime, dovecotResults, dovecotRecords, config.Dovecot.ConcurrentTest.User[connNum].Name)
 	}
 
 	// Send start signal to ready routines.
@@ -359,5 +488,47 @@ func main() {
 		<-done
 	}
 
-	log.Printf("Done on Dovecot, sent %d * %d = %d messages.\n\n", numTests, runs, (numTests * runs))
+	// Calculate statistics over all connections,
+	// print and store them.
+	summary = dovecotResults.Summarize()
+
+	log.Printf("Done on Dovecot, sent %d * %d = %d messages: %s\n\n", numTests, runs, (numTests * runs), summary.Line())
+
+	err = stats.WriteSummaryFile(fmt.Sprintf("%s.summary", dovecotLogFolder), "Concurrent DELETE", "Dovecot", logFileTime, summary)
+	if err != nil {
+		log.Fatalf("Failed to store summary: %s\n", err.Error())
+	}
+
+	// Stop live progress updates.
+	dashboard.Stop()
+
+	// Store all buffered records.
+	err = plutoRecords.Close()
+	if err != nil {
+		log.Fatalf("Failed to store results: %s\n", err.Error())
+	}
+
+	// Store all buffered records.
+	err = dovecotRecords.Close()
+	if err != nil {
+		log.Fatalf("Failed to store results: %s\n", err.Error())
+	}
+
+	// Stop serving metrics.
+	err = metrics.Shutdown()
+	if err != nil {
+		log.Printf("%s\n", err.Error())
+	}
+
+	// Export remaining spans.
+	err = tracer.Close()
+	if err != nil {
+		log.Printf("Failed to export spans: %s\n", err.Error())
+	}
+
+	// Note end of run in manifest.
+	err = manifest.Finish(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
 }
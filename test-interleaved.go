@@ -0,0 +1,451 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"crypto/tls"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+	"github.com/numbleroot/pluto-evaluation/messages"
+	"github.com/numbleroot/pluto-evaluation/metrics"
+	"github.com/numbleroot/pluto-evaluation/progress"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+	"github.com/numbleroot/pluto-evaluation/tracing"
+	"github.com/numbleroot/pluto-evaluation/utils"
+	"github.com/numbleroot/pluto/imap"
+)
+
+// Structs
+
+// Target bundles everything needed to send the
+// tested command to one IMAP system, including its
+// open session, its span and histogram.
+type Target struct {
+	Name          string
+	Addr          string
+	Mode          string
+	Auth          string
+	TLSConfig     *tls.Config
+	Verify        config.Verify
+	User          config.User
+	LiteralSuffix string
+	Conn          *imap.Connection
+	Session       *tracing.Span
+	Results       *stats.Histogram
+}
+
+// Variables
+
+// Commands lists all commands that can be tested in
+// interleaved fashion.
+var Commands = []string{"append", "create", "delete", "store"}
+
+// Functions
+
+// TestUser returns the user configured for supplied
+// command in the section of one system.
+func TestUser(command string, appendTest config.User, createTest config.User, deleteTest config.User, storeTest config.User) config.User {
+
+	switch command {
+	case "create":
+		return createTest
+	case "delete":
+		return deleteTest
+	case "store":
+		return storeTest
+	}
+
+	return appendTest
+}
+
+// OpenSession connects to target, logs in the test
+// user and, for STORE, selects INBOX. It notes what
+// the server announces about itself in manifest. The
+// session is traced as one span if tracer is not nil.
+func OpenSession(target *Target, command string, manifest *records.Manifest, tracer *tracing.Tracer) {
+
+	log.Printf("Connecting to %s...\n", target.Name)
+
+	target.Session = tracer.Session(target.Name, target.User.Name)
+
+	c, err := utils.Dial(target.Addr, target.TLSConfig, target.Mode, target.Session)
+	if err != nil {
+		log.Fatalf("Failed to connect to %s: %s\n", target.Name, err.Error())
+	}
+
+	err = utils.Authenticate(c, "interleavedA", target.Auth, target.User, target.Session)
+	if err != nil {
+		log.Fatalf("Failed to log in to %s: %s\n", target.Name, err.Error())
+	}
+
+	log.Printf("Logged in as '%s'.\n", target.User.Name)
+
+	// STORE addresses messages by sequence number,
+	// thus INBOX needs to be selected beforehand.
+	if command == "store" {
+
+		err = c.Send(false, "interleavedB SELECT INBOX")
+		if err != nil {
+			log.Fatalf("Sending SELECT to server failed with: %s\n", err.Error())
+		}
+
+		answer, status, err := utils.ReceiveTagged(c, "interleavedB")
+		if err != nil {
+			log.Fatalf("Error receiving SELECT response: %s\n", err.Error())
+		}
+
+		if status != "OK" {
+			log.Fatalf("Server responded unexpectedly to SELECT: %s\n", answer)
+		}
+
+		log.Printf("Selected INBOX for further commands.\n")
+	}
+
+	// Record what the server announces about itself.
+	info, err := utils.ProbeServer(c, "interleavedI", target.Addr, target.Verify)
+	if err != nil {
+		log.Fatalf("Failed to probe %s: %s\n", target.Name, err.Error())
+	}
+
+	manifest.AddServer(target.Name, info)
+
+	target.Conn = c
+	target.Results = stats.NewHistogram(3)
+}
+
+// RunCommand sends command number num to target and
+// records its completion time. Commands refused with
+// NO are counted as errors, BAD aborts the test.
+func RunCommand(target *Target, command string, num int, appendMsg *bytes.Buffer, recs *records.Writer) {
+
+	tag := fmt.Sprintf("%s%d", command, num)
+
+	// Prepare command to send.
+	var line string
+	mailbox := "INBOX"
+
+	switch command {
+	case "append":
+		line = fmt.Sprintf("%s APPEND %s {%d}", tag, mailbox, appendMsg.Len())
+	case "create":
+		mailbox = fmt.Sprintf("evaluation-mailbox-%d", num)
+		line = fmt.Sprintf("%s CREATE %s", tag, mailbox)
+	case "delete":
+		mailbox = fmt.Sprintf("evaluation-mailbox-%d", num)
+		line = fmt.Sprintf("%s DELETE %s", tag, mailbox)
+	case "store":
+		line = fmt.Sprintf("%s STORE %d +FLAGS.SILENT (\\Seen \\Deleted)", tag, num)
+	}
+
+	op := strings.ToUpper(command)
+	bytesSent := len(line)
+
+	// Trace command below the session of target.
+	span := target.Session.Command(target.Name, tag, op, mailbox)
+
+	// Take current time stamp.
+	timeStart := time.Now().UnixNano()
+
+	// Send command to server.
+	err := target.Conn.Send(false, line)
+	if err != nil {
+		log.Fatalf("%d: Failed during sending %s command to %s: %s\n", num, op, target.Name, err.Error())
+	}
+
+	if command == "append" {
+
+		// Receive continuation request.
+		answer, err := target.Conn.Receive(false)
+		if err != nil {
+			log.Fatalf("%d: Error receiving response to APPEND from %s: %s\n", num, target.Name, err.Error())
+		}
+
+		if strings.HasPrefix(answer, "+") != true {
+			log.Fatalf("%d: Did not receive continuation command from %s: %s\n", num, target.Name, answer)
+		}
+
+		// Send mail message.
+		literal := span.Child("literal upload")
+		literal.Set("imap.message_size", appendMsg.Len())
+
+		_, err = fmt.Fprintf(target.Conn.OutConn, "%s%s", appendMsg, target.LiteralSuffix)
+		if err != nil {
+			log.Fatalf("%d: Sending mail message to %s failed with: %s\n", num, target.Name, err.Error())
+		}
+
+		literal.End("OK")
+
+		span.Set("imap.message_size", appendMsg.Len())
+		bytesSent += appendMsg.Len()
+	}
+
+	// Receive tagged completion of command.
+	answer, status, err := utils.ReceiveTagged(target.Conn, tag)
+	if err != nil {
+		log.Fatalf("%d: Error receiving response to %s from %s: %s\n", num, op, target.Name, err.Error())
+	}
+
+	// Take time stamp after function execution.
+	timeEnd := time.Now().UnixNano()
+
+	span.Set("imap.status", status)
+	span.EndAt(status, time.Unix(0, timeEnd))
+
+	if status == "BAD" {
+		log.Fatalf("%d: %s responded unexpectedly to %s command: %s\n", num, target.Name, op, answer)
+	}
+
+	// Record latency of successful commands and
+	// count refused ones.
+	if status == "OK" {
+		target.Results.Record(timeEnd - timeStart)
+	} else {
+		target.Results.RecordError()
+	}
+
+	// Append record to shared results file.
+	err = recs.Write(records.Record{
+		Scenario: command,
+		Target:   target.Name,
+		User:     target.User.Name,
+		Seq:      num,
+		Op:       op,
+		Start:    time.Unix(0, timeStart),
+		Latency:  (timeEnd - timeStart),
+		Bytes:    bytesSent,
+		Status:   status,
+	})
+	if err != nil {
+		recs.Close()
+		log.Fatalf("Failed to write record: %s\n", err.Error())
+	}
+}
+
+func main() {
+
+	// Make test config file location, number of messages
+	// to send per test, results format, tested command and
+	// size of batches sent to one system in a row configurable.
+	configSource := config.Flags()
+	runsFlag := flag.Int("runs", 100, "Specify how many times the command of this test is to be sent to each server.")
+	formatFlag := flag.String("format", "jsonl", "Specify format of machine-readable results file: jsonl or csv.")
+	progressFlag := flag.Duration("progress", time.Second, "Specify interval of live progress updates, 0 disables them.")
+	metricsFlag := flag.String("metrics", "", "Serve Prometheus metrics on this address, e.g. :9100. Empty disables them.")
+	traceFlag := flag.String("trace", "", "Export spans of all commands via OTLP/HTTP to this collector, e.g. http://localhost:4318.")
+	traceFileFlag := flag.String("traceFile", "", "Export spans of all commands as OTLP JSON to this file.")
+	commandFlag := flag.String("command", "append", "Specify command to test: append, create, delete or store.")
+	batchFlag := flag.Int("batch", 1, "Specify how many commands are sent to one system before switching to the other.")
+	flag.Parse()
+
+	runs := *runsFlag
+	batch := *batchFlag
+	command := strings.ToLower(*commandFlag)
+
+	known := false
+	for _, c := range Commands {
+
+		if c == command {
+			known = true
+		}
+	}
+
+	if known != true {
+		log.Fatalf("Unknown command '%s', choose one of %v\n", *commandFlag, Commands)
+	}
+
+	if batch < 1 {
+		log.Fatalf("Batches need to contain at least one command.\n")
+	}
+
+	log.Printf("Testing %s command on pluto and Dovecot, interleaved in batches of %d...\n", strings.ToUpper(command), batch)
+
+	// Read configuration from file.
+	config, err := config.Load(configSource)
+	if err != nil {
+		log.Fatalf("Error loading config: %s\n", err.Error())
+	}
+
+	// Check that all settings this test needs are present.
+	testName := fmt.Sprintf("%s%sTest", strings.ToUpper(command[:1]), command[1:])
+
+	err = config.Require("Pluto", testName)
+	if err != nil {
+		log.Fatalf("Error in config for pluto: %s\n", err.Error())
+	}
+
+	err = config.Require("Dovecot", testName)
+	if err != nil {
+		log.Fatalf("Error in config for Dovecot: %s\n", err.Error())
+	}
+
+	// Create needed TLS configs with correct certificates.
+	plutoTLSConfig, dovecotTLSConfig, err := utils.InitTLSConfigs(config)
+	if err != nil {
+		log.Fatalf("Error loading TLS configs for pluto and Dovecot: %s\n", err.Error())
+	}
+
+	targets := []*Target{
+		{
+			Name:          "pluto",
+			Addr:          fmt.Sprintf("%s:%s", config.Pluto.IP, config.Pluto.Port),
+			Mode:          config.Pluto.Mode(),
+			Auth:          config.Pluto.Auth,
+			TLSConfig:     plutoTLSConfig,
+			Verify:        config.Pluto.Verify,
+			User:          TestUser(command, config.Pluto.AppendTest, config.Pluto.CreateTest, config.Pluto.DeleteTest, config.Pluto.StoreTest),
+			LiteralSuffix: "",
+		},
+		{
+			Name:          "Dovecot",
+			Addr:          fmt.Sprintf("%s:%s", config.Dovecot.IP, config.Dovecot.Port),
+			Mode:          config.Dovecot.Mode(),
+			Auth:          config.Dovecot.Auth,
+			TLSConfig:     dovecotTLSConfig,
+			Verify:        config.Dovecot.Verify,
+			User:          TestUser(command, config.Dovecot.AppendTest, config.Dovecot.CreateTest, config.Dovecot.DeleteTest, config.Dovecot.StoreTest),
+			LiteralSuffix: "\n",
+		},
+	}
+
+	// Take current time.
+	logFileTime := time.Now()
+
+	// Describe this run in a manifest next to its results.
+	scenario := fmt.Sprintf("interleaved-%s", command)
+	manifestFileName := records.ManifestFileName(scenario, logFileTime)
+
+	manifest, err := records.NewManifest(scenario, configSource.FileNames(), logFileTime)
+	if err != nil {
+		log.Fatalf("Failed to prepare run manifest: %s\n", err.Error())
+	}
+
+	// Serve live metrics of the run if requested.
+	if *metricsFlag != "" {
+
+		err = metrics.Serve(*metricsFlag)
+		if err != nil {
+			log.Fatalf("Failed to serve metrics: %s\n", err.Error())
+		}
+	}
+
+	// Export spans of all commands if requested.
+	tracer, err := tracing.New(*traceFlag, *traceFileFlag)
+	if err != nil {
+		log.Fatalf("Failed to prepare tracing: %s\n", err.Error())
+	}
+
+	// Show live progress of the run.
+	dashboard := progress.New(*progressFlag)
+	dashboard.Start()
+
+	manifest.SetParameter("batch", batch)
+
+	// Prepare message to append.
+	appendMsg := bytes.NewBufferString(messages.Msg01)
+
+	if command == "append" {
+		manifest.SetParameter("message_size", appendMsg.Len())
+	}
+
+	// Create machine-readable results file shared by
+	// both systems, each record names its target.
+	recordsFileName := records.FileName(fmt.Sprintf("results/%s-%s.log", scenario, logFileTime.Format("2006-01-02-15-04-05")), *formatFlag)
+
+	recs, err := records.NewWriter(recordsFileName)
+	if err != nil {
+		log.Fatalf("Failed to create results file: %s\n", err.Error())
+	}
+	recs.Observe(dashboard.Record)
+	recs.Observe(metrics.Record)
+
+	manifest.AddFile(recordsFileName)
+
+	// Open sessions to both systems before any
+	// command is measured.
+	for _, target := range targets {
+		OpenSession(target, command, manifest, tracer)
+	}
+
+	err = manifest.Write(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
+
+	log.Printf("Running interleaved tests on pluto and Dovecot...\n")
+
+	for round, first := 0, 1; first <= runs; round, first = (round + 1), (first + batch) {
+
+		last := first + batch - 1
+		if last > runs {
+			last = runs
+		}
+
+		// Switch which system goes first in every round
+		// so that neither one constantly follows the other.
+		order := []*Target{targets[0], targets[1]}
+		if (round % 2) == 1 {
+			order = []*Target{targets[1], targets[0]}
+		}
+
+		for _, target := range order {
+			for num := first; num <= last; num++ {
+				RunCommand(target, command, num, appendMsg, recs)
+			}
+		}
+	}
+
+	for _, target := range targets {
+
+		err := utils.Logout(target.Conn, "interleavedZ")
+		if err != nil {
+			log.Fatalf("Failed to log out from %s: %s\n", target.Name, err.Error())
+		}
+
+		target.Session.End("OK")
+
+		// Calculate statistics, print and store them.
+		summary := target.Results.Summarize()
+
+		log.Printf("Done on %s, sent %d messages: %s\n", target.Name, runs, summary.Line())
+
+		summaryFileName := fmt.Sprintf("results/%s-%s-%s.summary", strings.ToLower(target.Name), scenario, logFileTime.Format("2006-01-02-15-04-05"))
+
+		err = stats.WriteSummaryFile(summaryFileName, fmt.Sprintf("Interleaved %s", strings.ToUpper(command)), target.Name, logFileTime, summary)
+		if err != nil {
+			log.Fatalf("Failed to store summary: %s\n", err.Error())
+		}
+	}
+
+	// Stop live progress updates.
+	dashboard.Stop()
+
+	// Store all buffered records.
+	err = recs.Close()
+	if err != nil {
+		log.Fatalf("Failed to store results: %s\n", err.Error())
+	}
+
+	// Stop serving metrics.
+	err = metrics.Shutdown()
+	if err != nil {
+		log.Printf("%s\n", err.Error())
+	}
+
+	// Export remaining spans.
+	err = tracer.Close()
+	if err != nil {
+		log.Printf("Failed to export spans: %s\n", err.Error())
+	}
+
+	// Note end of run in manifest.
+	err = manifest.Finish(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,616 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"crypto/tls"
+	"io/ioutil"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+	"github.com/numbleroot/pluto-evaluation/metrics"
+	"github.com/numbleroot/pluto-evaluation/progress"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/stats"
+	"github.com/numbleroot/pluto-evaluation/tracing"
+	"github.com/numbleroot/pluto-evaluation/utils"
+	"github.com/numbleroot/pluto/imap"
+)
+
+// Structs
+
+// Combination is one set of TLS parameters that
+// handshakes are measured with. Cipher 'default'
+// leaves the choice of cipher suite to crypto/tls,
+// which is the only option for TLS 1.3.
+type Combination struct {
+	Version string
+	Cipher  string
+	Curve   string
+	Resumed bool
+}
+
+// Target names one system to connect to, how TLS
+// is established with it and the TLS config all
+// combinations start from.
+type Target struct {
+	Name      string
+	Addr      string
+	Mode      string
+	TLSConfig *tls.Config
+	Verify    config.Verify
+}
+
+// Result summarizes the handshakes of one
+// combination on one target.
+type Result struct {
+	Target      string
+	Combination Combination
+	Handshakes  *stats.Histogram
+	Resumed     int
+	Negotiated  string
+	Failure     string
+}
+
+// Functions
+
+// Mode names how sessions are established.
+func (c Combination) Mode() string {
+
+	if c.Resumed {
+		return "resumed"
+	}
+
+	return "full"
+}
+
+// Scenario names the combination in records so
+// that results can be grouped and compared by it.
+func (c Combination) Scenario() string {
+	return fmt.Sprintf("tls-%s-%s-%s-%s", c.Version, c.Cipher, c.Curve, c.Mode())
+}
+
+// Apply returns a copy of base restricted to the
+// parameters of the combination. Resumed handshakes
+// get a fresh session cache of their own.
+func (c Combination) Apply(base *tls.Config, addr string) (*tls.Config, error) {
+
+	tlsConfig := base.Clone()
+
+	version, err := utils.ParseTLSVersion(c.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig.MinVersion = version
+	tlsConfig.MaxVersion = version
+
+	tlsConfig.CipherSuites = nil
+	if c.Cipher != "default" {
+
+		suite, err := utils.ParseCipherSuite(c.Cipher)
+		if err != nil {
+			return nil, err
+		}
+
+		tlsConfig.CipherSuites = []uint16{suite}
+	}
+
+	curve, err := utils.ParseCurve(c.Curve)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig.CurvePreferences = []tls.CurveID{curve}
+
+	tlsConfig.ClientSessionCache = nil
+	if c.Resumed {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(1)
+	}
+
+	// Like tls.Dial, verify the certificate against
+	// the host name connected to if none is configured.
+	if tlsConfig.ServerName == "" {
+
+		host, _, err := net.SplitHostPort(addr)
+		if err == nil {
+			tlsConfig.ServerName = host
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// SplitList returns the trimmed, non-empty elements
+// of a comma-separated list.
+func SplitList(list string) []string {
+
+	elements := make([]string, 0)
+
+	for _, element := range strings.Split(list, ",") {
+
+		element = strings.TrimSpace(element)
+		if element != "" {
+			elements = append(elements, element)
+		}
+	}
+
+	return elements
+}
+
+// Combinations builds all combinations of supplied
+// versions, cipher suites, curves and modes. Cipher
+// suites only vary up to TLS 1.2, 'all' expands to
+// every secure suite of the version.
+func Combinations(versions []string, ciphers []string, curves []string, modes []string) ([]Combination, error) {
+
+	combinations := make([]Combination, 0)
+
+	for _, version := range versions {
+
+		v, err := utils.ParseTLSVersion(version)
+		if err != nil {
+			return nil, err
+		}
+
+		versionCiphers := []string{"default"}
+
+		if v != tls.VersionTLS13 {
+
+			switch {
+			case (len(ciphers) == 1) && (ciphers[0] == "all"):
+				versionCiphers = utils.CipherSuitesFor(v)
+			case len(ciphers) > 0:
+				versionCiphers = ciphers
+			}
+		}
+
+		for _, cipher := range versionCiphers {
+
+			if cipher != "default" {
+
+				_, err := utils.ParseCipherSuite(cipher)
+				if err != nil {
+					return nil, err
+				}
+			}
+
+			for _, curve := range curves {
+
+				_, err := utils.ParseCurve(curve)
+				if err != nil {
+					return nil, err
+				}
+
+				for _, mode := range modes {
+
+					if (mode != "full") && (mode != "resumed") {
+						return nil, fmt.Errorf("unknown handshake mode '%s', choose full or resumed", mode)
+					}
+
+					combinations = append(combinations, Combination{
+						Version: version,
+						Cipher:  cipher,
+						Curve:   curve,
+						Resumed: (mode == "resumed"),
+					})
+				}
+			}
+		}
+	}
+
+	return combinations, nil
+}
+
+// Churn opens one connection to addr, times its TLS
+// handshake, consumes the greeting and logs out again.
+// In STARTTLS mode, the greeting is consumed and the
+// upgrade requested before the handshake, which alone
+// is timed. Reading responses also receives session
+// tickets sent after TLS 1.3 handshakes.
+func Churn(addr string, mode string, tlsConfig *tls.Config, tag string) (time.Time, int64, tls.ConnectionState, error) {
+
+	var state tls.ConnectionState
+
+	// Connect to remote system.
+	rawConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return time.Now(), 0, state, fmt.Errorf("was unable to connect to remote server: %s", err.Error())
+	}
+	defer rawConn.Close()
+
+	if mode == config.ModeSTARTTLS {
+
+		plainC := &imap.Connection{
+			OutConn:   rawConn,
+			OutReader: bufio.NewReader(rawConn),
+		}
+
+		// Consume mandatory IMAP greeting.
+		_, err = plainC.Receive(false)
+		if err != nil {
+			return time.Now(), 0, state, fmt.Errorf("error during receiving initial server greeting: %s", err.Error())
+		}
+
+		err = utils.StartTLS(plainC, "tlsS")
+		if err != nil {
+			return time.Now(), 0, state, err
+		}
+	}
+
+	conn := tls.Client(rawConn, tlsConfig)
+
+	// Take current time stamps around handshake.
+	start := time.Now()
+
+	err = conn.Handshake()
+	if err != nil {
+		return start, 0, state, fmt.Errorf("handshake failed: %s", err.Error())
+	}
+
+	latency := time.Since(start).Nanoseconds()
+	state = conn.ConnectionState()
+
+	c := &imap.Connection{
+		OutConn:   conn,
+		OutReader: bufio.NewReader(conn),
+	}
+
+	if mode != config.ModeSTARTTLS {
+
+		// Consume mandatory IMAP greeting.
+		_, err = c.Receive(false)
+		if err != nil {
+			return start, latency, state, fmt.Errorf("error during receiving initial server greeting: %s", err.Error())
+		}
+	}
+
+	err = utils.Logout(c, tag)
+	if err != nil {
+		return start, latency, state, err
+	}
+
+	return start, latency, state, nil
+}
+
+// RunCombination measures runs handshakes of one
+// combination on target. A combination the server
+// does not accept is given up after its first failure.
+func RunCombination(target Target, combination Combination, conn int, runs int, recs *records.Writer) Result {
+
+	result := Result{
+		Target:      target.Name,
+		Combination: combination,
+		Handshakes:  stats.NewHistogram(3),
+	}
+
+	tlsConfig, err := combination.Apply(target.TLSConfig, target.Addr)
+	if err != nil {
+		result.Failure = err.Error()
+		return result
+	}
+
+	// Obtain a session ticket first that the
+	// measured handshakes can resume from.
+	if combination.Resumed {
+
+		_, _, _, err := Churn(target.Addr, target.Mode, tlsConfig, "tlsZ")
+		if err != nil {
+			result.Failure = err.Error()
+			return result
+		}
+	}
+
+	for num := 1; num <= runs; num++ {
+
+		start, latency, state, err := Churn(target.Addr, target.Mode, tlsConfig, "tlsZ")
+
+		rec := records.Record{
+			Scenario: combination.Scenario(),
+			Target:   target.Name,
+			Conn:     conn,
+			Seq:      num,
+			Op:       "HANDSHAKE",
+			Start:    start,
+			Latency:  latency,
+			Status:   "OK",
+		}
+
+		if err != nil {
+			rec.Status = "ERROR"
+			rec.Error = err.Error()
+			result.Handshakes.RecordError()
+		} else {
+
+			result.Handshakes.Record(latency)
+			result.Negotiated = tls.CipherSuiteName(state.CipherSuite)
+
+			if state.DidResume {
+				result.Resumed++
+			}
+		}
+
+		err = recs.Write(rec)
+		if err != nil {
+			recs.Close()
+			log.Fatalf("Failed to write record: %s\n", err.Error())
+		}
+
+		// Do not hammer a server with handshakes
+		// it refused already.
+		if (rec.Status != "OK") && (num == 1) {
+			result.Failure = rec.Error
+			return result
+		}
+	}
+
+	return result
+}
+
+// FormatResults returns a table of handshake times
+// per target and combination.
+func FormatResults(results []Result) string {
+
+	out := &bytes.Buffer{}
+
+	fmt.Fprintf(out, "%-8s %-7s %-45s %-6s %-7s %7s %9s %9s %9s %9s %7s\n",
+		"Target", "Version", "Cipher suite", "Curve", "Mode", "Count", "Resumed", "p50 ms", "p90 ms", "p99 ms", "Errors")
+
+	for _, r := range results {
+
+		c := r.Combination
+
+		cipher := c.Cipher
+		if (cipher == "default") && (r.Negotiated != "") {
+			cipher = fmt.Sprintf("default (%s)", r.Negotiated)
+		}
+
+		if r.Failure != "" {
+			fmt.Fprintf(out, "%-8s %-7s %-45s %-6s %-7s failed: %s\n", r.Target, c.Version, cipher, c.Curve, c.Mode(), r.Failure)
+			continue
+		}
+
+		s := r.Handshakes.Summarize()
+
+		fmt.Fprintf(out, "%-8s %-7s %-45s %-6s %-7s %7d %9d %9.3f %9.3f %9.3f %7d\n",
+			r.Target, c.Version, cipher, c.Curve, c.Mode(), s.Count, r.Resumed,
+			(float64(s.P50) / float64(time.Millisecond)), (float64(s.P90) / float64(time.Millisecond)),
+			(float64(s.P99) / float64(time.Millisecond)), s.Errors)
+	}
+
+	return out.String()
+}
+
+func main() {
+
+	// Make test config file location, number of handshakes
+	// per combination, the matrix and results format
+	// configurable.
+	configSource := config.Flags()
+	runsFlag := flag.Int("runs", 100, "Specify how many handshakes are measured per combination and system.")
+	formatFlag := flag.String("format", "jsonl", "Specify format of machine-readable results file: jsonl or csv.")
+	progressFlag := flag.Duration("progress", time.Second, "Specify interval of live progress updates, 0 disables them.")
+	metricsFlag := flag.String("metrics", "", "Serve Prometheus metrics on this address, e.g. :9100. Empty disables them.")
+	traceFlag := flag.String("trace", "", "Export spans of all commands via OTLP/HTTP to this collector, e.g. http://localhost:4318.")
+	traceFileFlag := flag.String("traceFile", "", "Export spans of all commands as OTLP JSON to this file.")
+	targetFlag := flag.String("target", "all", "Specify which system to test: all, pluto or Dovecot.")
+	versionsFlag := flag.String("versions", "1.2,1.3", "Specify comma-separated TLS versions to combine.")
+	ciphersFlag := flag.String("ciphers", "default", "Specify comma-separated cipher suites to combine for TLS 1.2 and below, 'all' for every secure one.")
+	curvesFlag := flag.String("curves", "X25519,P256", "Specify comma-separated curves to combine.")
+	modesFlag := flag.String("modes", "full,resumed", "Specify comma-separated handshake modes to combine: full and resumed.")
+	flag.Parse()
+
+	runs := *runsFlag
+
+	// Determine which of both systems to test.
+	runPluto, runDovecot, err := utils.ParseTarget(*targetFlag)
+	if err != nil {
+		log.Fatalf("%s\n", err.Error())
+	}
+
+	combinations, err := Combinations(SplitList(*versionsFlag), SplitList(*ciphersFlag), SplitList(*curvesFlag), SplitList(*modesFlag))
+	if err != nil {
+		log.Fatalf("Invalid matrix: %s\n", err.Error())
+	}
+
+	log.Printf("Testing %d TLS combinations on %s...\n", len(combinations), utils.TargetNames(runPluto, runDovecot))
+
+	// Read configuration from file.
+	config, err := config.Load(configSource)
+	if err != nil {
+		log.Fatalf("Error loading config: %s\n", err.Error())
+	}
+
+	// Check that all settings this test needs are present.
+	if runPluto {
+		err = config.Require("Pluto")
+		if err != nil {
+			log.Fatalf("Error in config for pluto: %s\n", err.Error())
+		}
+	}
+
+	if runDovecot {
+		err = config.Require("Dovecot")
+		if err != nil {
+			log.Fatalf("Error in config for Dovecot: %s\n", err.Error())
+		}
+	}
+
+	// Create needed TLS configs with correct certificates.
+	plutoTLSConfig, dovecotTLSConfig, err := utils.InitTLSConfigs(config)
+	if err != nil {
+		log.Fatalf("Error loading TLS configs for pluto and Dovecot: %s\n", err.Error())
+	}
+
+	targets := make([]Target, 0, 2)
+
+	if runPluto {
+		targets = append(targets, Target{
+			Name:      "pluto",
+			Addr:      fmt.Sprintf("%s:%s", config.Pluto.IP, config.Pluto.Port),
+			Mode:      config.Pluto.Mode(),
+			TLSConfig: plutoTLSConfig,
+			Verify:    config.Pluto.Verify,
+		})
+	}
+
+	if runDovecot {
+		targets = append(targets, Target{
+			Name:      "Dovecot",
+			Addr:      fmt.Sprintf("%s:%s", config.Dovecot.IP, config.Dovecot.Port),
+			Mode:      config.Dovecot.Mode(),
+			TLSConfig: dovecotTLSConfig,
+			Verify:    config.Dovecot.Verify,
+		})
+	}
+
+	// Systems connected to in plain text have no
+	// handshakes to measure.
+	for _, target := range targets {
+
+		if target.TLSConfig == nil {
+			log.Fatalf("%s is configured with TLS = false, there are no handshakes to measure\n", target.Name)
+		}
+	}
+
+	// Take current time stamp shared by all files of this run.
+	logFileTime := time.Now()
+
+	// Describe this run in a manifest next to its results.
+	manifestFileName := records.ManifestFileName("tls-matrix", logFileTime)
+
+	manifest, err := records.NewManifest("tls-matrix", configSource.FileNames(), logFileTime)
+	if err != nil {
+		log.Fatalf("Failed to prepare run manifest: %s\n", err.Error())
+	}
+
+	// Serve live metrics of the run if requested.
+	if *metricsFlag != "" {
+
+		err = metrics.Serve(*metricsFlag)
+		if err != nil {
+			log.Fatalf("Failed to serve metrics: %s\n", err.Error())
+		}
+	}
+
+	// Export spans of all commands if requested.
+	tracer, err := tracing.New(*traceFlag, *traceFileFlag)
+	if err != nil {
+		log.Fatalf("Failed to prepare tracing: %s\n", err.Error())
+	}
+
+	// Show live progress of the run.
+	dashboard := progress.New(*progressFlag)
+	dashboard.Start()
+
+	manifest.SetParameter("combinations", len(combinations))
+
+	// Create machine-readable results file shared by
+	// all combinations, each record names its own.
+	recordsFileName := records.FileName(fmt.Sprintf("results/tls-matrix-%s.log", logFileTime.Format("2006-01-02-15-04-05")), *formatFlag)
+
+	recs, err := records.NewWriter(recordsFileName)
+	if err != nil {
+		log.Fatalf("Failed to create results file: %s\n", err.Error())
+	}
+	recs.Observe(dashboard.Record)
+	recs.Observe(metrics.Record)
+	recs.Observe(tracer.Record)
+
+	manifest.AddFile(recordsFileName)
+
+	// Record what each server announces about itself
+	// when connected to with the configured parameters.
+	for _, target := range targets {
+
+		c, err := utils.Dial(target.Addr, target.TLSConfig, target.Mode, nil)
+		if err != nil {
+			log.Fatalf("Failed to connect to %s: %s\n", target.Name, err.Error())
+		}
+
+		info, err := utils.ProbeServer(c, "tlsI", target.Addr, target.Verify)
+		if err != nil {
+			log.Fatalf("Failed to probe %s: %s\n", target.Name, err.Error())
+		}
+
+		manifest.AddServer(target.Name, info)
+
+		err = utils.Logout(c, "tlsZ")
+		if err != nil {
+			log.Fatalf("Failed to log out from %s: %s\n", target.Name, err.Error())
+		}
+
+		c.OutConn.Close()
+	}
+
+	err = manifest.Write(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
+
+	results := make([]Result, 0, (len(targets) * len(combinations)))
+
+	for i, combination := range combinations {
+
+		for _, target := range targets {
+
+			log.Printf("Running %d handshakes on %s with TLS %s, %s, %s, %s...\n",
+				runs, target.Name, combination.Version, combination.Cipher, combination.Curve, combination.Mode())
+
+			result := RunCombination(target, combination, i, runs, recs)
+			if result.Failure != "" {
+				log.Printf("Combination not accepted by %s: %s\n", target.Name, result.Failure)
+			}
+
+			results = append(results, result)
+		}
+	}
+
+	// Stop live progress updates.
+	dashboard.Stop()
+
+	// Print handshake times of all combinations
+	// and store them next to the results.
+	table := FormatResults(results)
+
+	log.Printf("Done, handshake times per combination:\n\n%s\n", table)
+
+	summaryFileName := fmt.Sprintf("results/tls-matrix-%s.summary", logFileTime.Format("2006-01-02-15-04-05"))
+
+	err = ioutil.WriteFile(summaryFileName, []byte(table), 0600)
+	if err != nil {
+		log.Fatalf("Failed to store summary: %s\n", err.Error())
+	}
+
+	manifest.AddFile(summaryFileName)
+
+	// Store all buffered records.
+	err = recs.Close()
+	if err != nil {
+		log.Fatalf("Failed to store results: %s\n", err.Error())
+	}
+
+	// Stop serving metrics.
+	err = metrics.Shutdown()
+	if err != nil {
+		log.Printf("%s\n", err.Error())
+	}
+
+	// Export remaining spans.
+	err = tracer.Close()
+	if err != nil {
+		log.Printf("Failed to export spans: %s\n", err.Error())
+	}
+
+	// Note end of run in manifest.
+	err = manifest.Finish(manifestFileName)
+	if err != nil {
+		log.Fatalf("Failed to write run manifest: %s\n", err.Error())
+	}
+}
@@ -0,0 +1,4 @@
+/*
+Package tracing records IMAP commands as OpenTelemetry spans and exports them via OTLP.
+*/
+package tracing
@@ -0,0 +1,202 @@
+package tracing
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/numbleroot/pluto-evaluation/records"
+)
+
+// Structs
+
+// The following structs mirror the JSON encoding of
+// an OTLP ExportTraceServiceRequest as accepted by
+// collectors on '/v1/traces' and by their file receiver.
+
+type exportRequest struct {
+	ResourceSpans []resourceSpans `json:"resourceSpans"`
+}
+
+type resourceSpans struct {
+	Resource   resource     `json:"resource"`
+	ScopeSpans []scopeSpans `json:"scopeSpans"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes"`
+}
+
+type scopeSpans struct {
+	Scope scope      `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type scope struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type otlpSpan struct {
+	TraceID           string     `json:"traceId"`
+	SpanID            string     `json:"spanId"`
+	ParentSpanID      string     `json:"parentSpanId,omitempty"`
+	Name              string     `json:"name"`
+	Kind              int        `json:"kind"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string     `json:"endTimeUnixNano"`
+	Attributes        []keyValue `json:"attributes"`
+	Status            spanStatus `json:"status"`
+}
+
+type spanStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+// Constants
+
+// Span kind and status codes as defined by OTLP.
+const (
+	kindClient  = 3
+	statusOK    = 1
+	statusError = 2
+)
+
+// Variables
+
+// ServiceName identifies this client in traces.
+var ServiceName = "pluto-evaluation"
+
+// client posts export requests to collectors.
+var client = &http.Client{
+	Timeout: (10 * time.Second),
+}
+
+// Functions
+
+// value wraps a Go value into its OTLP representation.
+func value(v interface{}) anyValue {
+
+	switch v := v.(type) {
+	case int:
+		s := strconv.Itoa(v)
+		return anyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return anyValue{IntValue: &s}
+	case float64:
+		return anyValue{DoubleValue: &v}
+	case bool:
+		return anyValue{BoolValue: &v}
+	case string:
+		return anyValue{StringValue: &v}
+	}
+
+	s := fmt.Sprintf("%v", v)
+	return anyValue{StringValue: &s}
+}
+
+// encode builds the JSON export request of spans.
+func encode(spans []*Span) ([]byte, error) {
+
+	encoded := make([]otlpSpan, 0, len(spans))
+
+	for _, s := range spans {
+
+		// Sort attributes for reproducible output.
+		keys := make([]string, 0, len(s.attributes))
+		for key := range s.attributes {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		attributes := make([]keyValue, 0, len(keys))
+		for _, key := range keys {
+			attributes = append(attributes, keyValue{key, value(s.attributes[key])})
+		}
+
+		status := spanStatus{Code: statusOK}
+		if s.status != "OK" {
+			status = spanStatus{Code: statusError, Message: s.status}
+		}
+
+		encoded = append(encoded, otlpSpan{
+			TraceID:           s.traceID,
+			SpanID:            s.spanID,
+			ParentSpanID:      s.parentID,
+			Name:              s.name,
+			Kind:              kindClient,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Attributes:        attributes,
+			Status:            status,
+		})
+	}
+
+	request := exportRequest{
+		ResourceSpans: []resourceSpans{
+			{
+				Resource: resource{
+					Attributes: []keyValue{
+						{"service.name", value(ServiceName)},
+						{"service.version", value(records.ToolVersion)},
+					},
+				},
+				ScopeSpans: []scopeSpans{
+					{
+						Scope: scope{
+							Name:    ServiceName,
+							Version: records.ToolVersion,
+						},
+						Spans: encoded,
+					},
+				},
+			},
+		},
+	}
+
+	requestRaw, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode spans: %s", err.Error())
+	}
+
+	return requestRaw, nil
+}
+
+// post sends an export request to endpoint.
+func post(endpoint string, request []byte) error {
+
+	resp, err := client.Post(endpoint, "application/json", bytes.NewReader(request))
+	if err != nil {
+		return fmt.Errorf("failed to export spans to '%s': %s", endpoint, err.Error())
+	}
+	defer resp.Body.Close()
+
+	if (resp.StatusCode < 200) || (resp.StatusCode > 299) {
+
+		body, _ := ioutil.ReadAll(resp.Body)
+
+		return fmt.Errorf("collector at '%s' rejected spans with %s: %s", endpoint, resp.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
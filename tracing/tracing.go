@@ -0,0 +1,340 @@
+package tracing
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/numbleroot/pluto-evaluation/records"
+)
+
+// Structs
+
+// Span is one timed operation, e.g. an IMAP command
+// or the TLS handshake of a session. All methods can
+// be called on a nil span, doing nothing, so that code
+// does not need to check whether tracing is enabled.
+type Span struct {
+	tracer     *Tracer
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	status     string
+}
+
+// Tracer collects finished spans and exports them in
+// batches to an OTLP/HTTP endpoint or a JSON file. Full
+// batches are exported in the background so that
+// measuring sessions never wait for a collector. A
+// nil tracer creates nil spans.
+type Tracer struct {
+	lock     *sync.Mutex
+	endpoint string
+	file     io.WriteCloser
+	batch    []*Span
+	queue    chan []*Span
+	done     chan struct{}
+	closed   bool
+	dropped  int
+	err      error
+}
+
+// Variables
+
+// BatchSize is the number of finished spans that
+// are exported together.
+var BatchSize = 256
+
+// QueueSize is the number of full batches that may
+// wait for export. Once the queue is full, further
+// batches are dropped instead of slowing down the test.
+var QueueSize = 16
+
+// Functions
+
+// New prepares a tracer exporting to the OTLP/HTTP
+// endpoint of a collector, e.g. 'http://localhost:4318',
+// and/or to fileName as OTLP JSON, one export request
+// per line. If both are empty, tracing is disabled and
+// nil is returned.
+func New(endpoint string, fileName string) (*Tracer, error) {
+
+	if (endpoint == "") && (fileName == "") {
+		return nil, nil
+	}
+
+	t := &Tracer{
+		lock:  &sync.Mutex{},
+		batch: make([]*Span, 0, BatchSize),
+		queue: make(chan []*Span, QueueSize),
+		done:  make(chan struct{}),
+	}
+
+	if endpoint != "" {
+
+		endpoint = strings.TrimSuffix(endpoint, "/")
+		if strings.HasSuffix(endpoint, "/v1/traces") != true {
+			endpoint = fmt.Sprintf("%s/v1/traces", endpoint)
+		}
+
+		t.endpoint = endpoint
+	}
+
+	if fileName != "" {
+
+		file, err := os.Create(fileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create trace file '%s': %s", fileName, err.Error())
+		}
+
+		t.file = file
+	}
+
+	go t.export()
+
+	return t, nil
+}
+
+// newID returns n random bytes hex-encoded.
+func newID(n int) string {
+
+	id := make([]byte, n)
+	rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
+
+// Start begins a span called name. Without parent,
+// the span starts a new trace.
+func (t *Tracer) Start(name string, parent *Span) *Span {
+	return t.StartAt(name, parent, time.Now())
+}
+
+// StartAt begins a span called name at supplied time.
+func (t *Tracer) StartAt(name string, parent *Span, start time.Time) *Span {
+
+	if t == nil {
+		return nil
+	}
+
+	s := &Span{
+		tracer:     t,
+		spanID:     newID(8),
+		name:       name,
+		start:      start,
+		attributes: make(map[string]interface{}),
+	}
+
+	if parent != nil {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	} else {
+		s.traceID = newID(16)
+	}
+
+	return s
+}
+
+// Child begins a span called name below s. On a nil
+// span, it returns nil.
+func (s *Span) Child(name string) *Span {
+
+	if s == nil {
+		return nil
+	}
+
+	return s.tracer.Start(name, s)
+}
+
+// Session begins the span of one IMAP session of
+// user on target, starting a new trace. The TLS
+// handshake, login and commands of the session are
+// traced as its children.
+func (t *Tracer) Session(target string, user string) *Span {
+
+	s := t.Start("IMAP session", nil)
+	s.Set("imap.target", target)
+	s.Set("imap.user", user)
+
+	return s
+}
+
+// Command begins a span below session s for the IMAP
+// command sent with tag to target. Mailbox names the
+// mailbox the command operates on, if any.
+func (s *Span) Command(target string, tag string, command string, mailbox string) *Span {
+
+	span := s.Child(command)
+	span.Set("imap.target", target)
+	span.Set("imap.tag", tag)
+	span.Set("imap.command", command)
+
+	if mailbox != "" {
+		span.Set("imap.mailbox", mailbox)
+	}
+
+	return span
+}
+
+// Record turns a written results record into a span
+// of its own trace. It suits tests whose records time
+// whole logins or handshakes, tests of IMAP commands
+// trace them below their sessions instead. Its
+// signature fits records.Writer.Observe.
+func (t *Tracer) Record(rec records.Record) {
+
+	if t == nil {
+		return
+	}
+
+	s := t.StartAt(rec.Op, nil, rec.Start)
+	s.Set("imap.target", rec.Target)
+	s.Set("imap.command", rec.Op)
+	s.Set("imap.user", rec.User)
+	s.Set("imap.conn", rec.Conn)
+	s.Set("imap.seq", rec.Seq)
+	s.Set("imap.bytes", rec.Bytes)
+	s.Set("imap.status", rec.Status)
+	s.Set("test.scenario", rec.Scenario)
+
+	s.EndAt(rec.Status, rec.Start.Add(time.Duration(rec.Latency)))
+}
+
+// Set attaches an attribute to the span. Values may
+// be strings, integers, floats or booleans.
+func (s *Span) Set(key string, value interface{}) {
+
+	if s == nil {
+		return
+	}
+
+	s.attributes[key] = value
+}
+
+// End finishes the span with supplied IMAP status,
+// anything but OK marks the span as failed.
+func (s *Span) End(status string) {
+	s.EndAt(status, time.Now())
+}
+
+// EndAt finishes the span at supplied time.
+func (s *Span) EndAt(status string, end time.Time) {
+
+	if s == nil {
+		return
+	}
+
+	s.end = end
+	s.status = status
+
+	s.tracer.finish(s)
+}
+
+// finish queues a finished span and hands the batch
+// to the exporter once it is full. Spans finished after
+// Close are dropped.
+func (t *Tracer) finish(s *Span) {
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.closed {
+		t.dropped++
+		return
+	}
+
+	t.batch = append(t.batch, s)
+
+	if len(t.batch) >= BatchSize {
+
+		select {
+		case t.queue <- t.batch:
+		default:
+			t.dropped += len(t.batch)
+		}
+
+		t.batch = make([]*Span, 0, BatchSize)
+	}
+}
+
+// export writes and posts all batches handed to it
+// until the queue is closed. Only the first error is
+// kept, it is reported by Close.
+func (t *Tracer) export() {
+
+	for batch := range t.queue {
+
+		request, err := encode(batch)
+
+		if (err == nil) && (t.file != nil) {
+			_, err = t.file.Write(append(request, '\n'))
+		}
+
+		if (err == nil) && (t.endpoint != "") {
+			err = post(t.endpoint, request)
+		}
+
+		if (err != nil) && (t.err == nil) {
+			t.err = err
+		}
+	}
+
+	close(t.done)
+}
+
+// Close exports all remaining spans, waits for the
+// export to complete and returns the first error that
+// occurred while exporting, or how many spans had to
+// be dropped.
+func (t *Tracer) Close() error {
+
+	if t == nil {
+		return nil
+	}
+
+	t.lock.Lock()
+
+	if t.closed {
+		t.lock.Unlock()
+		<-t.done
+		return t.err
+	}
+
+	t.closed = true
+
+	if len(t.batch) > 0 {
+		t.queue <- t.batch
+		t.batch = nil
+	}
+
+	close(t.queue)
+	dropped := t.dropped
+
+	t.lock.Unlock()
+
+	<-t.done
+
+	if t.file != nil {
+
+		err := t.file.Close()
+		if (err != nil) && (t.err == nil) {
+			t.err = err
+		}
+	}
+
+	if (dropped > 0) && (t.err == nil) {
+		t.err = fmt.Errorf("dropped %d spans because export could not keep up", dropped)
+	}
+
+	return t.err
+}
@@ -0,0 +1,514 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+	"github.com/numbleroot/pluto-evaluation/tracing"
+	"github.com/numbleroot/pluto/imap"
+)
+
+// Variables
+
+// scramNonce returns the client nonce that starts a
+// SCRAM exchange, base64 encoding 18 random bytes.
+// Tests replace it to replay known exchanges.
+var scramNonce = func() (string, error) {
+
+	nonce := make([]byte, 18)
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate SCRAM nonce: %s", err.Error())
+	}
+
+	return base64.StdEncoding.EncodeToString(nonce), nil
+}
+
+// Functions
+
+// Authenticate logs user in on the server behind c
+// via mechanism, one of config.AuthMechanisms, and
+// fails if the server does not accept the credentials.
+// For XOAUTH2 and OAUTHBEARER, the password of user is
+// sent as access token. Capabilities needed to choose
+// how to authenticate are requested beforehand if the
+// server did not announce them yet, so that only the
+// authentication itself is timed as child span of
+// session.
+func Authenticate(c *imap.Connection, tag string, mechanism string, user config.User, session *tracing.Span) error {
+
+	var answer, status string
+	var err error
+
+	saslIR := false
+
+	if mechanism != config.AuthLogin {
+
+		capability, err := Capability(c, tag)
+		if err != nil {
+			return err
+		}
+
+		saslIR = hasCapability(capability, "SASL-IR")
+	}
+
+	command := "LOGIN"
+	if mechanism != config.AuthLogin {
+		command = fmt.Sprintf("AUTHENTICATE %s", mechanism)
+	}
+
+	span := session.Child(command)
+	span.Set("imap.tag", tag)
+	span.Set("imap.command", command)
+	span.Set("imap.user", user.Name)
+
+	switch mechanism {
+
+	case config.AuthLogin:
+		answer, status, err = login(c, tag, user)
+
+	case config.AuthPlain:
+		answer, status, err = saslExchange(c, tag, mechanism, saslIR, plainClient(user))
+
+	case config.AuthCRAMMD5:
+		answer, status, err = saslExchange(c, tag, mechanism, saslIR, cramMD5Client(user))
+
+	case config.AuthSCRAMSHA256:
+		answer, status, err = saslExchange(c, tag, mechanism, saslIR, scramSHA256Client(user))
+
+	case config.AuthXOAUTH2:
+		answer, status, err = saslExchange(c, tag, mechanism, saslIR, xoauth2Client(user))
+
+	case config.AuthOAuthBearer:
+		answer, status, err = saslExchange(c, tag, mechanism, saslIR, oauthBearerClient(user))
+
+	default:
+		err = fmt.Errorf("unknown mechanism '%s'", mechanism)
+	}
+
+	if err != nil {
+		span.End("ERROR")
+		return fmt.Errorf("error during %s as user %s: %s", command, user.Name, err.Error())
+	}
+
+	span.Set("imap.status", status)
+	span.End(status)
+
+	if status != "OK" {
+		return fmt.Errorf("server responded unexpectedly to %s: %s", command, answer)
+	}
+
+	// Remember how the session was authenticated.
+	// Capabilities may differ from now on.
+	if conn, ok := c.OutConn.(*Conn); ok {
+		conn.Auth = mechanism
+		conn.Capability = ""
+	}
+
+	return nil
+}
+
+// Capability returns the capabilities of the server
+// behind c. Capabilities already announced on the
+// connection are reused, otherwise they are requested
+// with supplied tag.
+func Capability(c *imap.Connection, tag string) (string, error) {
+
+	conn, ok := c.OutConn.(*Conn)
+	if (ok) && (conn.Capability != "") {
+		return conn.Capability, nil
+	}
+
+	err := c.Send(false, fmt.Sprintf("%s CAPABILITY", tag))
+	if err != nil {
+		return "", fmt.Errorf("sending CAPABILITY to server failed with: %s", err.Error())
+	}
+
+	answer, status, err := ReceiveTagged(c, tag)
+	if err != nil {
+		return "", fmt.Errorf("error receiving CAPABILITY response: %s", err.Error())
+	}
+
+	if status != "OK" {
+		return "", fmt.Errorf("server responded unexpectedly to CAPABILITY: %s", answer)
+	}
+
+	capability := untaggedData(answer, "CAPABILITY")
+
+	if ok {
+		conn.Capability = capability
+	}
+
+	return capability, nil
+}
+
+// login sends LOGIN with name and password of user
+// as quoted strings, or as literals if they contain
+// characters a quoted string cannot carry.
+func login(c *imap.Connection, tag string, user config.User) (string, string, error) {
+
+	command := fmt.Sprintf("%s LOGIN", tag)
+
+	for _, arg := range []string{user.Name, user.Password} {
+
+		if needsLiteral(arg) != true {
+			command = fmt.Sprintf("%s %s", command, quote(arg))
+			continue
+		}
+
+		// Announce literal and wait for the server
+		// to be ready to receive it.
+		err := c.Send(false, fmt.Sprintf("%s {%d}", command, len(arg)))
+		if err != nil {
+			return "", "", fmt.Errorf("sending LOGIN to server failed with: %s", err.Error())
+		}
+
+		answer, err := c.Receive(false)
+		if err != nil {
+			return "", "", err
+		}
+
+		if strings.HasPrefix(answer, "+") != true {
+			return answer, "", fmt.Errorf("server did not accept literal: %s", answer)
+		}
+
+		command = arg
+	}
+
+	err := c.Send(false, command)
+	if err != nil {
+		return "", "", fmt.Errorf("sending LOGIN to server failed with: %s", err.Error())
+	}
+
+	return ReceiveTagged(c, tag)
+}
+
+// needsLiteral reports whether arg cannot be sent
+// as quoted string, i.e. contains line breaks, NUL or
+// characters outside of 7-bit ASCII.
+func needsLiteral(arg string) bool {
+
+	for i := 0; i < len(arg); i++ {
+
+		if (arg[i] == '\r') || (arg[i] == '\n') || (arg[i] == 0) || (arg[i] > 0x7f) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// quote returns arg as IMAP quoted string.
+func quote(arg string) string {
+
+	arg = strings.Replace(arg, "\\", "\\\\", -1)
+	arg = strings.Replace(arg, "\"", "\\\"", -1)
+
+	return fmt.Sprintf("\"%s\"", arg)
+}
+
+// saslExchange authenticates via SASL mechanism. The
+// client of the mechanism is called with nil first and
+// may return an initial response, which is sent along
+// with AUTHENTICATE if the server supports SASL-IR or
+// in response to its first empty challenge otherwise.
+// Each further challenge of the server is passed to the
+// client to compute the response from. If the client
+// fails, the exchange is cancelled.
+func saslExchange(c *imap.Connection, tag string, mechanism string, saslIR bool, client func(challenge []byte) ([]byte, error)) (string, string, error) {
+
+	pending, err := client(nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	command := fmt.Sprintf("%s AUTHENTICATE %s", tag, mechanism)
+
+	if (saslIR) && (pending != nil) {
+
+		// Empty initial responses are sent as '='.
+		initial := base64.StdEncoding.EncodeToString(pending)
+		if initial == "" {
+			initial = "="
+		}
+
+		command = fmt.Sprintf("%s %s", command, initial)
+		pending = nil
+	}
+
+	err = c.Send(false, command)
+	if err != nil {
+		return "", "", fmt.Errorf("sending AUTHENTICATE to server failed with: %s", err.Error())
+	}
+
+	var clientErr error
+	tagPrefix := fmt.Sprintf("%s ", tag)
+
+	for {
+
+		answer, err := c.Receive(false)
+		if err != nil {
+			return "", "", err
+		}
+
+		// Tagged completion ends the exchange.
+		if strings.HasPrefix(answer, tagPrefix) {
+
+			status := strings.TrimPrefix(answer, tagPrefix)
+			if i := strings.Index(status, " "); i != -1 {
+				status = status[:i]
+			}
+
+			return answer, strings.ToUpper(status), clientErr
+		}
+
+		// Skip untagged responses, e.g. capabilities.
+		if strings.HasPrefix(answer, "+") != true {
+			continue
+		}
+
+		var response []byte
+
+		if pending != nil {
+
+			// Initial response not sent along.
+			response = pending
+			pending = nil
+
+		} else {
+
+			challenge, err := base64.StdEncoding.DecodeString(strings.TrimSpace(strings.TrimPrefix(answer, "+")))
+			if err != nil {
+				return "", "", fmt.Errorf("server sent malformed challenge: %s", answer)
+			}
+
+			response, err = client(challenge)
+			if err != nil {
+
+				// Cancel exchange and wait for the
+				// server to acknowledge this.
+				clientErr = err
+
+				err = c.Send(false, "*")
+				if err != nil {
+					return "", "", fmt.Errorf("cancelling AUTHENTICATE failed with: %s", err.Error())
+				}
+
+				continue
+			}
+		}
+
+		err = c.Send(false, base64.StdEncoding.EncodeToString(response))
+		if err != nil {
+			return "", "", fmt.Errorf("sending AUTHENTICATE response to server failed with: %s", err.Error())
+		}
+	}
+}
+
+// plainClient implements PLAIN (RFC 4616).
+func plainClient(user config.User) func([]byte) ([]byte, error) {
+
+	return func(challenge []byte) ([]byte, error) {
+
+		if challenge != nil {
+			return nil, fmt.Errorf("unexpected challenge for PLAIN")
+		}
+
+		return []byte(fmt.Sprintf("\x00%s\x00%s", user.Name, user.Password)), nil
+	}
+}
+
+// cramMD5Client implements CRAM-MD5 (RFC 2195).
+func cramMD5Client(user config.User) func([]byte) ([]byte, error) {
+
+	return func(challenge []byte) ([]byte, error) {
+
+		// The server speaks first.
+		if challenge == nil {
+			return nil, nil
+		}
+
+		mac := hmac.New(md5.New, []byte(user.Password))
+		mac.Write(challenge)
+
+		return []byte(fmt.Sprintf("%s %s", user.Name, hex.EncodeToString(mac.Sum(nil)))), nil
+	}
+}
+
+// scramSHA256Client implements SCRAM-SHA-256 (RFC
+// 5802 and RFC 7677) without channel binding. The
+// signature of the server is verified as well.
+func scramSHA256Client(user config.User) func([]byte) ([]byte, error) {
+
+	step := 0
+	clientFirstBare := ""
+	serverSignature := []byte(nil)
+
+	return func(challenge []byte) ([]byte, error) {
+
+		step++
+
+		switch step {
+
+		case 1:
+
+			nonce, err := scramNonce()
+			if err != nil {
+				return nil, err
+			}
+
+			// Names must not contain ',' and '=' as is.
+			name := strings.Replace(strings.Replace(user.Name, "=", "=3D", -1), ",", "=2C", -1)
+			clientFirstBare = fmt.Sprintf("n=%s,r=%s", name, nonce)
+
+			return []byte(fmt.Sprintf("n,,%s", clientFirstBare)), nil
+
+		case 2:
+
+			serverFirst := string(challenge)
+			attrs := scramAttributes(serverFirst)
+
+			clientNonce := scramAttributes(clientFirstBare)["r"]
+			if (strings.HasPrefix(attrs["r"], clientNonce) != true) || (attrs["r"] == clientNonce) {
+				return nil, fmt.Errorf("server sent invalid SCRAM nonce: %s", serverFirst)
+			}
+
+			salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+			if err != nil {
+				return nil, fmt.Errorf("server sent invalid SCRAM salt: %s", serverFirst)
+			}
+
+			iterations, err := strconv.Atoi(attrs["i"])
+			if (err != nil) || (iterations < 1) {
+				return nil, fmt.Errorf("server sent invalid SCRAM iteration count: %s", serverFirst)
+			}
+
+			// 'biws' is the encoding of 'n,,', i.e. no
+			// channel binding and no authorization name.
+			clientFinalBare := fmt.Sprintf("c=biws,r=%s", attrs["r"])
+			authMessage := []byte(fmt.Sprintf("%s,%s,%s", clientFirstBare, serverFirst, clientFinalBare))
+
+			saltedPassword := scramHi([]byte(user.Password), salt, iterations)
+			clientKey := hmacSHA256(saltedPassword, []byte("Client Key"))
+			storedKey := sha256.Sum256(clientKey)
+			clientSignature := hmacSHA256(storedKey[:], authMessage)
+
+			proof := make([]byte, len(clientKey))
+			for i := range clientKey {
+				proof[i] = clientKey[i] ^ clientSignature[i]
+			}
+
+			serverKey := hmacSHA256(saltedPassword, []byte("Server Key"))
+			serverSignature = hmacSHA256(serverKey, authMessage)
+
+			return []byte(fmt.Sprintf("%s,p=%s", clientFinalBare, base64.StdEncoding.EncodeToString(proof))), nil
+
+		case 3:
+
+			attrs := scramAttributes(string(challenge))
+
+			if attrs["e"] != "" {
+				return nil, fmt.Errorf("server rejected SCRAM proof: %s", attrs["e"])
+			}
+
+			signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+			if (err != nil) || (hmac.Equal(signature, serverSignature) != true) {
+				return nil, fmt.Errorf("server sent invalid SCRAM signature")
+			}
+
+			return []byte{}, nil
+		}
+
+		return nil, fmt.Errorf("unexpected challenge for SCRAM-SHA-256")
+	}
+}
+
+// scramAttributes splits a SCRAM message into its
+// attributes, e.g. 'r=abc,s=def'.
+func scramAttributes(message string) map[string]string {
+
+	attrs := make(map[string]string)
+
+	for _, attr := range strings.Split(message, ",") {
+
+		if (len(attr) > 1) && (attr[1] == '=') {
+			attrs[attr[:1]] = attr[2:]
+		}
+	}
+
+	return attrs
+}
+
+// scramHi derives the salted password as defined
+// by SCRAM, i.e. PBKDF2 with HMAC-SHA-256 yielding
+// one block.
+func scramHi(password []byte, salt []byte, iterations int) []byte {
+
+	u := hmacSHA256(password, append(append([]byte{}, salt...), 0, 0, 0, 1))
+
+	result := make([]byte, len(u))
+	copy(result, u)
+
+	for i := 1; i < iterations; i++ {
+
+		u = hmacSHA256(password, u)
+
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+
+	return result
+}
+
+// hmacSHA256 returns the HMAC-SHA-256 of message.
+func hmacSHA256(key []byte, message []byte) []byte {
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+
+	return mac.Sum(nil)
+}
+
+// xoauth2Client implements Google's XOAUTH2 with the
+// password of user as access token. Errors are sent
+// as challenge, which is answered empty.
+func xoauth2Client(user config.User) func([]byte) ([]byte, error) {
+
+	return func(challenge []byte) ([]byte, error) {
+
+		if challenge != nil {
+			return []byte{}, nil
+		}
+
+		return []byte(fmt.Sprintf("user=%s\x01auth=Bearer %s\x01\x01", user.Name, user.Password)), nil
+	}
+}
+
+// oauthBearerClient implements OAUTHBEARER (RFC 7628)
+// with the password of user as access token. Errors
+// are sent as challenge, which is answered with the
+// required dummy response.
+func oauthBearerClient(user config.User) func([]byte) ([]byte, error) {
+
+	return func(challenge []byte) ([]byte, error) {
+
+		if challenge != nil {
+			return []byte{0x01}, nil
+		}
+
+		name := strings.Replace(strings.Replace(user.Name, "=", "=3D", -1), ",", "=2C", -1)
+
+		return []byte(fmt.Sprintf("n,a=%s,\x01auth=Bearer %s\x01\x01", name, user.Password)), nil
+	}
+}
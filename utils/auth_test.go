@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"testing"
+
+	"encoding/hex"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+)
+
+// Structs
+
+// saslStep is one challenge of a SASL exchange and
+// the response the client is expected to send, or
+// whether it is expected to fail.
+type saslStep struct {
+	challenge []byte
+	response  string
+	fails     bool
+}
+
+// Functions
+
+// TestSASLClients replays the exchanges of the SASL
+// mechanisms, where available the examples of their
+// RFCs, and checks every response of the client.
+func TestSASLClients(t *testing.T) {
+
+	// Client nonce of the example in RFC 7677.
+	defer func(nonce func() (string, error)) {
+		scramNonce = nonce
+	}(scramNonce)
+
+	scramNonce = func() (string, error) {
+		return "rOprNGfwEbeRWgbNEkqO", nil
+	}
+
+	tim := config.User{Name: "tim", Password: "tanstaaftanstaaf"}
+	scramUser := config.User{Name: "user", Password: "pencil"}
+
+	serverFirst := []byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	clientFinal := "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+
+	tests := []struct {
+		name   string
+		client func([]byte) ([]byte, error)
+		steps  []saslStep
+	}{
+		{
+			name:   "PLAIN",
+			client: plainClient(tim),
+			steps: []saslStep{
+				{nil, "\x00tim\x00tanstaaftanstaaf", false},
+			},
+		},
+		{
+			name:   "PLAIN with challenge",
+			client: plainClient(tim),
+			steps: []saslStep{
+				{[]byte("unexpected"), "", true},
+			},
+		},
+		{
+			// Example of RFC 2195, section 2.
+			name:   "CRAM-MD5",
+			client: cramMD5Client(tim),
+			steps: []saslStep{
+				{nil, "", false},
+				{[]byte("<1896.697170952@postoffice.reston.mci.net>"), "tim b913a602c7eda7a495b4e6e7334d3890", false},
+			},
+		},
+		{
+			// Example of RFC 7677, section 3.
+			name:   "SCRAM-SHA-256",
+			client: scramSHA256Client(scramUser),
+			steps: []saslStep{
+				{nil, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO", false},
+				{serverFirst, clientFinal, false},
+				{[]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="), "", false},
+			},
+		},
+		{
+			name:   "SCRAM-SHA-256 escaped name",
+			client: scramSHA256Client(config.User{Name: "a=b,c", Password: "pencil"}),
+			steps: []saslStep{
+				{nil, "n,,n=a=3Db=2Cc,r=rOprNGfwEbeRWgbNEkqO", false},
+			},
+		},
+		{
+			name:   "SCRAM-SHA-256 foreign nonce",
+			client: scramSHA256Client(scramUser),
+			steps: []saslStep{
+				{nil, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO", false},
+				{[]byte("r=somethingElse,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"), "", true},
+			},
+		},
+		{
+			name:   "SCRAM-SHA-256 unextended nonce",
+			client: scramSHA256Client(scramUser),
+			steps: []saslStep{
+				{nil, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO", false},
+				{[]byte("r=rOprNGfwEbeRWgbNEkqO,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"), "", true},
+			},
+		},
+		{
+			name:   "SCRAM-SHA-256 no iterations",
+			client: scramSHA256Client(scramUser),
+			steps: []saslStep{
+				{nil, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO", false},
+				{[]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=0"), "", true},
+			},
+		},
+		{
+			name:   "SCRAM-SHA-256 wrong server signature",
+			client: scramSHA256Client(scramUser),
+			steps: []saslStep{
+				{nil, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO", false},
+				{serverFirst, clientFinal, false},
+				{[]byte("v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="), "", true},
+			},
+		},
+		{
+			name:   "SCRAM-SHA-256 rejected proof",
+			client: scramSHA256Client(scramUser),
+			steps: []saslStep{
+				{nil, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO", false},
+				{serverFirst, clientFinal, false},
+				{[]byte("e=invalid-proof"), "", true},
+			},
+		},
+		{
+			name:   "XOAUTH2",
+			client: xoauth2Client(config.User{Name: "someone@example.com", Password: "ya29.token"}),
+			steps: []saslStep{
+				{nil, "user=someone@example.com\x01auth=Bearer ya29.token\x01\x01", false},
+				{[]byte("{\"status\":\"401\"}"), "", false},
+			},
+		},
+		{
+			name:   "OAUTHBEARER",
+			client: oauthBearerClient(config.User{Name: "someone@example.com", Password: "ya29.token"}),
+			steps: []saslStep{
+				{nil, "n,a=someone@example.com,\x01auth=Bearer ya29.token\x01\x01", false},
+				{[]byte("{\"status\":\"invalid_token\"}"), "\x01", false},
+			},
+		},
+	}
+
+	for _, test := range tests {
+
+		for i, step := range test.steps {
+
+			response, err := test.client(step.challenge)
+
+			if step.fails {
+
+				if err == nil {
+					t.Errorf("%s: expected step %d to fail but got response %q", test.name, i, response)
+				}
+
+				break
+			}
+
+			if err != nil {
+				t.Errorf("%s: step %d failed: %s", test.name, i, err.Error())
+				break
+			}
+
+			if string(response) != step.response {
+				t.Errorf("%s: step %d: expected response %q but got %q", test.name, i, step.response, response)
+				break
+			}
+		}
+	}
+}
+
+// TestScramHi checks the salted password against
+// the PBKDF2-HMAC-SHA-256 vectors of RFC 7914.
+func TestScramHi(t *testing.T) {
+
+	tests := []struct {
+		password   string
+		salt       string
+		iterations int
+		expected   string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56"},
+	}
+
+	for _, test := range tests {
+
+		value := hex.EncodeToString(scramHi([]byte(test.password), []byte(test.salt), test.iterations))
+		if value != test.expected {
+			t.Errorf("%s with %d iterations: expected %s but got %s", test.password, test.iterations, test.expected, value)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"fmt"
+
+	"crypto/tls"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+	"github.com/numbleroot/pluto-evaluation/oauth"
+	"github.com/numbleroot/pluto-evaluation/tracing"
+	"github.com/numbleroot/pluto/imap"
+)
+
+// Structs
+
+// GmailSession keeps one logged in connection to
+// Gmail as User. If OAuth is configured, each login
+// uses a fresh access token in place of the password
+// and Renew logs in again before the token expires,
+// so that long runs do not outlive their token.
+// Each connection is traced as its own Session span,
+// if Tracer is set.
+type GmailSession struct {
+	Addr      string
+	TLSConfig *tls.Config
+	Mode      string
+	Auth      string
+	User      config.User
+	Tokens    *oauth.TokenSource
+	Tracer    *tracing.Tracer
+	Conn      *imap.Connection
+	Session   *tracing.Span
+}
+
+// Functions
+
+// NewGmailSession prepares a session as user to the
+// Gmail server of conf, traced by tracer which may be
+// nil. It does not connect yet.
+func NewGmailSession(conf *config.Config, tlsConfig *tls.Config, user config.User, tracer *tracing.Tracer) *GmailSession {
+
+	session := &GmailSession{
+		Addr:      fmt.Sprintf("%s:%s", conf.Gmail.Server, conf.Gmail.Port),
+		TLSConfig: tlsConfig,
+		Mode:      conf.Gmail.Mode(),
+		Auth:      conf.Gmail.Auth,
+		User:      user,
+		Tracer:    tracer,
+	}
+
+	if conf.Gmail.UsesOAuth() {
+		session.Tokens = oauth.NewTokenSource(conf.Gmail.OAuth)
+	}
+
+	return session
+}
+
+// Login connects to Gmail and logs in with supplied
+// tag, obtaining an access token first if needed.
+func (s *GmailSession) Login(tag string) (*imap.Connection, error) {
+
+	user := s.User
+
+	if s.Tokens != nil {
+
+		token, err := s.Tokens.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		user.Password = token
+	}
+
+	// Trace the new connection as its own session.
+	session := s.Tracer.Session("gmail", s.User.Name)
+
+	c, err := Dial(s.Addr, s.TLSConfig, s.Mode, session)
+	if err != nil {
+		session.End("ERROR")
+		return nil, fmt.Errorf("was unable to connect to remote gmail server: %s", err.Error())
+	}
+
+	err = Authenticate(c, tag, s.Auth, user, session)
+	if err != nil {
+		session.End("ERROR")
+		c.OutConn.Close()
+		return nil, err
+	}
+
+	s.Conn = c
+	s.Session = session
+
+	return c, nil
+}
+
+// Renew logs in again on a new connection if the
+// access token of the current one is about to expire.
+// The old connection is logged out and closed, Conn
+// and Session are replaced by the new ones. It
+// returns whether this happened.
+func (s *GmailSession) Renew(tag string) (bool, error) {
+
+	if (s.Tokens == nil) || (s.Tokens.Expiring() != true) {
+		return false, nil
+	}
+
+	// The old session ends anyway, do not fail
+	// if the server already closed it.
+	if s.Conn != nil {
+		Logout(s.Conn, fmt.Sprintf("%sZ", tag))
+		s.Conn.OutConn.Close()
+		s.Session.End("OK")
+	}
+
+	_, err := s.Login(tag)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
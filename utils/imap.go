@@ -0,0 +1,410 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+
+	"crypto/tls"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+	"github.com/numbleroot/pluto-evaluation/records"
+	"github.com/numbleroot/pluto-evaluation/tracing"
+	"github.com/numbleroot/pluto/imap"
+)
+
+// Structs
+
+// Conn is the network connection underneath an IMAP
+// connection returned by Dial. Next to the connection
+// itself, it remembers how it was established, whether
+// the server refused LOGIN before TLS was in place by
+// advertising LOGINDISABLED, the capabilities the
+// server announced for the current state of the
+// connection, if any, and the mechanism used to
+// authenticate.
+type Conn struct {
+	net.Conn
+	TLS           *tls.Conn
+	Mode          string
+	LoginDisabled bool
+	Capability    string
+	Auth          string
+}
+
+// Functions
+
+// Dial connects to the IMAP server listening on addr
+// in supplied mode, as returned by the Mode method of
+// the configured system: 'tls' performs the TLS
+// handshake right away, 'starttls' upgrades a plain
+// connection via STARTTLS and 'plain' does not encrypt
+// at all. It wraps the connection into an IMAP
+// connection and consumes the mandatory greeting of
+// the server. The TLS handshake is timed as child span
+// of session.
+func Dial(addr string, tlsConfig *tls.Config, mode string, session *tracing.Span) (*imap.Connection, error) {
+
+	// Connect to remote system.
+	rawConn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("was unable to connect to remote server: %s", err.Error())
+	}
+
+	conn := &Conn{
+		Conn: rawConn,
+		Mode: mode,
+	}
+
+	c := &imap.Connection{
+		OutConn:   conn,
+		OutReader: bufio.NewReader(rawConn),
+	}
+
+	if mode != config.ModeTLS {
+
+		// Consume mandatory IMAP greeting, sent in
+		// plain text before any upgrade.
+		_, err = c.Receive(false)
+		if err != nil {
+			rawConn.Close()
+			return nil, fmt.Errorf("error during receiving initial server greeting: %s", err.Error())
+		}
+
+		// Learn whether the server allows logging in
+		// without encryption and supports upgrading.
+		capability, err := preTLSCapability(c)
+		if err != nil {
+			rawConn.Close()
+			return nil, err
+		}
+
+		conn.LoginDisabled = hasCapability(capability, "LOGINDISABLED")
+
+		if mode == config.ModePlain {
+			conn.Capability = capability
+			return c, nil
+		}
+
+		if hasCapability(capability, "STARTTLS") != true {
+			rawConn.Close()
+			return nil, fmt.Errorf("server does not advertise STARTTLS: %s", capability)
+		}
+
+		err = StartTLS(c, "preTLS")
+		if err != nil {
+			rawConn.Close()
+			return nil, err
+		}
+	}
+
+	// Perform TLS handshake on its own in order
+	// to be able to time it.
+	conn.TLS, err = handshake(rawConn, addr, tlsConfig, session)
+	if err != nil {
+		rawConn.Close()
+		return nil, fmt.Errorf("was unable to connect to remote server: %s", err.Error())
+	}
+
+	// From now on, all traffic is encrypted.
+	conn.Conn = conn.TLS
+	c.OutReader = bufio.NewReader(conn.TLS)
+
+	if mode == config.ModeTLS {
+
+		// Consume mandatory IMAP greeting and keep
+		// the capabilities it may announce.
+		greeting, err := c.Receive(false)
+		if err != nil {
+			conn.TLS.Close()
+			return nil, fmt.Errorf("error during receiving initial server greeting: %s", err.Error())
+		}
+
+		conn.Capability = greetingCapability(greeting)
+	}
+
+	return c, nil
+}
+
+// StartTLS asks the server behind c to upgrade the
+// connection and waits for it to agree. The handshake
+// itself is left to the caller.
+func StartTLS(c *imap.Connection, tag string) error {
+
+	err := c.Send(false, fmt.Sprintf("%s STARTTLS", tag))
+	if err != nil {
+		return fmt.Errorf("sending STARTTLS to server failed with: %s", err.Error())
+	}
+
+	answer, status, err := ReceiveTagged(c, tag)
+	if err != nil {
+		return fmt.Errorf("error receiving STARTTLS response: %s", err.Error())
+	}
+
+	if status != "OK" {
+		return fmt.Errorf("server responded unexpectedly to STARTTLS: %s", answer)
+	}
+
+	return nil
+}
+
+// handshake performs the TLS handshake over rawConn
+// and times it as child span of session.
+func handshake(rawConn net.Conn, addr string, tlsConfig *tls.Config, session *tracing.Span) (*tls.Conn, error) {
+
+	// Like tls.Dial, verify the certificate against
+	// the host name connected to if none is configured.
+	if tlsConfig.ServerName == "" {
+
+		host, _, err := net.SplitHostPort(addr)
+		if err == nil {
+			tlsConfig = tlsConfig.Clone()
+			tlsConfig.ServerName = host
+		}
+	}
+
+	span := session.Child("TLS handshake")
+
+	conn := tls.Client(rawConn, tlsConfig)
+
+	err := conn.Handshake()
+	if err != nil {
+		span.End("ERROR")
+		return nil, err
+	}
+
+	state := conn.ConnectionState()
+	span.Set("tls.version", tls.VersionName(state.Version))
+	span.Set("tls.cipher_suite", tls.CipherSuiteName(state.CipherSuite))
+	span.End("OK")
+
+	return conn, nil
+}
+
+// preTLSCapability asks the server behind c for its
+// capabilities while the connection is not yet
+// encrypted.
+func preTLSCapability(c *imap.Connection) (string, error) {
+
+	err := c.Send(false, "preTLS CAPABILITY")
+	if err != nil {
+		return "", fmt.Errorf("sending CAPABILITY to server failed with: %s", err.Error())
+	}
+
+	answer, status, err := ReceiveTagged(c, "preTLS")
+	if err != nil {
+		return "", fmt.Errorf("error receiving CAPABILITY response: %s", err.Error())
+	}
+
+	if status != "OK" {
+		return "", fmt.Errorf("server responded unexpectedly to CAPABILITY: %s", answer)
+	}
+
+	return untaggedData(answer, "CAPABILITY"), nil
+}
+
+// greetingCapability returns the capabilities
+// announced in a greeting like '* OK [CAPABILITY
+// IMAP4rev1 SASL-IR] ready', or none.
+func greetingCapability(greeting string) string {
+
+	start := strings.Index(strings.ToUpper(greeting), "[CAPABILITY ")
+	if start == -1 {
+		return ""
+	}
+
+	capability := greeting[(start + len("[CAPABILITY ")):]
+
+	end := strings.Index(capability, "]")
+	if end == -1 {
+		return ""
+	}
+
+	return capability[:end]
+}
+
+// hasCapability reports whether name is contained
+// in the space-separated capability list.
+func hasCapability(capability string, name string) bool {
+
+	for _, c := range strings.Fields(capability) {
+
+		if strings.EqualFold(c, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ReceiveTagged reads lines from the server until the
+// tagged completion response for supplied tag arrives.
+// It returns all received lines joined by CRLF and the
+// status of the completion response (OK, NO or BAD).
+func ReceiveTagged(c *imap.Connection, tag string) (string, string, error) {
+
+	answer := ""
+	tagPrefix := fmt.Sprintf("%s ", tag)
+
+	for {
+
+		// Receive next line from server.
+		nextAnswer, err := c.Receive(false)
+		if err != nil {
+			return answer, "", err
+		}
+
+		if answer == "" {
+			answer = nextAnswer
+		} else {
+			answer = fmt.Sprintf("%s\r\n%s", answer, nextAnswer)
+		}
+
+		// As long as the IMAP command termination indicator
+		// was not yet received, continue to append answers.
+		if strings.HasPrefix(nextAnswer, tagPrefix) {
+
+			status := strings.TrimPrefix(nextAnswer, tagPrefix)
+			if i := strings.Index(status, " "); i != -1 {
+				status = status[:i]
+			}
+
+			return answer, strings.ToUpper(status), nil
+		}
+	}
+}
+
+// Logout ends the session on c and waits for the
+// server to acknowledge this.
+func Logout(c *imap.Connection, tag string) error {
+
+	// Log out.
+	err := c.Send(false, fmt.Sprintf("%s LOGOUT", tag))
+	if err != nil {
+		return fmt.Errorf("error during LOGOUT: %s", err.Error())
+	}
+
+	// Receive BYE and completion.
+	answer, status, err := ReceiveTagged(c, tag)
+	if err != nil {
+		return fmt.Errorf("error receiving LOGOUT response: %s", err.Error())
+	}
+
+	if status != "OK" {
+		return fmt.Errorf("server responded unexpectedly to LOGOUT: %s", answer)
+	}
+
+	return nil
+}
+
+// ProbeServer asks the server behind c for its
+// CAPABILITY and ID (RFC 2971) responses and notes
+// the connection mode, negotiated TLS parameters of
+// the connection, how its certificate was checked
+// according to verify, and how the session was
+// authenticated. Servers not supporting ID are
+// recorded as such, as are servers advertising
+// LOGINDISABLED.
+func ProbeServer(c *imap.Connection, tag string, addr string, verify config.Verify) (records.Server, error) {
+
+	server := records.Server{
+		Addr:       addr,
+		Mode:       config.ModeTLS,
+		TLSVersion: "none",
+	}
+
+	tlsConn, ok := c.OutConn.(*tls.Conn)
+
+	if conn, isConn := c.OutConn.(*Conn); isConn {
+		server.Mode = conn.Mode
+		server.LoginDisabled = conn.LoginDisabled
+		server.Auth = conn.Auth
+		tlsConn, ok = conn.TLS, (conn.TLS != nil)
+	}
+
+	// Note negotiated TLS version and cipher suite.
+	if ok {
+
+		state := tlsConn.ConnectionState()
+		server.TLSVersion = tls.VersionName(state.Version)
+		server.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+
+		// Note whether the certificate chain was verified
+		// or verification was explicitly turned off, which
+		// pins were enforced and which public key the
+		// server presented.
+		server.Verification = "verified"
+		if verify.Insecure {
+			server.Verification = "insecure"
+		}
+
+		if verify.PinCert != "" {
+			server.Pins = append(server.Pins, "cert")
+		}
+
+		if verify.PinSPKI != "" {
+			server.Pins = append(server.Pins, "spki")
+		}
+
+		if len(state.PeerCertificates) > 0 {
+			server.PeerSPKI = SPKIHash(state.PeerCertificates[0])
+		}
+	}
+
+	// Ask for capabilities.
+	err := c.Send(false, fmt.Sprintf("%s CAPABILITY", tag))
+	if err != nil {
+		return server, fmt.Errorf("sending CAPABILITY to server failed with: %s", err.Error())
+	}
+
+	answer, status, err := ReceiveTagged(c, tag)
+	if err != nil {
+		return server, fmt.Errorf("error receiving CAPABILITY response: %s", err.Error())
+	}
+
+	if status != "OK" {
+		return server, fmt.Errorf("server responded unexpectedly to CAPABILITY: %s", answer)
+	}
+
+	server.Capability = untaggedData(answer, "CAPABILITY")
+
+	if hasCapability(server.Capability, "LOGINDISABLED") {
+		server.LoginDisabled = true
+	}
+
+	// Identify ourselves and ask the server to do the same.
+	err = c.Send(false, fmt.Sprintf("%s ID (\"name\" \"pluto-evaluation\" \"version\" \"%s\")", tag, records.ToolVersion))
+	if err != nil {
+		return server, fmt.Errorf("sending ID to server failed with: %s", err.Error())
+	}
+
+	answer, status, err = ReceiveTagged(c, tag)
+	if err != nil {
+		return server, fmt.Errorf("error receiving ID response: %s", err.Error())
+	}
+
+	if status == "OK" {
+		server.ID = untaggedData(answer, "ID")
+	} else {
+		server.ID = "unsupported"
+	}
+
+	return server, nil
+}
+
+// untaggedData returns the data of the first untagged
+// response of supplied type contained in answer.
+func untaggedData(answer string, responseType string) string {
+
+	prefix := fmt.Sprintf("* %s ", responseType)
+
+	for _, line := range strings.Split(answer, "\r\n") {
+
+		if strings.HasPrefix(strings.ToUpper(line), prefix) {
+			return line[len(prefix):]
+		}
+	}
+
+	return ""
+}
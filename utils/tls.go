@@ -0,0 +1,165 @@
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"crypto/tls"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+)
+
+// Variables
+
+// TLSVersions maps the version names accepted in
+// configs and flags to their protocol versions.
+var TLSVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Curves maps the names of supported key exchange
+// curves to their identifiers.
+var Curves = map[string]tls.CurveID{
+	"X25519": tls.X25519,
+	"P256":   tls.CurveP256,
+	"P384":   tls.CurveP384,
+	"P521":   tls.CurveP521,
+}
+
+// Functions
+
+// ParseTLSVersion returns the protocol version
+// called name, e.g. '1.2'.
+func ParseTLSVersion(name string) (uint16, error) {
+
+	version, found := TLSVersions[strings.TrimPrefix(strings.TrimSpace(name), "TLS")]
+	if found != true {
+		return 0, fmt.Errorf("unknown TLS version '%s', choose one of 1.0, 1.1, 1.2 or 1.3", name)
+	}
+
+	return version, nil
+}
+
+// ParseCurve returns the curve called name.
+func ParseCurve(name string) (tls.CurveID, error) {
+
+	curve, found := Curves[strings.TrimSpace(name)]
+	if found != true {
+
+		names := make([]string, 0, len(Curves))
+		for n := range Curves {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		return 0, fmt.Errorf("unknown curve '%s', choose one of %s", name, strings.Join(names, ", "))
+	}
+
+	return curve, nil
+}
+
+// ParseCipherSuite returns the cipher suite called
+// name as listed by crypto/tls, insecure ones included
+// so that they can be measured as well.
+func ParseCipherSuite(name string) (uint16, error) {
+
+	name = strings.TrimSpace(name)
+
+	for _, suites := range [][]*tls.CipherSuite{tls.CipherSuites(), tls.InsecureCipherSuites()} {
+
+		for _, suite := range suites {
+
+			if suite.Name == name {
+				return suite.ID, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("unknown cipher suite '%s'", name)
+}
+
+// CipherSuitesFor returns the names of all secure
+// cipher suites that can be configured for TLS 1.2
+// and below, negotiable with version.
+func CipherSuitesFor(version uint16) []string {
+
+	names := make([]string, 0)
+
+	for _, suite := range tls.CipherSuites() {
+
+		for _, v := range suite.SupportedVersions {
+
+			if (v == version) && (v != tls.VersionTLS13) {
+				names = append(names, suite.Name)
+			}
+		}
+	}
+
+	return names
+}
+
+// ApplyTLSParams restricts tlsConfig to the versions,
+// cipher suites and curves of params and sets up its
+// session cache.
+func ApplyTLSParams(tlsConfig *tls.Config, params config.TLSParams) error {
+
+	var err error
+
+	if params.MinVersion != "" {
+
+		tlsConfig.MinVersion, err = ParseTLSVersion(params.MinVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	if params.MaxVersion != "" {
+
+		tlsConfig.MaxVersion, err = ParseTLSVersion(params.MaxVersion)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Either bound may come from the base config
+	// rather than from params.
+	if (tlsConfig.MinVersion != 0) && (tlsConfig.MaxVersion != 0) && (tlsConfig.MinVersion > tlsConfig.MaxVersion) {
+		return fmt.Errorf("minimum TLS version %s is above maximum %s", tls.VersionName(tlsConfig.MinVersion), tls.VersionName(tlsConfig.MaxVersion))
+	}
+
+	if len(params.CipherSuites) > 0 {
+
+		tlsConfig.CipherSuites = make([]uint16, len(params.CipherSuites))
+
+		for i, name := range params.CipherSuites {
+
+			tlsConfig.CipherSuites[i], err = ParseCipherSuite(name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if len(params.Curves) > 0 {
+
+		tlsConfig.CurvePreferences = make([]tls.CurveID, len(params.Curves))
+
+		for i, name := range params.Curves {
+
+			tlsConfig.CurvePreferences[i], err = ParseCurve(name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if params.SessionCache > 0 {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(params.SessionCache)
+	}
+
+	return nil
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"crypto/tls"
+
+	"github.com/numbleroot/pluto-evaluation/config"
+)
+
+// Functions
+
+// TestApplyTLSParamsVersions checks that version
+// bounds of params and of the base config are
+// checked against each other and named on error.
+func TestApplyTLSParamsVersions(t *testing.T) {
+
+	tests := []struct {
+		baseMin  uint16
+		params   config.TLSParams
+		expected string
+	}{
+		{0, config.TLSParams{MinVersion: "1.2", MaxVersion: "1.3"}, ""},
+		{tls.VersionTLS12, config.TLSParams{MaxVersion: "1.3"}, ""},
+		{0, config.TLSParams{MinVersion: "1.3", MaxVersion: "1.2"}, "minimum TLS version TLS 1.3 is above maximum TLS 1.2"},
+		{tls.VersionTLS12, config.TLSParams{MaxVersion: "1.1"}, "minimum TLS version TLS 1.2 is above maximum TLS 1.1"},
+	}
+
+	for _, test := range tests {
+
+		tlsConfig := &tls.Config{MinVersion: test.baseMin}
+
+		err := ApplyTLSParams(tlsConfig, test.params)
+
+		if test.expected == "" {
+
+			if err != nil {
+				t.Errorf("%+v: expected versions to be accepted but got: %s", test.params, err.Error())
+			}
+
+			continue
+		}
+
+		if (err == nil) || (strings.Contains(err.Error(), test.expected) != true) {
+			t.Errorf("%+v: expected error containing '%s' but got: %v", test.params, test.expected, err)
+		}
+	}
+}
@@ -2,9 +2,13 @@ package utils
 
 import (
 	"fmt"
+	"strings"
 
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
 	"io/ioutil"
 
 	"github.com/numbleroot/pluto-evaluation/config"
@@ -15,37 +19,209 @@ import (
 
 // InitTLSConfigs returns pluto's and Dovecot's TLS
 // config so that secure connections can be made from
-// outside the systems.
+// outside the systems. Certificates are verified as
+// configured in their Verify sections. Systems with
+// TLS turned off get no config.
 func InitTLSConfigs(config *config.Config) (*tls.Config, *tls.Config, error) {
 
-	// Create TLS config for pluto.
-	plutoTLSConfig, err := crypto.NewPublicTLSConfig(config.Pluto.Distributor.CertLoc, config.Pluto.Distributor.KeyLoc)
+	var plutoTLSConfig *tls.Config
+
+	// Create TLS config for pluto unless it is
+	// connected to in plain text only.
+	if config.Pluto.TLS {
+
+		publicTLSConfig, err := crypto.NewPublicTLSConfig(config.Pluto.Distributor.CertLoc, config.Pluto.Distributor.KeyLoc)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// For tests, we currently need to build a custom
+		// x509 cert pool to accept the self-signed public
+		// distributor certificate.
+		plutoTLSConfig, err = NewTLSConfig(publicTLSConfig, config.Pluto.Verify, config.Pluto.TLSParams, config.Pluto.Distributor.CertLoc)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to prepare verification of pluto's certificate: %s", err.Error())
+		}
+	}
+
+	// Create TLS config for Dovecot, trusting its
+	// certificate if one is configured.
+	trusted := make([]string, 0, 1)
+	if config.Dovecot.CertLoc != "" {
+		trusted = append(trusted, config.Dovecot.CertLoc)
+	}
+
+	if config.Dovecot.TLS != true {
+		return plutoTLSConfig, nil, nil
+	}
+
+	dovecotTLSConfig, err := NewTLSConfig(&tls.Config{}, config.Dovecot.Verify, config.Dovecot.TLSParams, trusted...)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, fmt.Errorf("failed to prepare verification of Dovecot's certificate: %s", err.Error())
 	}
 
-	// For tests, we currently need to build a custom
-	// x509 cert pool to accept the self-signed public
-	// distributor certificate.
-	plutoTLSConfig.RootCAs = x509.NewCertPool()
+	return plutoTLSConfig, dovecotTLSConfig, nil
+}
+
+// InitGmailTLSConfig returns the TLS config to
+// connect to Gmail, verified as configured in its
+// Verify section.
+func InitGmailTLSConfig(config *config.Config) (*tls.Config, error) {
 
-	// Read distributor's public certificate in PEM format into memory.
-	plutoRootCert, err := ioutil.ReadFile(config.Pluto.Distributor.CertLoc)
+	gmailTLSConfig, err := NewTLSConfig(&tls.Config{}, config.Gmail.Verify, config.Gmail.TLSParams)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to load pluto's cert file: %s", err.Error())
+		return nil, fmt.Errorf("failed to prepare verification of Gmail's certificate: %s", err.Error())
 	}
 
-	// Append certificate to test client's root CA pool.
-	ok := plutoTLSConfig.RootCAs.AppendCertsFromPEM(plutoRootCert)
-	if ok != true {
-		return nil, nil, fmt.Errorf("failed to append pluto's cert file")
+	return gmailTLSConfig, nil
+}
+
+// NewTLSConfig extends base to verify certificates
+// as described by verify and to negotiate as restricted
+// by params. Certificates in PEM files trusted and in
+// verify's CA bundle are accepted as roots in addition
+// to any already in base. Without any of them, the
+// system's roots are used.
+func NewTLSConfig(base *tls.Config, verify config.Verify, params config.TLSParams, trusted ...string) (*tls.Config, error) {
+
+	tlsConfig := base.Clone()
+
+	err := ApplyTLSParams(tlsConfig, params)
+	if err != nil {
+		return nil, err
 	}
 
-	// Create TLS config for Dovecot.
-	dovecotTLSConfig := &tls.Config{
-		// Unfortunately, we currently need to accept this.
-		InsecureSkipVerify: true,
+	if verify.CABundle != "" {
+		trusted = append(trusted, verify.CABundle)
 	}
 
-	return plutoTLSConfig, dovecotTLSConfig, nil
+	// Build pool of additional root certificates.
+	if len(trusted) > 0 {
+
+		if tlsConfig.RootCAs == nil {
+			tlsConfig.RootCAs = x509.NewCertPool()
+		}
+
+		for _, file := range trusted {
+
+			// Read certificates in PEM format into memory.
+			certs, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load cert file: %s", err.Error())
+			}
+
+			// Append certificates to test client's root CA pool.
+			ok := tlsConfig.RootCAs.AppendCertsFromPEM(certs)
+			if ok != true {
+				return nil, fmt.Errorf("failed to append certificates of '%s'", file)
+			}
+		}
+	}
+
+	if verify.ServerName != "" {
+		tlsConfig.ServerName = verify.ServerName
+	}
+
+	// Only skip verification if explicitly asked to.
+	tlsConfig.InsecureSkipVerify = verify.Insecure
+
+	// Pins are checked in addition to, or instead
+	// of, verifying the chain.
+	pins := make([]string, 0, 2)
+
+	if verify.PinSPKI != "" {
+		pins = append(pins, verify.PinSPKI)
+	}
+
+	if verify.PinCert != "" {
+
+		pinCert, err := ioutil.ReadFile(verify.PinCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load pinned cert file: %s", err.Error())
+		}
+
+		block, _ := pem.Decode(pinCert)
+		if (block == nil) || (block.Type != "CERTIFICATE") {
+			return nil, fmt.Errorf("pinned cert file '%s' contains no PEM certificate", verify.PinCert)
+		}
+
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse pinned certificate: %s", err.Error())
+		}
+
+		pins = append(pins, SPKIHash(cert))
+	}
+
+	if len(pins) > 0 {
+
+		tlsConfig.VerifyPeerCertificate = func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("server presented no certificate")
+			}
+
+			leaf, err := x509.ParseCertificate(rawCerts[0])
+			if err != nil {
+				return fmt.Errorf("failed to parse server certificate: %s", err.Error())
+			}
+
+			hash := SPKIHash(leaf)
+
+			for _, pin := range pins {
+
+				if hash != pin {
+					return fmt.Errorf("server certificate with public key hash %s does not match pin %s", hash, pin)
+				}
+			}
+
+			return nil
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+// SPKIHash returns the base64-encoded SHA-256 hash
+// of the public key of cert, as used for pinning.
+func SPKIHash(cert *x509.Certificate) string {
+
+	hash := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+// ParseTarget interprets the value of a test's target
+// flag: 'all' runs the test on pluto and Dovecot, 'pluto'
+// or 'Dovecot' only on one of them. Case is ignored.
+func ParseTarget(target string) (bool, bool, error) {
+
+	switch strings.ToLower(target) {
+	case "all":
+		return true, true, nil
+	case "pluto":
+		return true, false, nil
+	case "dovecot":
+		return false, true, nil
+	}
+
+	return false, false, fmt.Errorf("unknown target '%s', choose one of all, pluto or Dovecot", target)
+}
+
+// TargetNames names the systems selected by the
+// results of ParseTarget for messages, e.g. 'pluto
+// and Dovecot'.
+func TargetNames(runPluto bool, runDovecot bool) string {
+
+	names := make([]string, 0, 2)
+
+	if runPluto {
+		names = append(names, "pluto")
+	}
+
+	if runDovecot {
+		names = append(names, "Dovecot")
+	}
+
+	return strings.Join(names, " and ")
 }